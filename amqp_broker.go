@@ -0,0 +1,661 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"github.com/streadway/amqp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultReconnectDelay    = time.Second
+	defaultMaxReconnectDelay = time.Minute
+)
+
+// Error of the operations on a closed broker
+var ErrBrokerClosed = errors.New("broker closed")
+
+var errUnknownConsumer = errors.New("unknown consumer")
+
+// AMQP broker, the messages are published and consumed on a channel,
+// brokers created with DialAMQPBroker own their connection and
+// recover from connection failures,
+// ReconnectDelay - delay before the first reconnection attempt,
+// doubled after every failed attempt,
+// MaxReconnectDelay - upper bound of the reconnection delay,
+// ConfirmTimeout - time Publish waits for a confirmation in confirm mode,
+// PublishChannels - number of channels the publishes of a dialed broker
+// are spread over, concurrent publishes share the broker channel
+// when 0, channels are opened on demand and replaced once closed,
+// ConsumerTagPrefix - prefix of the consumer tags, numbered from 1
+// as the kombu ones, the node name of the process followed by a dot
+// by default, such as gen<pid>@<host>.1,
+// Logger - optional logger, the package one by default,
+// Metrics - optional observer of the reconnections
+type AMQPBroker struct {
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	ConfirmTimeout    time.Duration
+	PublishChannels   int
+	ConsumerTagPrefix string
+	Logger            Logger
+	Metrics           Metrics
+
+	url string
+
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	ch        *amqp.Channel
+	ready     chan struct{}
+	exchanges map[string]amqpExchange
+	queues    map[string]amqp.Table
+	exclusive map[string]bool
+	bindings  map[amqpBinding]bool
+	qos       *amqpQos
+
+	confirmer *confirmer
+	returns   []chan *PublishError
+	pool      *channelPool
+	tags      uint64
+	consumers map[string]*amqpConsumer
+
+	once sync.Once
+	done chan struct{}
+}
+
+// Declared exchange, kept for reconnections
+type amqpExchange struct {
+	kind string
+	args amqp.Table
+}
+
+// Prefetch settings, kept for reconnections
+type amqpQos struct {
+	prefetch int
+	global   bool
+}
+
+// Declared binding, kept for reconnections
+type amqpBinding struct {
+	queue    string
+	exchange string
+	key      string
+}
+
+// Running consumer, cancel stops it and done is closed once
+// its deliveries are drained
+type amqpConsumer struct {
+	queue  string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Settles an AMQP delivery
+type amqpAcknowledger struct {
+	d amqp.Delivery
+}
+
+// Returns a pointer to a new AMQP broker using ch,
+// consumers stop when ch is closed
+func NewAMQPBroker(ch *amqp.Channel) *AMQPBroker {
+	b := newAMQPBroker("")
+	b.ch = ch
+	close(b.ready)
+
+	return b
+}
+
+// Returns a pointer to a new AMQP broker connected to url,
+// when the connection or channel fails the broker redials with
+// exponential backoff, declares its queues again and resumes
+// its consumers on the channels they were returned
+func DialAMQPBroker(url string) (*AMQPBroker, error) {
+	b := newAMQPBroker(url)
+	if err := b.connect(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func newAMQPBroker(url string) *AMQPBroker {
+	return &AMQPBroker{
+		ReconnectDelay:    defaultReconnectDelay,
+		MaxReconnectDelay: defaultMaxReconnectDelay,
+		url:               url,
+		ready:             make(chan struct{}),
+		exchanges:         make(map[string]amqpExchange),
+		queues:            make(map[string]amqp.Table),
+		exclusive:         make(map[string]bool),
+		bindings:          make(map[amqpBinding]bool),
+		consumers:         make(map[string]*amqpConsumer),
+		done:              make(chan struct{}),
+	}
+}
+
+// Dials when the connection is down, opens a channel and declares
+// the broker exchanges, queues and bindings on it
+func (b *AMQPBroker) connect() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil || b.conn.IsClosed() {
+		conn, err := amqp.Dial(b.url)
+		if err != nil {
+			return err
+		}
+
+		b.conn = conn
+		b.pool = nil
+	}
+
+	ch, err := b.conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	if b.qos != nil {
+		if err := ch.Qos(b.qos.prefetch, 0, b.qos.global); err != nil {
+			ch.Close()
+			return err
+		}
+	}
+
+	for name, e := range b.exchanges {
+		if err := ch.ExchangeDeclare(name, e.kind, true, false, false, false, e.args); err != nil {
+			ch.Close()
+			return err
+		}
+	}
+
+	for name, args := range b.queues {
+		durable := !b.exclusive[name]
+
+		if _, err := ch.QueueDeclare(name, durable, !durable, !durable, false, args); err != nil {
+			ch.Close()
+			return err
+		}
+	}
+
+	for binding := range b.bindings {
+		if err := ch.QueueBind(binding.queue, binding.key, binding.exchange, false, nil); err != nil {
+			ch.Close()
+			return err
+		}
+	}
+
+	if b.confirmer != nil {
+		if b.confirmer, err = newConfirmer(ch); err != nil {
+			ch.Close()
+			return err
+		}
+	}
+
+	if len(b.returns) > 0 {
+		go b.forwardReturns(ch.NotifyReturn(make(chan amqp.Return, 1)))
+	}
+
+	b.ch = ch
+	close(b.ready)
+
+	go b.watch(ch.NotifyClose(make(chan *amqp.Error, 1)))
+
+	return nil
+}
+
+// Waits for the channel to close and reconnects,
+// nothing is done once the broker is closed
+func (b *AMQPBroker) watch(closed <-chan *amqp.Error) {
+	err := <-closed
+
+	select {
+	case <-b.done:
+		return
+	default:
+	}
+
+	b.mu.Lock()
+	b.ready = make(chan struct{})
+	b.mu.Unlock()
+
+	loggerOr(b.Logger).Warn("AMQP channel closed, reconnecting", "error", err)
+
+	delay := b.ReconnectDelay
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-time.After(delay):
+		}
+
+		err := b.connect()
+		if err == nil {
+			metricsOr(b.Metrics).Reconnected()
+			return
+		}
+
+		loggerOr(b.Logger).Error("Failed to reconnect", "error", err)
+
+		if delay *= 2; delay > b.MaxReconnectDelay {
+			delay = b.MaxReconnectDelay
+		}
+	}
+}
+
+// Returns the current channel
+func (b *AMQPBroker) current() *amqp.Channel {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.ch
+}
+
+// Returns the current channel once connected,
+// waits for a reconnection in progress until ctx is done
+func (b *AMQPBroker) channel(ctx context.Context) (*amqp.Channel, error) {
+	b.mu.RLock()
+	ready := b.ready
+	b.mu.RUnlock()
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-b.done:
+		return nil, ErrBrokerClosed
+	}
+
+	return b.current(), nil
+}
+
+func (a amqpAcknowledger) Ack() error {
+	return a.d.Ack(false)
+}
+
+func (a amqpAcknowledger) Nack(requeue bool) error {
+	return a.d.Nack(false, requeue)
+}
+
+func (a amqpAcknowledger) Reject(requeue bool) error {
+	return a.d.Reject(requeue)
+}
+
+// Returns the AMQP publishing for a message
+func publishing(msg *Message) amqp.Publishing {
+	return amqp.Publishing{
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		Timestamp:       msg.Timestamp,
+		Headers:         amqp.Table(msg.Headers),
+		Body:            msg.Body,
+	}
+}
+
+// Returns the message for an AMQP delivery
+func delivered(d amqp.Delivery) *Message {
+	return &Message{
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		Timestamp:       d.Timestamp,
+		Headers:         map[string]interface{}(d.Headers),
+		Body:            d.Body,
+		Exchange:        d.Exchange,
+		RoutingKey:      d.RoutingKey,
+		Redelivered:     d.Redelivered,
+		ConsumerTag:     d.ConsumerTag,
+		Acknowledger:    amqpAcknowledger{d},
+	}
+}
+
+// Publish a message to exchange with routing key,
+// publishing fails while the broker is reconnecting
+func (b *AMQPBroker) Publish(exchange, key string, msg *Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.confirmTimeout())
+	defer cancel()
+
+	return b.PublishContext(ctx, exchange, key, msg)
+}
+
+// Returns the time a publish waits for its confirmation
+func (b *AMQPBroker) confirmTimeout() time.Duration {
+	if b.ConfirmTimeout <= 0 {
+		return defaultConfirmTimeout
+	}
+
+	return b.ConfirmTimeout
+}
+
+// Binds queue to exchange with key and starts consuming it,
+// deliveries are left unacknowledged for the receiver
+func (b *AMQPBroker) Consume(queue, exchange, key string) (<-chan *Message, error) {
+	return b.ConsumeContext(context.Background(), queue, exchange, key)
+}
+
+// Same as Consume, when ctx is done the AMQP consumer is cancelled,
+// deliveries not handed to the receiver yet are requeued
+// and the messages channel is closed, the consumer tag is set on
+// the messages and can be given to Cancel
+func (b *AMQPBroker) ConsumeContext(ctx context.Context, queue, exchange, key string) (<-chan *Message, error) {
+	return b.ConsumeTag(ctx, queue, exchange, key, b.consumerTag())
+}
+
+// Same as ConsumeContext with a consumer tag of the caller,
+// the tag must be unique on the channel, a reconnection in progress
+// is waited for until ctx is done
+func (b *AMQPBroker) ConsumeTag(ctx context.Context, queue, exchange, key, tag string) (<-chan *Message, error) {
+	ch, err := b.channel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := b.subscribe(ch, queue, exchange, key, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := &amqpConsumer{queue: queue, cancel: cancel, done: make(chan struct{})}
+
+	b.mu.Lock()
+	b.consumers[tag] = c
+	b.mu.Unlock()
+
+	messages := make(chan *Message)
+
+	go func() {
+		defer close(c.done)
+		defer b.removeConsumer(tag, c)
+
+		b.forward(ctx, ch, deliveries, messages, queue, exchange, key, tag)
+	}()
+
+	return messages, nil
+}
+
+// Returns a new consumer tag, unique within the process
+func (b *AMQPBroker) consumerTag() string {
+	prefix := b.ConsumerTagPrefix
+	if prefix == "" {
+		prefix = anonNodeName() + "."
+	}
+
+	return prefix + strconv.FormatUint(atomic.AddUint64(&b.tags, 1), 10)
+}
+
+// Forgets a stopped consumer
+func (b *AMQPBroker) removeConsumer(tag string, c *amqpConsumer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.consumers[tag] == c {
+		delete(b.consumers, tag)
+	}
+
+	c.cancel()
+}
+
+// Returns the tags of the running consumers by queue
+func (b *AMQPBroker) Consumers() map[string][]string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	tags := make(map[string][]string)
+	for tag, c := range b.consumers {
+		tags[c.queue] = append(tags[c.queue], tag)
+	}
+
+	return tags
+}
+
+// Cancels the consumer with tag with a basic.cancel, the deliveries
+// not handed to the receiver yet are requeued and its messages
+// channel is closed, returns once the consumer is drained
+func (b *AMQPBroker) Cancel(tag string) error {
+	b.mu.RLock()
+	c, ok := b.consumers[tag]
+	b.mu.RUnlock()
+
+	if !ok {
+		return errUnknownConsumer
+	}
+
+	c.cancel()
+	<-c.done
+
+	return nil
+}
+
+// Binds queue to exchange with key and consumes it on ch, queues
+// are bound to the default exchange by their name and are not bound
+// again, other consumers, such as other workers, share the queue
+func (b *AMQPBroker) subscribe(ch *amqp.Channel, queue, exchange, key, tag string) (<-chan amqp.Delivery, error) {
+	if exchange != "" {
+		if err := ch.QueueBind(queue, key, exchange, false, nil); err != nil {
+			loggerOr(b.Logger).Error("Failed to bind queue", "queue", queue, "exchange", exchange, "error", err)
+			return nil, err
+		}
+	}
+
+	deliveries, err := ch.Consume(queue, tag, false, false, false, false, nil)
+	if err != nil {
+		loggerOr(b.Logger).Error("Failed to consume queue", "queue", queue, "error", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Forwards deliveries to messages, the consumer is subscribed again
+// after a reconnection, messages is closed when ctx is done, when the
+// broker is closed or, for brokers without a connection of their own,
+// with the channel
+func (b *AMQPBroker) forward(ctx context.Context, ch *amqp.Channel, deliveries <-chan amqp.Delivery, messages chan<- *Message, queue, exchange, key, tag string) {
+	defer close(messages)
+
+	for {
+		if !deliver(ctx, ch, deliveries, messages, tag) {
+			return
+		}
+
+		if b.url == "" {
+			return
+		}
+
+		for {
+			var err error
+
+			if ch, err = b.channel(ctx); err != nil {
+				return
+			}
+
+			if deliveries, err = b.subscribe(ch, queue, exchange, key, tag); err == nil {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			case <-time.After(b.ReconnectDelay):
+			}
+		}
+	}
+}
+
+// Hands deliveries to messages until deliveries is closed,
+// returns false when the consumer was cancelled because ctx is done
+func deliver(ctx context.Context, ch *amqp.Channel, deliveries <-chan amqp.Delivery, messages chan<- *Message, tag string) bool {
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				return true
+			}
+
+			select {
+			case messages <- delivered(d):
+			case <-ctx.Done():
+				d.Nack(false, true)
+				cancelConsumer(ch, deliveries, tag)
+				return false
+			}
+
+		case <-ctx.Done():
+			cancelConsumer(ch, deliveries, tag)
+			return false
+		}
+	}
+}
+
+// Cancels a consumer and requeues the deliveries received
+// before the broker confirmed the cancellation
+func cancelConsumer(ch *amqp.Channel, deliveries <-chan amqp.Delivery, tag string) {
+	if err := ch.Cancel(tag, false); err != nil {
+		return
+	}
+
+	for d := range deliveries {
+		d.Nack(false, true)
+	}
+}
+
+// Declares a durable queue, queues are declared again after a reconnection
+func (b *AMQPBroker) DeclareQueue(name string, args map[string]interface{}) error {
+	ch, err := b.channel(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDeclare(name, true, false, false, false, amqp.Table(args)); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.queues[name] = amqp.Table(args)
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Declares an exclusive auto-deleted queue, declared again
+// after a reconnection
+func (b *AMQPBroker) DeclareExclusiveQueue(name string, args map[string]interface{}) error {
+	ch, err := b.channel(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDeclare(name, false, true, true, false, amqp.Table(args)); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.queues[name] = amqp.Table(args)
+	b.exclusive[name] = true
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Declares a durable exchange of the given kind (direct, topic, fanout),
+// exchanges are declared again after a reconnection
+func (b *AMQPBroker) DeclareExchange(name, kind string) error {
+	return b.declareExchange(name, kind, nil)
+}
+
+// Declares a durable RabbitMQ delayed message exchange routing
+// messages of the given kind (direct, topic, fanout) once their
+// x-delay header elapsed, requires the rabbitmq_delayed_message_exchange plugin
+func (b *AMQPBroker) DeclareDelayedExchange(name, kind string) error {
+	return b.declareExchange(name, "x-delayed-message", amqp.Table{"x-delayed-type": kind})
+}
+
+func (b *AMQPBroker) declareExchange(name, kind string, args amqp.Table) error {
+	ch, err := b.channel(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if err := ch.ExchangeDeclare(name, kind, true, false, false, false, args); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.exchanges[name] = amqpExchange{kind: kind, args: args}
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Sets the basic.qos prefetch count of the channel, the consumers
+// started afterwards get at most prefetch unacknowledged messages,
+// shared between the consumers of the channel when global,
+// the setting is applied again after a reconnection
+func (b *AMQPBroker) Qos(prefetch int, global bool) error {
+	ch, err := b.channel(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if err := ch.Qos(prefetch, 0, global); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.qos = &amqpQos{prefetch: prefetch, global: global}
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Binds queue to exchange with key,
+// bindings are declared again after a reconnection
+func (b *AMQPBroker) BindQueue(queue, exchange, key string) error {
+	ch, err := b.channel(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if err := ch.QueueBind(queue, key, exchange, false, nil); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.bindings[amqpBinding{queue: queue, exchange: exchange, key: key}] = true
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Closes the AMQP channel, and the connection when owned by the broker
+func (b *AMQPBroker) Close() error {
+	b.once.Do(func() { close(b.done) })
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	err := b.ch.Close()
+
+	if b.conn != nil {
+		if cerr := b.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
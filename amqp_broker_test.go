@@ -0,0 +1,78 @@
+package celery
+
+import (
+	"github.com/streadway/amqp"
+	"reflect"
+	"testing"
+)
+
+type deliveryRecorder struct {
+	acked, nacked, rejected, multiple, requeued bool
+}
+
+func (a *deliveryRecorder) Ack(tag uint64, multiple bool) error {
+	a.acked, a.multiple = true, multiple
+	return nil
+}
+
+func (a *deliveryRecorder) Nack(tag uint64, multiple, requeue bool) error {
+	a.nacked, a.multiple, a.requeued = true, multiple, requeue
+	return nil
+}
+
+func (a *deliveryRecorder) Reject(tag uint64, requeue bool) error {
+	a.rejected, a.requeued = true, requeue
+	return nil
+}
+
+func TestAMQPMessageConversion(t *testing.T) {
+	x, err := NewTask("task name", []string{"1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := x.message(ProtocolV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := publishing(msg)
+	if p.DeliveryMode != amqp.Persistent || p.CorrelationId != x.Id || p.ContentType != "application/json" {
+		t.Fail()
+	}
+
+	ack := &deliveryRecorder{}
+	d := delivered(amqp.Delivery{
+		Acknowledger:  ack,
+		Headers:       p.Headers,
+		CorrelationId: p.CorrelationId,
+		RoutingKey:    "celery",
+		Body:          p.Body,
+	})
+
+	if !reflect.DeepEqual(d.Headers, msg.Headers) || !reflect.DeepEqual(d.Body, msg.Body) || d.RoutingKey != "celery" {
+		t.Fail()
+	}
+
+	d.Nack(true)
+	if !ack.nacked || ack.multiple || !ack.requeued {
+		t.Fail()
+	}
+}
+
+func TestConsumerTag(t *testing.T) {
+	b := newAMQPBroker("")
+
+	if b.consumerTag() != anonNodeName()+".1" || b.consumerTag() != anonNodeName()+".2" {
+		t.Fail()
+	}
+
+	b.ConsumerTagPrefix = "worker1@host-"
+	if b.consumerTag() != "worker1@host-3" {
+		t.Fail()
+	}
+
+	if b.Cancel("worker1@host-3") != errUnknownConsumer || len(b.Consumers()) != 0 {
+		t.Fail()
+	}
+}
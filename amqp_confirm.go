@@ -0,0 +1,246 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/streadway/amqp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultConfirmTimeout = 30 * time.Second
+
+// Error returned for a message the broker did not accept in confirm mode,
+// or returned as unroutable when published as mandatory
+type PublishError struct {
+	Exchange   string
+	RoutingKey string
+	Reason     string
+	Body       []byte
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("publish to %q with key %q failed: %s", e.Exchange, e.RoutingKey, e.Reason)
+}
+
+// Tracks the confirmations of the messages published on a channel,
+// messages are published as mandatory and tagged with their delivery tag
+// as message id, so returned messages can be matched to their publish,
+// publishMu orders the publishes by tag, mu guards the pending and
+// returned messages, dispatch never waits for a publish as the
+// connection stops reading while a publish holds up its confirmation
+type confirmer struct {
+	publishMu sync.Mutex
+	tag       uint64
+
+	mu       sync.Mutex
+	pending  map[uint64]chan error
+	returned map[uint64]amqp.Return
+}
+
+// Puts ch in confirm mode and starts dispatching its confirmations
+func newConfirmer(ch *amqp.Channel) (*confirmer, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+
+	c := &confirmer{
+		pending:  make(map[uint64]chan error),
+		returned: make(map[uint64]amqp.Return),
+	}
+
+	go c.dispatch(
+		ch.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		ch.NotifyReturn(make(chan amqp.Return, 1)),
+	)
+
+	return c, nil
+}
+
+// Publishes a message and returns the channel its confirmation is sent to
+func (c *confirmer) publish(ch *amqp.Channel, exchange, key string, msg amqp.Publishing) (<-chan error, error) {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+
+	tag := c.tag + 1
+	msg.MessageId = strconv.FormatUint(tag, 10)
+
+	// registered before publishing, the confirmation may arrive first
+	confirmed := make(chan error, 1)
+
+	c.mu.Lock()
+	c.pending[tag] = confirmed
+	c.mu.Unlock()
+
+	if err := ch.Publish(exchange, key, true, false, msg); err != nil {
+		c.mu.Lock()
+		delete(c.pending, tag)
+		c.mu.Unlock()
+
+		return nil, err
+	}
+
+	c.tag = tag
+
+	return confirmed, nil
+}
+
+// Records a returned message under its delivery tag
+func (c *confirmer) returnMessage(r amqp.Return) {
+	tag, err := strconv.ParseUint(r.MessageId, 10, 64)
+	if err != nil {
+		return
+	}
+
+	c.returned[tag] = r
+}
+
+// Delivers confirmations to the waiting publishers until the channel closes,
+// a returned message is always notified before its confirmation
+func (c *confirmer) dispatch(confirmations <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case r := <-returns:
+			c.mu.Lock()
+			c.returnMessage(r)
+			c.mu.Unlock()
+
+		case conf, ok := <-confirmations:
+			c.mu.Lock()
+
+			if !ok {
+				for tag, confirmed := range c.pending {
+					confirmed <- amqp.ErrClosed
+					delete(c.pending, tag)
+				}
+
+				c.mu.Unlock()
+				return
+			}
+
+		drain:
+			for {
+				select {
+				case r := <-returns:
+					c.returnMessage(r)
+				default:
+					break drain
+				}
+			}
+
+			var err error
+
+			if r, ok := c.returned[conf.DeliveryTag]; ok {
+				err = &PublishError{Exchange: r.Exchange, RoutingKey: r.RoutingKey, Reason: r.ReplyText, Body: r.Body}
+				delete(c.returned, conf.DeliveryTag)
+			} else if !conf.Ack {
+				err = errors.New("publish nacked by the broker")
+			}
+
+			if confirmed, ok := c.pending[conf.DeliveryTag]; ok {
+				confirmed <- err
+				delete(c.pending, conf.DeliveryTag)
+			}
+
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Puts the broker channel in confirm mode, Publish then blocks until
+// the broker confirms each message or ConfirmTimeout elapses,
+// messages are published as mandatory and unroutable ones are
+// returned and reported as a *PublishError,
+// confirm mode is enabled again on the channels opened after a reconnection
+func (b *AMQPBroker) Confirm() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, err := newConfirmer(b.ch)
+	if err != nil {
+		return err
+	}
+
+	b.confirmer = c
+
+	if b.pool != nil {
+		b.pool.close()
+		b.pool = nil
+	}
+
+	return nil
+}
+
+// Registers c to receive the mandatory messages returned by the broker
+// outside confirm mode, where Publish cannot wait for them, and returns
+// it, returns are dropped when c is not ready to receive them
+func (b *AMQPBroker) NotifyReturn(c chan *PublishError) chan *PublishError {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.returns = append(b.returns, c)
+
+	if len(b.returns) == 1 && b.ch != nil {
+		go b.forwardReturns(b.ch.NotifyReturn(make(chan amqp.Return, 1)))
+	}
+
+	return c
+}
+
+// Hands the messages returned on a channel to the NotifyReturn
+// receivers until the channel closes
+func (b *AMQPBroker) forwardReturns(returns <-chan amqp.Return) {
+	for r := range returns {
+		b.mu.RLock()
+
+		if b.confirmer == nil {
+			err := &PublishError{Exchange: r.Exchange, RoutingKey: r.RoutingKey, Reason: r.ReplyText, Body: r.Body}
+
+			for _, c := range b.returns {
+				select {
+				case c <- err:
+				default:
+					loggerOr(b.Logger).Warn("Dropped returned message", "exchange", r.Exchange, "key", r.RoutingKey)
+				}
+			}
+		}
+
+		b.mu.RUnlock()
+	}
+}
+
+// Publish a message to exchange with routing key,
+// in confirm mode waits for the confirmation until ctx is done
+func (b *AMQPBroker) PublishContext(ctx context.Context, exchange, key string, msg *Message) error {
+	if pool := b.channelPool(); pool != nil {
+		return b.publishPooled(ctx, pool, exchange, key, msg)
+	}
+
+	b.mu.RLock()
+	ch, c := b.ch, b.confirmer
+	b.mu.RUnlock()
+
+	return publishOn(ctx, ch, c, exchange, key, msg)
+}
+
+// Publishes a message on ch, waits for its confirmation until ctx is
+// done when c is set
+func publishOn(ctx context.Context, ch *amqp.Channel, c *confirmer, exchange, key string, msg *Message) error {
+	if c == nil {
+		return ch.Publish(exchange, key, msg.Mandatory, false, publishing(msg))
+	}
+
+	confirmed, err := c.publish(ch, exchange, key, publishing(msg))
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-confirmed:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,101 @@
+package celery
+
+import (
+	"github.com/streadway/amqp"
+	"testing"
+)
+
+func TestConfirmerDispatch(t *testing.T) {
+	c := &confirmer{
+		pending:  make(map[uint64]chan error),
+		returned: make(map[uint64]amqp.Return),
+	}
+
+	first, second, third := make(chan error, 1), make(chan error, 1), make(chan error, 1)
+	c.pending[1], c.pending[2], c.pending[3] = first, second, third
+
+	confirmations := make(chan amqp.Confirmation, 3)
+	returns := make(chan amqp.Return, 1)
+
+	returns <- amqp.Return{MessageId: "2", ReplyText: "NO_ROUTE", RoutingKey: "missing"}
+	confirmations <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	confirmations <- amqp.Confirmation{DeliveryTag: 2, Ack: true}
+	close(confirmations)
+
+	c.dispatch(confirmations, returns)
+
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+
+	err, ok := (<-second).(*PublishError)
+	if !ok || err.Reason != "NO_ROUTE" || err.RoutingKey != "missing" {
+		t.Fatal(err)
+	}
+
+	if err := <-third; err != amqp.ErrClosed {
+		t.Fatal(err)
+	}
+
+	if len(c.pending) != 0 || len(c.returned) != 0 {
+		t.Fail()
+	}
+}
+
+func TestConfirmerNack(t *testing.T) {
+	c := &confirmer{
+		pending:  map[uint64]chan error{1: make(chan error, 1)},
+		returned: make(map[uint64]amqp.Return),
+	}
+
+	confirmed := c.pending[1]
+
+	confirmations := make(chan amqp.Confirmation, 1)
+	confirmations <- amqp.Confirmation{DeliveryTag: 1, Ack: false}
+	close(confirmations)
+
+	c.dispatch(confirmations, make(chan amqp.Return))
+
+	if err := <-confirmed; err == nil {
+		t.Fail()
+	}
+}
+
+func TestConfirmerDispatchDuringPublish(t *testing.T) {
+	c := &confirmer{
+		pending:  map[uint64]chan error{1: make(chan error, 1)},
+		returned: make(map[uint64]amqp.Return),
+	}
+
+	confirmed := c.pending[1]
+
+	// a publish blocked in the client library waits for dispatch
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+
+	confirmations := make(chan amqp.Confirmation)
+	go c.dispatch(confirmations, make(chan amqp.Return))
+
+	confirmations <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	close(confirmations)
+
+	if err := <-confirmed; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForwardReturns(t *testing.T) {
+	b := newAMQPBroker("")
+	returned := b.NotifyReturn(make(chan *PublishError, 1))
+
+	returns := make(chan amqp.Return, 2)
+	returns <- amqp.Return{Exchange: "tasks", RoutingKey: "nowhere", ReplyText: "NO_ROUTE", Body: []byte("body")}
+	returns <- amqp.Return{Exchange: "tasks", RoutingKey: "dropped"}
+	close(returns)
+
+	b.forwardReturns(returns)
+
+	if err := <-returned; err.RoutingKey != "nowhere" || err.Reason != "NO_ROUTE" || string(err.Body) != "body" {
+		t.Errorf("returned %+v", err)
+	}
+}
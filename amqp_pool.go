@@ -0,0 +1,163 @@
+package celery
+
+import (
+	"context"
+	"github.com/streadway/amqp"
+)
+
+// Channel checked out of a channel pool, broken once closed
+type pooledChannel struct {
+	ch        *amqp.Channel
+	confirmer *confirmer
+	closed    chan *amqp.Error
+}
+
+// Pool of the channels the publishes of a connection are spread over,
+// at most size channels are checked out at a time, broken channels
+// are dropped and replaced by new ones
+type channelPool struct {
+	conn    *amqp.Connection
+	confirm bool
+	opened  func(*amqp.Channel)
+
+	slots chan struct{}
+	idle  chan *pooledChannel
+}
+
+// Returns a pointer to a new pool of size channels on conn, in confirm
+// mode when confirm is set, opened is called with every new channel
+func newChannelPool(conn *amqp.Connection, size int, confirm bool, opened func(*amqp.Channel)) *channelPool {
+	return &channelPool{
+		conn:    conn,
+		confirm: confirm,
+		opened:  opened,
+		slots:   make(chan struct{}, size),
+		idle:    make(chan *pooledChannel, size),
+	}
+}
+
+// Returns whether the channel was closed
+func (c *pooledChannel) broken() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Checks out an idle channel, or opens one, waits for a channel
+// to be returned when size are checked out until ctx is done
+func (p *channelPool) get(ctx context.Context) (*pooledChannel, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		select {
+		case c := <-p.idle:
+			if c.broken() {
+				continue
+			}
+
+			return c, nil
+		default:
+		}
+
+		c, err := p.open()
+		if err != nil {
+			<-p.slots
+		}
+
+		return c, err
+	}
+}
+
+// Returns a checked out channel to the pool, broken ones are dropped
+func (p *channelPool) put(c *pooledChannel) {
+	if !c.broken() {
+		p.idle <- c
+	}
+
+	<-p.slots
+}
+
+// Closes the idle channels of the pool
+func (p *channelPool) close() {
+	for {
+		select {
+		case c := <-p.idle:
+			c.ch.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Opens a channel of the pool
+func (p *channelPool) open() (*pooledChannel, error) {
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &pooledChannel{ch: ch, closed: ch.NotifyClose(make(chan *amqp.Error, 1))}
+
+	if p.confirm {
+		if c.confirmer, err = newConfirmer(ch); err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+
+	if p.opened != nil {
+		p.opened(ch)
+	}
+
+	return c, nil
+}
+
+// Returns the channel pool of the broker connection, nil for brokers
+// without a connection or publish channels
+func (b *AMQPBroker) channelPool() *channelPool {
+	b.mu.RLock()
+	pool := b.pool
+	b.mu.RUnlock()
+
+	if pool != nil {
+		return pool
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pool == nil && b.conn != nil && b.PublishChannels > 0 {
+		b.pool = newChannelPool(b.conn, b.PublishChannels, b.confirmer != nil, b.forwardPooled)
+	}
+
+	return b.pool
+}
+
+// Forwards the returns of a pooled channel to the NotifyReturn receivers
+func (b *AMQPBroker) forwardPooled(ch *amqp.Channel) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if len(b.returns) > 0 {
+		go b.forwardReturns(ch.NotifyReturn(make(chan amqp.Return, 1)))
+	}
+}
+
+// Publishes a message on a channel checked out of the pool
+func (b *AMQPBroker) publishPooled(ctx context.Context, pool *channelPool, exchange, key string, msg *Message) error {
+	c, err := pool.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer pool.put(c)
+
+	return publishOn(ctx, c.ch, c.confirmer, exchange, key, msg)
+}
@@ -0,0 +1,38 @@
+package celery
+
+import (
+	"context"
+	"github.com/streadway/amqp"
+	"testing"
+	"time"
+)
+
+func TestChannelPool(t *testing.T) {
+	p := newChannelPool(nil, 1, false, nil)
+	p.idle = make(chan *pooledChannel, 2)
+
+	broken := &pooledChannel{closed: make(chan *amqp.Error)}
+	close(broken.closed)
+	healthy := &pooledChannel{closed: make(chan *amqp.Error)}
+
+	p.idle <- broken
+	p.idle <- healthy
+
+	c, err := p.get(context.Background())
+	if err != nil || c != healthy {
+		t.Fatalf("checked out %+v: %v", c, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.get(ctx); err != context.DeadlineExceeded {
+		t.Errorf("checked out past the pool size: %v", err)
+	}
+
+	p.put(c)
+
+	if c, err := p.get(context.Background()); err != nil || c != healthy {
+		t.Errorf("checked out %+v: %v", c, err)
+	}
+}
@@ -0,0 +1,150 @@
+package celery
+
+import (
+	"io"
+	"time"
+)
+
+// Celery app of a Go service, the broker, result backend, publisher
+// and workers set up from a Config,
+// Config - the configuration of the app,
+// Broker - broker dialed from the broker URL,
+// Backend - result backend dialed from the result backend URL,
+// nil without one,
+// Publisher - publisher of the app tasks, tasks without a route are
+// published to the default queue
+type App struct {
+	Config    *Config
+	Broker    Broker
+	Backend   ResultBackend
+	Publisher *Publisher
+}
+
+// Returns a pointer to a new app dialing the broker and result backend
+// of c
+func NewApp(c *Config) (*App, error) {
+	b, err := DialBrokerWithOptions(c.BrokerURL, c.TransportOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyTransportOptions(b, c.TransportOptions); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	a := &App{Config: c, Broker: b}
+
+	if c.ResultBackend != "" {
+		if a.Backend, err = DialBackendWithOptions(c.ResultBackend, c.BackendTransportOptions); err != nil {
+			b.Close()
+			return nil, err
+		}
+
+		if eb, ok := a.Backend.(ExpiringBackend); ok {
+			eb.SetExpires(c.ResultExpires)
+		}
+	}
+
+	a.Publisher = NewPublisher(b)
+	a.Publisher.Protocol = c.Protocol
+	a.Publisher.Serializer = c.Serializer
+	a.Publisher.Compression = c.Compression
+	a.Publisher.Router = &defaultRouter{next: c.Routes, route: c.defaultRoute()}
+
+	return a, nil
+}
+
+// Applies the transport options the broker supports
+func applyTransportOptions(b Broker, opts map[string]interface{}) error {
+	ab, ok := b.(*AMQPBroker)
+	if !ok {
+		return nil
+	}
+
+	switch secs := opts["confirm_timeout"].(type) {
+	case int:
+		ab.ConfirmTimeout = time.Duration(secs) * time.Second
+	case float64:
+		ab.ConfirmTimeout = time.Duration(secs * float64(time.Second))
+	}
+
+	if confirm, _ := opts["confirm_publish"].(bool); confirm {
+		return ab.Confirm()
+	}
+
+	return nil
+}
+
+// Returns a pointer to a new worker consuming the default queue,
+// bound to the default exchange with the default routing key,
+// configured with the app settings and storing results
+// in the app backend
+func (a *App) Worker() *Worker {
+	c := a.Config
+
+	w := NewWorker(a.Broker, c.DefaultQueue, c.DefaultExchange, c.routingKey())
+	w.PrefetchMultiplier = c.PrefetchMultiplier
+	w.SoftTimeLimit = c.SoftTimeLimit
+	w.TimeLimit = c.TimeLimit
+	w.Backend = a.Backend
+
+	if c.Concurrency > 0 {
+		w.Concurrency = c.Concurrency
+	}
+
+	return w
+}
+
+// Returns the result of the task with id from the app backend
+func (a *App) AsyncResult(id string) *AsyncResult {
+	return NewAsyncResult(id, a.Backend)
+}
+
+// Closes the broker, and the backend when it can be closed
+func (a *App) Close() error {
+	err := a.Broker.Close()
+
+	if c, ok := a.Backend.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Returns the routing key of the tasks without a route
+func (c *Config) routingKey() string {
+	if c.DefaultRoutingKey != "" {
+		return c.DefaultRoutingKey
+	}
+
+	return c.DefaultQueue
+}
+
+// Returns the route of the tasks without one
+func (c *Config) defaultRoute() Route {
+	if c.DefaultExchange == "" {
+		return Route{Queue: c.DefaultQueue}
+	}
+
+	return Route{Exchange: c.DefaultExchange, RoutingKey: c.routingKey()}
+}
+
+// Router of an app publisher, tasks not routed by next
+// take the default route
+type defaultRouter struct {
+	next  Router
+	route Route
+}
+
+func (r *defaultRouter) Route(task string) (*Route, bool) {
+	if r.next != nil {
+		if route, ok := r.next.Route(task); ok {
+			return route, true
+		}
+	}
+
+	return &r.route, true
+}
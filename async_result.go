@@ -0,0 +1,148 @@
+package celery
+
+import (
+	"context"
+	"fmt"
+	"github.com/streadway/amqp"
+	"time"
+)
+
+const defaultPollInterval = 500 * time.Millisecond
+
+// Pending result of a published task,
+// Id - task UUID,
+// Interval - time between backend polls while waiting for the result
+type AsyncResult struct {
+	Id       string
+	Interval time.Duration
+
+	backend ResultBackend
+	meta    *ResultMeta
+}
+
+// Error returned for a task that failed or was revoked,
+// Type - exception class name,
+// Message - exception message,
+// Traceback - optional remote traceback
+type TaskError struct {
+	Id        string
+	State     string
+	Type      string
+	Message   string
+	Traceback string
+}
+
+func (e *TaskError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("task %s %s", e.Id, e.State)
+	}
+
+	return fmt.Sprintf("task %s %s: %s: %s", e.Id, e.State, e.Type, e.Message)
+}
+
+// Returns a pointer to a new result for task id stored in backend
+func NewAsyncResult(id string, backend ResultBackend) *AsyncResult {
+	return &AsyncResult{
+		Id:       id,
+		Interval: defaultPollInterval,
+		backend:  backend,
+	}
+}
+
+// Publish a task using protocol v1 and return its pending result
+func (t *Task) PublishWithResult(ch *amqp.Channel, exchange, key string, backend ResultBackend) (*AsyncResult, error) {
+	p := &Publisher{broker: NewAMQPBroker(ch), Protocol: ProtocolV1}
+	return p.PublishWithResult(t, exchange, key, backend)
+}
+
+// Returns the current result meta, results are cached once ready
+func (r *AsyncResult) fetch() (*ResultMeta, error) {
+	if r.meta != nil {
+		return r.meta, nil
+	}
+
+	meta, err := r.backend.Get(r.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.Ready() {
+		r.meta = meta
+	}
+
+	return meta, nil
+}
+
+// Returns the current task state
+func (r *AsyncResult) State() (string, error) {
+	meta, err := r.fetch()
+	if err != nil {
+		return "", err
+	}
+
+	return meta.Status, nil
+}
+
+// Returns true when the task has finished executing
+func (r *AsyncResult) Ready() (bool, error) {
+	meta, err := r.fetch()
+	if err != nil {
+		return false, err
+	}
+
+	return meta.Ready(), nil
+}
+
+// Waits for the task to finish and returns its result,
+// a failed or revoked task returns a *TaskError,
+// waiting stops when ctx is done
+func (r *AsyncResult) Get(ctx context.Context) (interface{}, error) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		meta, err := r.fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		if meta.Ready() {
+			return resultValue(meta)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns the value of a ready result, or the error it carries
+func resultValue(meta *ResultMeta) (interface{}, error) {
+	if meta.Status == StateSuccess {
+		return meta.Result, nil
+	}
+
+	err := &TaskError{
+		Id:        meta.TaskId,
+		State:     meta.Status,
+		Traceback: meta.Traceback,
+	}
+
+	if exc, ok := meta.Result.(map[string]interface{}); ok {
+		err.Type, _ = exc["exc_type"].(string)
+		err.Message = fmt.Sprint(exc["exc_message"])
+
+		if msg, ok := exc["exc_message"].([]interface{}); ok && len(msg) == 1 {
+			err.Message = fmt.Sprint(msg[0])
+		}
+	}
+
+	return nil, err
+}
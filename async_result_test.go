@@ -0,0 +1,99 @@
+package celery
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryResults struct {
+	mu      sync.Mutex
+	results map[string]*ResultMeta
+}
+
+func (b *memoryResults) Store(meta *ResultMeta) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.results[meta.TaskId] = meta
+	return nil
+}
+
+func (b *memoryResults) Get(id string) (*ResultMeta, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if meta, ok := b.results[id]; ok {
+		return meta, nil
+	}
+
+	return &ResultMeta{TaskId: id, Status: StatePending}, nil
+}
+
+func (b *memoryResults) Forget(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.results, id)
+	return nil
+}
+
+func TestAsyncResultGet(t *testing.T) {
+	backend := &memoryResults{results: make(map[string]*ResultMeta)}
+
+	r := NewAsyncResult("123abc", backend)
+	r.Interval = time.Millisecond
+
+	if ready, err := r.Ready(); err != nil || ready {
+		t.Fail()
+	}
+
+	if state, err := r.State(); err != nil || state != StatePending {
+		t.Fail()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.Get(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		backend.Store(&ResultMeta{TaskId: "123abc", Status: StateSuccess, Result: 3.0})
+	}()
+
+	result, err := r.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != 3.0 {
+		t.Fail()
+	}
+}
+
+func TestAsyncResultGetFailure(t *testing.T) {
+	backend := &memoryResults{results: make(map[string]*ResultMeta)}
+	backend.Store(&ResultMeta{
+		TaskId: "123abc",
+		Status: StateFailure,
+		Result: map[string]interface{}{
+			"exc_type":    "ValueError",
+			"exc_message": []interface{}{"bad value"},
+		},
+	})
+
+	_, err := NewAsyncResult("123abc", backend).Get(context.Background())
+
+	taskErr, ok := err.(*TaskError)
+	if !ok {
+		t.Fatal(err)
+	}
+
+	if taskErr.Type != "ValueError" || taskErr.Message != "bad value" {
+		t.Fail()
+	}
+}
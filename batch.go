@@ -0,0 +1,185 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"github.com/streadway/amqp"
+)
+
+// Error of the batches published by brokers unable to publish them atomically
+var ErrBatchUnsupported = errors.New("batches need a broker connection")
+
+// Message of a batch and its destination
+type BatchMessage struct {
+	Exchange   string
+	RoutingKey string
+	Message    *Message
+}
+
+// Broker publishing batches of messages atomically,
+// PublishBatch - publishes all the messages or none
+type BatchBroker interface {
+	Broker
+	PublishBatch(ctx context.Context, batch []BatchMessage) error
+}
+
+// Publishes a batch with b, brokers without batches publish
+// the messages one by one until one fails
+func publishBatch(ctx context.Context, b Broker, batch []BatchMessage) error {
+	if bb, ok := b.(BatchBroker); ok {
+		return bb.PublishBatch(ctx, batch)
+	}
+
+	for _, m := range batch {
+		if err := publishContext(ctx, b, m.Exchange, m.RoutingKey, m.Message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Publishes tasks together with the same options, AMQP and Redis
+// brokers publish all of them or none, AMQP brokers need a connection,
+// the publisher retry policy does not apply to batches
+func (p *Publisher) PublishBatch(tasks []*Task, opts ...PublishOption) error {
+	return p.PublishBatchContext(context.Background(), tasks, opts...)
+}
+
+// Same as PublishBatch, gives up when ctx is done
+func (p *Publisher) PublishBatchContext(ctx context.Context, tasks []*Task, opts ...PublishOption) error {
+	batch := make([]BatchMessage, 0, len(tasks))
+	finishes := make([]func(error), 0, len(tasks))
+
+	done := func(err error) {
+		for _, finish := range finishes {
+			finish(err)
+		}
+	}
+
+	for _, t := range tasks {
+		o := p.options(t, opts)
+
+		_, msg, finish, err := p.prepare(ctx, o)
+		if err != nil {
+			done(err)
+			return err
+		}
+
+		batch = append(batch, BatchMessage{Exchange: o.exchange, RoutingKey: o.key, Message: msg})
+		finishes = append(finishes, finish)
+	}
+
+	err := publishBatch(ctx, p.broker, batch)
+	done(err)
+
+	return err
+}
+
+// Publishes a batch in a transaction on a dedicated channel, brokers
+// created from a channel without a connection cannot publish batches
+// atomically and return ErrBatchUnsupported
+func (b *AMQPBroker) PublishBatch(ctx context.Context, batch []BatchMessage) error {
+	b.mu.RLock()
+	conn := b.conn
+	b.mu.RUnlock()
+
+	if conn == nil {
+		return ErrBatchUnsupported
+	}
+
+	return publishTx(ctx, conn, batch)
+}
+
+// Publishes a batch in an AMQP transaction, rolled back on failure,
+// once ctx is done or when the broker returns an unroutable mandatory
+// message before the commit, reported as a *PublishError, RabbitMQ
+// routes transactions on commit and returns their unroutable messages
+// then, they are reported once the rest of the batch is committed
+func publishTx(ctx context.Context, conn *amqp.Connection, batch []BatchMessage) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	defer ch.Close()
+
+	// the channel must hold every return not to stall the connection
+	returns := ch.NotifyReturn(make(chan amqp.Return, len(batch)))
+
+	if err := ch.Tx(); err != nil {
+		return err
+	}
+
+	for _, m := range batch {
+		if err := ctx.Err(); err != nil {
+			ch.TxRollback()
+			return err
+		}
+
+		if err := ch.Publish(m.Exchange, m.RoutingKey, m.Message.Mandatory, false, publishing(m.Message)); err != nil {
+			ch.TxRollback()
+			return err
+		}
+	}
+
+	// the broker sends the returns of the batch before replying to
+	// a later synchronous method, a no-op qos on this publish channel
+	if err := ch.Qos(0, 0, false); err != nil {
+		return err
+	}
+
+	select {
+	case r := <-returns:
+		ch.TxRollback()
+		return &PublishError{Exchange: r.Exchange, RoutingKey: r.RoutingKey, Reason: r.ReplyText, Body: r.Body}
+	default:
+	}
+
+	if err := ch.TxCommit(); err != nil {
+		return err
+	}
+
+	select {
+	case r := <-returns:
+		return &PublishError{Exchange: r.Exchange, RoutingKey: r.RoutingKey, Reason: r.ReplyText, Body: r.Body}
+	default:
+		return nil
+	}
+}
+
+// Pushes a batch in a MULTI/EXEC transaction
+func (b *RedisBroker) PublishBatch(ctx context.Context, batch []BatchMessage) error {
+	pipe := b.client.TxPipeline()
+
+	pushes := 0
+
+	for _, m := range batch {
+		queues, err := b.lookup(m.Exchange, m.RoutingKey)
+		if err != nil {
+			return err
+		}
+
+		if len(queues) == 0 && m.Message.Mandatory {
+			return unroutable(m.Exchange, m.RoutingKey, m.Message)
+		}
+
+		payload, err := encodeEnvelope(m.Exchange, m.RoutingKey, m.Message)
+		if err != nil {
+			return err
+		}
+
+		for _, queue := range queues {
+			pipe.LPush(priorityKey(queue, m.Message.Priority), payload)
+			pushes++
+		}
+	}
+
+	if err := ctx.Err(); err != nil || pushes == 0 {
+		return err
+	}
+
+	_, err := pipe.Exec()
+
+	return err
+}
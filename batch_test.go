@@ -0,0 +1,60 @@
+package celery
+
+import (
+	"testing"
+)
+
+func TestPublishBatch(t *testing.T) {
+	b := &routedBroker{}
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	y, _ := NewTask("tasks.mul", nil, nil)
+
+	if err := NewPublisher(b).PublishBatch([]*Task{x, y}, WithQueue("math")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.messages) != 2 || b.messages[1].Headers["task"] != "tasks.mul" || b.keys[1] != "math" {
+		t.Errorf("published %v to %v", b.messages, b.keys)
+	}
+}
+
+func TestAMQPPublishBatchWithoutConnection(t *testing.T) {
+	b := NewAMQPBroker(nil)
+
+	x, _ := NewTask("tasks.add", nil, nil)
+
+	if err := NewPublisher(b).PublishBatch([]*Task{x}); err != ErrBatchUnsupported {
+		t.Errorf("batch without a connection %v", err)
+	}
+}
+
+func TestRedisPublishBatch(t *testing.T) {
+	_, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	var tasks []*Task
+	for i := 0; i < 3; i++ {
+		x, _ := NewTask("tasks.add", nil, nil)
+		tasks = append(tasks, x)
+	}
+
+	if err := NewPublisher(b).PublishBatch(tasks); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := client.LLen("celery").Val(); n != 3 {
+		t.Errorf("pushed %d messages", n)
+	}
+
+	messages, err := b.Consume("celery", "", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := DecodeTask(receive(t, messages))
+	if err != nil || task.Id != tasks[0].Id {
+		t.Errorf("received %v: %v", task, err)
+	}
+}
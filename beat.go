@@ -0,0 +1,303 @@
+package celery
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Celery's default beat_max_loop_interval
+const defaultBeatMaxInterval = 5 * time.Minute
+
+// Schedule of a periodic task,
+// Next - returns the first run time after last, the zero time
+// when there is none
+type Schedule interface {
+	Next(last time.Time) time.Time
+}
+
+// Schedule running a task every interval, the same as Celery's schedule
+type Interval time.Duration
+
+// Returns an interval schedule of d
+func Every(d time.Duration) Interval {
+	return Interval(d)
+}
+
+// Returns the time an interval after last
+func (i Interval) Next(last time.Time) time.Time {
+	return last.Add(time.Duration(i))
+}
+
+// Periodic task, the same as a beat_schedule entry,
+// Name - unique name of the entry,
+// Task - name of the published task,
+// Args, KWArgs - optional arguments of the published tasks,
+// Schedule - run times of the task,
+// Options - optional ApplyAsync options of the published tasks
+type ScheduleEntry struct {
+	Name     string
+	Task     string
+	Args     []interface{}
+	KWArgs   map[string]interface{}
+	Schedule Schedule
+	Options  []PublishOption
+}
+
+// Scheduled entry and its run times
+type beatEntry struct {
+	*ScheduleEntry
+	last time.Time
+	next time.Time
+}
+
+// Periodic task scheduler, the same as celery beat,
+// publishes the scheduled tasks when they are due,
+// MaxInterval - longest time between two schedule checks,
+// 5 minutes by default,
+// Lock - optional lock of the replicas, only the scheduler holding it
+// publishes, the others keep their schedules without publishing,
+// LockTTL - validity of the lock, renewed every third of it,
+// 30 seconds by default,
+// Store - optional storage of the last run times, restarted schedulers
+// resume the stored schedules and run the missed entries once,
+// Logger - optional logger, the package one by default
+type Beat struct {
+	MaxInterval time.Duration
+	Lock        BeatLock
+	LockTTL     time.Duration
+	Store       BeatStore
+	Logger      Logger
+
+	publisher *Publisher
+
+	// entries may change while running, the loop is woken up
+	// to reconsider its next run
+	mu      sync.Mutex
+	entries map[string]*beatEntry
+	running bool
+	runs    map[string]time.Time
+	wake    chan struct{}
+}
+
+// Returns a pointer to a new scheduler publishing with p
+func NewBeat(p *Publisher) *Beat {
+	return &Beat{
+		MaxInterval: defaultBeatMaxInterval,
+		publisher:   p,
+		entries:     make(map[string]*beatEntry),
+		runs:        make(map[string]time.Time),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Schedules a copy of an entry, its first run is one schedule period
+// after its stored last run or the time it is scheduled at,
+// adding the same name again updates the entry and keeps its last run,
+// entries may be added while the scheduler is running
+func (b *Beat) Add(entry *ScheduleEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	copied := *entry
+	e := &beatEntry{ScheduleEntry: &copied}
+
+	if old, ok := b.entries[entry.Name]; ok {
+		e.last = old.last
+	}
+
+	if b.running {
+		b.start(e, time.Now())
+	}
+
+	b.entries[entry.Name] = e
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Unschedules an entry and returns whether it was scheduled
+func (b *Beat) Remove(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := b.entries[name]
+	delete(b.entries, name)
+
+	return ok
+}
+
+// Returns copies of the scheduled entries sorted by name
+func (b *Beat) Entries() []ScheduleEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := make([]ScheduleEntry, 0, len(b.entries))
+	for _, e := range b.entries {
+		entries = append(entries, *e.ScheduleEntry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	return entries
+}
+
+// Computes the next run of an entry from its last one,
+// the stored one or now
+func (b *Beat) start(e *beatEntry, now time.Time) {
+	if e.last.IsZero() {
+		e.last = now
+
+		if last, ok := b.runs[e.Name]; ok {
+			e.last = last
+		}
+	}
+
+	e.next = e.Schedule.Next(e.last)
+}
+
+// Publishes the due tasks until ctx is done and returns ctx.Err(),
+// or the error of loading the stored schedule
+func (b *Beat) Run(ctx context.Context) error {
+	b.mu.Lock()
+	if b.Store != nil {
+		runs, err := b.Store.Load()
+		if err != nil {
+			b.mu.Unlock()
+			return err
+		}
+
+		b.runs = runs
+	}
+
+	now := time.Now()
+	for _, e := range b.entries {
+		b.start(e, now)
+	}
+
+	b.running = true
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.running = false
+		b.mu.Unlock()
+	}()
+
+	ttl := b.LockTTL
+	if ttl <= 0 {
+		ttl = defaultBeatLockTTL
+	}
+
+	for {
+		active := true
+
+		if b.Lock != nil {
+			held, err := b.Lock.Acquire(ttl)
+			if err != nil {
+				loggerOr(b.Logger).Error("Failed to acquire the beat lock", "error", err)
+			}
+
+			active = held && err == nil
+		}
+
+		wait := b.tick(ctx, time.Now(), active)
+		if b.Lock != nil && wait > ttl/3 {
+			wait = ttl / 3
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-b.wake:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+
+			if b.Lock != nil {
+				if err := b.Lock.Release(); err != nil {
+					loggerOr(b.Logger).Error("Failed to release the beat lock", "error", err)
+				}
+			}
+
+			return ctx.Err()
+		}
+	}
+}
+
+// Publishes the entries due at now when active and returns the time
+// until the next one is due, inactive schedulers only reschedule them
+func (b *Beat) tick(ctx context.Context, now time.Time, active bool) time.Duration {
+	b.mu.Lock()
+	var due []beatEntry
+
+	wait := b.MaxInterval
+	if wait <= 0 {
+		wait = defaultBeatMaxInterval
+	}
+
+	for _, e := range b.entries {
+		// schedules without further runs
+		if e.next.IsZero() {
+			continue
+		}
+
+		if !e.next.After(now) {
+			e.reschedule(now)
+			due = append(due, *e)
+		}
+
+		if d := e.next.Sub(now); !e.next.IsZero() && d < wait {
+			wait = d
+		}
+	}
+	b.mu.Unlock()
+
+	if !active {
+		return wait
+	}
+
+	for _, e := range due {
+		b.apply(ctx, e.ScheduleEntry)
+
+		if b.Store == nil {
+			continue
+		}
+
+		if err := b.Store.Save(e.Name, e.last); err != nil {
+			loggerOr(b.Logger).Error("Failed to save the last run", "entry", e.Name, "error", err)
+		}
+	}
+
+	return wait
+}
+
+// Moves an entry to its next run time, counted from the previous
+// one so delays do not accumulate, runs missed while the scheduler
+// was late are skipped
+func (e *beatEntry) reschedule(now time.Time) {
+	e.last = e.next
+	e.next = e.Schedule.Next(e.next)
+
+	if !e.next.After(now) {
+		e.last = now
+		e.next = e.Schedule.Next(now)
+	}
+}
+
+// Publishes the task of an entry
+func (b *Beat) apply(ctx context.Context, e *ScheduleEntry) {
+	task, err := NewTaskArgs(e.Task, e.Args, e.KWArgs)
+	if err != nil {
+		loggerOr(b.Logger).Error("Failed to create scheduled task", "entry", e.Name, "error", err)
+		return
+	}
+
+	if err := b.publisher.ApplyAsyncContext(ctx, task, e.Options...); err != nil {
+		loggerOr(b.Logger).Error("Failed to publish scheduled task", "entry", e.Name, "task", e.Task, "error", err)
+	}
+}
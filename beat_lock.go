@@ -0,0 +1,140 @@
+package celery
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/nu7hatch/gouuid"
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+// Default validity of the lock of the active scheduler
+const defaultBeatLockTTL = 30 * time.Second
+
+// Lock electing the active scheduler among replicas,
+// Acquire - takes or renews the lock for ttl and returns whether
+// it is held, a holder failing to renew it loses it after ttl,
+// Release - gives up the lock if held
+type BeatLock interface {
+	Acquire(ttl time.Duration) (bool, error)
+	Release() error
+}
+
+// Renews the key of a lock held with the token
+var redisRenewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// Deletes the key of a lock held with the token
+var redisReleaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// Lock stored in a Redis key expiring after the lock ttl
+type RedisLock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+}
+
+// Returns a pointer to a new lock of the Redis key
+func NewRedisLock(client redis.UniversalClient, key string) (*RedisLock, error) {
+	token, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisLock{client: client, key: key, token: token.String()}, nil
+}
+
+// Takes the lock when its key is free, renews it when held
+func (l *RedisLock) Acquire(ttl time.Duration) (bool, error) {
+	ok, err := l.client.SetNX(l.key, l.token, ttl).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+
+	renewed, err := redisRenewScript.Run(l.client, []string{l.key}, l.token, int64(ttl/time.Millisecond)).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	return renewed == 1, nil
+}
+
+// Deletes the lock key if held
+func (l *RedisLock) Release() error {
+	return redisReleaseScript.Run(l.client, []string{l.key}, l.token).Err()
+}
+
+// Lock held through an exclusive AMQP queue, RabbitMQ lets a single
+// connection declare it and deletes it when the connection closes,
+// the ttl is not used
+type AMQPLock struct {
+	conn  *amqp.Connection
+	queue string
+
+	mu sync.Mutex
+	ch *amqp.Channel
+}
+
+// Returns a pointer to a new lock of the exclusive queue
+func NewAMQPLock(conn *amqp.Connection, queue string) *AMQPLock {
+	return &AMQPLock{conn: conn, queue: queue}
+}
+
+// Declares the exclusive queue unless held, the declaration fails
+// while another connection holds it
+func (l *AMQPLock) Acquire(ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ch != nil {
+		if _, err := l.ch.QueueInspect(l.queue); err == nil {
+			return true, nil
+		}
+
+		l.ch.Close()
+		l.ch = nil
+	}
+
+	ch, err := l.conn.Channel()
+	if err != nil {
+		return false, err
+	}
+
+	// the broker closes the channel when the queue is locked
+	if _, err := ch.QueueDeclare(l.queue, false, false, true, false, nil); err != nil {
+		if e, ok := err.(*amqp.Error); ok && e.Code == amqp.ResourceLocked {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	l.ch = ch
+
+	return true, nil
+}
+
+// Deletes the exclusive queue if held
+func (l *AMQPLock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ch == nil {
+		return nil
+	}
+
+	defer func() { l.ch = nil }()
+
+	if _, err := l.ch.QueueDelete(l.queue, false, false, false); err != nil {
+		return err
+	}
+
+	return l.ch.Close()
+}
@@ -0,0 +1,134 @@
+package celery
+
+import (
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Storage of the schedule state, the same as celerybeat-schedule,
+// Load - returns the last run times by entry name,
+// Save - records the last run time of an entry
+type BeatStore interface {
+	Load() (map[string]time.Time, error)
+	Save(name string, last time.Time) error
+}
+
+// Schedule state stored in a JSON file
+type FileStore struct {
+	path string
+
+	mu   sync.Mutex
+	runs map[string]time.Time
+}
+
+// Returns a pointer to a new store of the file at path,
+// a missing file is an empty schedule state
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Reads the last run times from the file
+func (s *FileStore) Load() (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs = map[string]time.Time{}
+
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]time.Time{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &s.runs); err != nil {
+		return nil, err
+	}
+
+	runs := map[string]time.Time{}
+	for name, last := range s.runs {
+		runs[name] = last
+	}
+
+	return runs, nil
+}
+
+// Writes the last run times to the file, replacing it at once
+// so that a crash does not corrupt it
+func (s *FileStore) Save(name string, last time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.runs == nil {
+		s.runs = map[string]time.Time{}
+	}
+
+	s.runs[name] = last
+
+	b, err := json.Marshal(s.runs)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+// Schedule state stored in a Redis hash of the last run times
+type RedisStore struct {
+	client redis.UniversalClient
+	key    string
+}
+
+// Returns a pointer to a new store of the Redis hash key
+func NewRedisStore(client redis.UniversalClient, key string) *RedisStore {
+	return &RedisStore{client: client, key: key}
+}
+
+// Reads the last run times from the hash
+func (s *RedisStore) Load() (map[string]time.Time, error) {
+	fields, err := s.client.HGetAll(s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	runs := map[string]time.Time{}
+
+	for name, v := range fields {
+		last, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, err
+		}
+
+		runs[name] = last
+	}
+
+	return runs, nil
+}
+
+// Writes the last run time of an entry to the hash
+func (s *RedisStore) Save(name string, last time.Time) error {
+	return s.client.HSet(s.key, name, last.Format(time.RFC3339Nano)).Err()
+}
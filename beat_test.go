@@ -0,0 +1,202 @@
+package celery
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBeat(t *testing.T) {
+	b := &routedBroker{}
+
+	beat := NewBeat(NewPublisher(b))
+	beat.Add(&ScheduleEntry{
+		Name:     "cleanup",
+		Task:     "tasks.cleanup",
+		Schedule: Every(20 * time.Millisecond),
+		Options:  []PublishOption{WithQueue("periodic")},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 110*time.Millisecond)
+	defer cancel()
+
+	if err := beat.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+
+	if n := len(b.messages); n < 3 || n > 5 {
+		t.Errorf("published %d tasks", n)
+	}
+
+	if b.messages[0].Headers["task"] != "tasks.cleanup" || b.keys[0] != "periodic" {
+		t.Errorf("published %v to %q", b.messages[0].Headers, b.keys[0])
+	}
+}
+
+func TestBeatReschedule(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := &beatEntry{ScheduleEntry: &ScheduleEntry{Schedule: Every(time.Minute)}, next: start}
+
+	// a late tick keeps the schedule aligned
+	e.reschedule(start.Add(10 * time.Second))
+	if !e.next.Equal(start.Add(time.Minute)) {
+		t.Errorf("next run %v", e.next)
+	}
+
+	// missed runs are skipped
+	e.reschedule(start.Add(5 * time.Minute))
+	if !e.next.Equal(start.Add(6 * time.Minute)) {
+		t.Errorf("next run %v", e.next)
+	}
+}
+
+func TestRedisLock(t *testing.T) {
+	s, client := newTestRedis(t)
+
+	a, _ := NewRedisLock(client, "beat.lock")
+	b, _ := NewRedisLock(client, "beat.lock")
+
+	if held, err := a.Acquire(time.Minute); !held || err != nil {
+		t.Fatalf("lock not acquired: %v", err)
+	}
+
+	if held, _ := b.Acquire(time.Minute); held {
+		t.Error("lock acquired twice")
+	}
+
+	if held, _ := a.Acquire(time.Minute); !held {
+		t.Error("lock not renewed")
+	}
+
+	// the lock of a holder failing to renew it expires
+	s.FastForward(2 * time.Minute)
+
+	if held, _ := b.Acquire(time.Minute); !held {
+		t.Error("expired lock not acquired")
+	}
+
+	if err := a.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	if held, _ := b.Acquire(time.Minute); !held {
+		t.Error("lock released by another holder")
+	}
+}
+
+type heldLock struct{ held bool }
+
+func (l *heldLock) Acquire(ttl time.Duration) (bool, error) { return l.held, nil }
+func (l *heldLock) Release() error                          { return nil }
+
+func TestBeatStandby(t *testing.T) {
+	b := &routedBroker{}
+
+	beat := NewBeat(NewPublisher(b))
+	beat.Lock = &heldLock{}
+	beat.LockTTL = 30 * time.Millisecond
+	beat.Add(&ScheduleEntry{Name: "cleanup", Task: "tasks.cleanup", Schedule: Every(10 * time.Millisecond)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	beat.Run(ctx)
+
+	if len(b.messages) != 0 {
+		t.Errorf("standby scheduler published %d tasks", len(b.messages))
+	}
+}
+
+func TestBeatStores(t *testing.T) {
+	_, client := newTestRedis(t)
+
+	stores := []BeatStore{
+		NewFileStore(filepath.Join(t.TempDir(), "celerybeat-schedule")),
+		NewRedisStore(client, "celerybeat-schedule"),
+	}
+
+	last := time.Date(2021, 3, 5, 10, 0, 0, 0, time.UTC)
+
+	for _, s := range stores {
+		if runs, err := s.Load(); err != nil || len(runs) != 0 {
+			t.Fatalf("loaded %v: %v", runs, err)
+		}
+
+		if err := s.Save("cleanup", last); err != nil {
+			t.Fatal(err)
+		}
+
+		if runs, err := s.Load(); err != nil || !runs["cleanup"].Equal(last) {
+			t.Errorf("loaded %v: %v", runs, err)
+		}
+	}
+}
+
+func TestBeatResume(t *testing.T) {
+	s := NewFileStore(filepath.Join(t.TempDir(), "celerybeat-schedule"))
+	s.Save("overdue", time.Now().Add(-time.Hour))
+	s.Save("recent", time.Now())
+
+	b := &routedBroker{}
+
+	beat := NewBeat(NewPublisher(b))
+	beat.Store = s
+	beat.Add(&ScheduleEntry{Name: "overdue", Task: "tasks.overdue", Schedule: Every(time.Minute)})
+	beat.Add(&ScheduleEntry{Name: "recent", Task: "tasks.recent", Schedule: Every(time.Minute)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	beat.Run(ctx)
+
+	if len(b.messages) != 1 || b.messages[0].Headers["task"] != "tasks.overdue" {
+		t.Fatalf("published %d tasks", len(b.messages))
+	}
+
+	runs, _ := s.Load()
+	if time.Since(runs["overdue"]) > time.Minute {
+		t.Errorf("last run %v", runs["overdue"])
+	}
+}
+
+func TestBeatMutableSchedule(t *testing.T) {
+	b := &routedBroker{}
+
+	beat := NewBeat(NewPublisher(b))
+	beat.MaxInterval = time.Hour
+	beat.Add(&ScheduleEntry{Name: "hourly", Task: "tasks.hourly", Schedule: Every(time.Hour)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- beat.Run(ctx) }()
+
+	time.Sleep(10 * time.Millisecond)
+
+	// the running scheduler wakes up for the new entry
+	beat.Add(&ScheduleEntry{Name: "often", Task: "tasks.often", Schedule: Every(10 * time.Millisecond)})
+	time.Sleep(35 * time.Millisecond)
+
+	if !beat.Remove("often") || beat.Remove("missing") {
+		t.Error("unexpected removal")
+	}
+
+	entries := beat.Entries()
+	if len(entries) != 1 || entries[0].Name != "hourly" {
+		t.Errorf("entries %v", entries)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	<-done
+
+	if n := len(b.messages); n < 2 || n > 4 {
+		t.Errorf("published %d tasks", n)
+	}
+
+	for _, msg := range b.messages {
+		if msg.Headers["task"] != "tasks.often" {
+			t.Errorf("published %v", msg.Headers["task"])
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package celery
+
+import (
+	"context"
+	"github.com/nu7hatch/gouuid"
+	"sync"
+)
+
+// Number of broadcast task ids a worker remembers
+const broadcastDedupeSize = 10000
+
+// Broker declaring exclusive queues, deleted once the connection
+// of their consumer is closed,
+// DeclareExclusiveQueue - creates an exclusive auto-deleted queue
+type ExclusiveQueueBroker interface {
+	Broker
+	DeclareExclusiveQueue(name string, args map[string]interface{}) error
+}
+
+// Returns a pointer to a new exclusive queue bound to the fanout
+// exchange of broadcast tasks, named bcast.<uuid> as Celery's
+// Broadcast queues, each consumer needs its own
+func NewBroadcastQueue(exchange string) (*Queue, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Queue{
+		Name:         "bcast." + id.String(),
+		Exchange:     exchange,
+		ExchangeType: ExchangeFanout,
+		Exclusive:    true,
+	}, nil
+}
+
+// Declares and consumes the broadcast queue of the worker
+func (w *Worker) consumeBroadcast(ctx context.Context) (<-chan *Message, error) {
+	q, err := NewBroadcastQueue(w.Broadcast)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DeclareQueue(w.broker, q); err != nil {
+		return nil, err
+	}
+
+	w.broadcastQueue = q.Name
+	w.broadcastSeen = NewMemoryDedupe(broadcastDedupeSize)
+
+	return consumeContext(ctx, w.broker, q.Name, "", "")
+}
+
+// Returns whether a message was received on the broadcast queue,
+// from the broadcast exchange or retried to the queue
+func (w *Worker) broadcasted(msg *Message) bool {
+	if w.broadcastQueue == "" {
+		return false
+	}
+
+	return msg.Exchange == w.Broadcast || msg.Exchange == "" && msg.RoutingKey == w.broadcastQueue
+}
+
+// Returns where the message of a retried or requeued task is published,
+// broadcast tasks go back to the broadcast queue of the worker alone
+func (w *Worker) route(msg *Message) (exchange, key string) {
+	if w.broadcasted(msg) {
+		return "", w.broadcastQueue
+	}
+
+	return w.exchange, w.key
+}
+
+// Returns the record of the processed tasks of a message, broadcast
+// tasks are recorded by the worker alone since every worker runs them
+func (w *Worker) dedupe(msg *Message) DedupeStore {
+	if w.broadcasted(msg) {
+		return w.broadcastSeen
+	}
+
+	return w.Dedupe
+}
+
+// Returns a channel receiving the messages of a and b,
+// closed once both are
+func mergeMessages(a, b <-chan *Message) <-chan *Message {
+	merged := make(chan *Message)
+
+	var wg sync.WaitGroup
+
+	for _, messages := range []<-chan *Message{a, b} {
+		wg.Add(1)
+
+		go func(messages <-chan *Message) {
+			defer wg.Done()
+
+			for msg := range messages {
+				merged <- msg
+			}
+		}(messages)
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	return merged
+}
@@ -0,0 +1,99 @@
+package celery
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerBroadcast(t *testing.T) {
+	b := NewMemoryBroker()
+	dedupe := NewMemoryDedupe(10)
+
+	var mu sync.Mutex
+	runs := map[string]int{}
+
+	for _, hostname := range []string{"a", "b"} {
+		w := NewWorker(b, "celery", "", "celery")
+		w.Hostname = hostname
+		w.Concurrency = 1
+		w.Broadcast = "broadcast"
+		w.Dedupe = dedupe
+		w.RegisterContext("cache.invalidate", func(ctx context.Context, task *Task) (interface{}, error) {
+			req, _ := RequestFromContext(ctx)
+
+			mu.Lock()
+			runs[req.Hostname]++
+			mu.Unlock()
+
+			return nil, nil
+		})
+
+		go w.Run()
+		defer w.Stop(context.Background())
+
+		deadline := time.Now().Add(5 * time.Second)
+		for w.Healthy() != nil {
+			if time.Now().After(deadline) {
+				t.Fatal(w.Healthy())
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	p := NewPublisher(b)
+
+	// the same task twice, each worker runs it once
+	x, _ := NewTask("cache.invalidate", nil, nil)
+	for i := 0; i < 2; i++ {
+		if err := p.ApplyAsync(x, WithExchange("broadcast")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := runs["a"] == 1 && runs["b"] == 1
+		mu.Unlock()
+
+		if done {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("runs %v", runs)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if seen, _ := dedupe.Seen(x.Id); seen {
+		t.Error("broadcast task recorded in the shared dedupe store")
+	}
+}
+
+func TestBroadcastQueue(t *testing.T) {
+	q, err := NewBroadcastQueue("broadcast")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.Name) != len("bcast.")+36 || q.ExchangeType != ExchangeFanout || !q.Exclusive {
+		t.Errorf("queue %+v", q)
+	}
+
+	w := NewWorker(NewMemoryBroker(), "celery", "tasks", "celery")
+	w.Broadcast = "broadcast"
+	w.broadcastQueue = q.Name
+
+	if exchange, key := w.route(&Message{Exchange: "broadcast"}); exchange != "" || key != q.Name {
+		t.Errorf("broadcast task retried to %q %q", exchange, key)
+	}
+
+	if exchange, key := w.route(&Message{Exchange: "tasks", RoutingKey: "celery"}); exchange != "tasks" || key != "celery" {
+		t.Errorf("task retried to %q %q", exchange, key)
+	}
+}
@@ -0,0 +1,153 @@
+package celery
+
+import (
+	"context"
+	"time"
+)
+
+// Message delivery modes
+const (
+	Transient  uint8 = 1
+	Persistent uint8 = 2
+)
+
+// Transport independent message representation,
+// the fields follow the AMQP message properties,
+// Mandatory - publish as mandatory, brokers supporting it report
+// unroutable messages as a *PublishError,
+// Exchange, RoutingKey, Redelivered, ConsumerTag and Acknowledger
+// are only set on consumed messages
+type Message struct {
+	ContentType     string
+	ContentEncoding string
+	DeliveryMode    uint8
+	Priority        uint8
+	CorrelationId   string
+	ReplyTo         string
+	Expiration      string
+	Timestamp       time.Time
+	Headers         map[string]interface{}
+	Body            []byte
+	Mandatory       bool
+
+	Exchange     string
+	RoutingKey   string
+	Redelivered  bool
+	ConsumerTag  string
+	Acknowledger Acknowledger
+}
+
+// Settles a consumed message with the broker it was received from
+type Acknowledger interface {
+	Ack() error
+	Nack(requeue bool) error
+	Reject(requeue bool) error
+}
+
+// Message transport,
+// Publish - sends a message to exchange with routing key,
+// Consume - binds queue to exchange with key and delivers its messages
+// until the broker is closed, messages must be settled by the receiver,
+// DeclareQueue - creates a durable queue with optional arguments,
+// Close - releases the broker resources
+type Broker interface {
+	Publish(exchange, key string, msg *Message) error
+	Consume(queue, exchange, key string) (<-chan *Message, error)
+	DeclareQueue(name string, args map[string]interface{}) error
+	Close() error
+}
+
+// Broker supporting cancellation,
+// PublishContext - same as Publish, gives up when ctx is done,
+// ConsumeContext - same as Consume, stops consuming and closes
+// the messages channel when ctx is done
+type ContextBroker interface {
+	Broker
+	PublishContext(ctx context.Context, exchange, key string, msg *Message) error
+	ConsumeContext(ctx context.Context, queue, exchange, key string) (<-chan *Message, error)
+}
+
+// Broker with consumer prefetch limits,
+// Qos - limits the unacknowledged messages delivered to each consumer
+// to prefetch, or to all the consumers of the broker when global,
+// 0 removes the limit
+type QosBroker interface {
+	Broker
+	Qos(prefetch int, global bool) error
+}
+
+// Publish a message, brokers without cancellation support
+// are only checked for a done ctx before publishing
+func publishContext(ctx context.Context, b Broker, exchange, key string, msg *Message) error {
+	if cb, ok := b.(ContextBroker); ok {
+		return cb.PublishContext(ctx, exchange, key, msg)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.Publish(exchange, key, msg)
+}
+
+// Consume a queue until ctx is done, for brokers without cancellation
+// support messages stop being forwarded and the one in flight is requeued
+func consumeContext(ctx context.Context, b Broker, queue, exchange, key string) (<-chan *Message, error) {
+	if cb, ok := b.(ContextBroker); ok {
+		return cb.ConsumeContext(ctx, queue, exchange, key)
+	}
+
+	deliveries, err := b.Consume(queue, exchange, key)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make(chan *Message)
+
+	go func() {
+		defer close(messages)
+
+		for {
+			select {
+			case msg, ok := <-deliveries:
+				if !ok {
+					return
+				}
+
+				select {
+				case messages <- msg:
+				case <-ctx.Done():
+					msg.Nack(true)
+					return
+				}
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// Declares a queue honoring message priorities from 0 to max,
+// the x-max-priority argument of RabbitMQ priority queues
+func DeclarePriorityQueue(b Broker, name string, max uint8) error {
+	return b.DeclareQueue(name, map[string]interface{}{"x-max-priority": int(max)})
+}
+
+// Acknowledges a consumed message
+func (m *Message) Ack() error {
+	return m.Acknowledger.Ack()
+}
+
+// Negatively acknowledges a consumed message,
+// requeued messages are delivered again
+func (m *Message) Nack(requeue bool) error {
+	return m.Acknowledger.Nack(requeue)
+}
+
+// Rejects a consumed message
+func (m *Message) Reject(requeue bool) error {
+	return m.Acknowledger.Reject(requeue)
+}
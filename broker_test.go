@@ -0,0 +1,116 @@
+package celery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type chanBroker struct {
+	Broker
+	messages chan *Message
+}
+
+func (b *chanBroker) Consume(queue, exchange, key string) (<-chan *Message, error) {
+	return b.messages, nil
+}
+
+func TestConsumeContext(t *testing.T) {
+	b := &chanBroker{messages: make(chan *Message, 2)}
+
+	ack := &ackRecorder{}
+	b.messages <- &Message{Acknowledger: &ackRecorder{}}
+	b.messages <- &Message{Acknowledger: ack}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := consumeContext(ctx, b, "celery", "", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receive(t, messages)
+
+	// let the forwarder pick up the second message before cancelling
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Fatal("message delivered after cancellation")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages not closed")
+	}
+
+	if !ack.nacked || !ack.requeued {
+		t.Fail()
+	}
+
+	if err := publishContext(ctx, b, "", "celery", &Message{}); err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
+func TestDialBroker(t *testing.T) {
+	if b, err := DialBroker("memory://"); err != nil {
+		t.Error(err)
+	} else if _, ok := b.(*MemoryBroker); !ok {
+		t.Errorf("dialed %T", b)
+	}
+
+	if b, err := DialBroker("redis://localhost:6379/1"); err != nil {
+		t.Error(err)
+	} else {
+		b.Close()
+	}
+
+	if _, err := DialBroker("kafka://localhost"); err == nil {
+		t.Error("unsupported scheme dialed")
+	}
+}
+
+func TestSentinelOptions(t *testing.T) {
+	rawurl := "sentinel://:secret@10.0.0.1:26379/2;sentinel://10.0.0.2:26379;sentinel://10.0.0.3:26379"
+
+	fo, err := sentinelOptions(rawurl, map[string]interface{}{"master_name": "mymaster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fo.MasterName != "mymaster" || fo.Password != "secret" || fo.DB != 2 || !reflect.DeepEqual(fo.SentinelAddrs, []string{"10.0.0.1:26379", "10.0.0.2:26379", "10.0.0.3:26379"}) {
+		t.Errorf("options %+v", fo)
+	}
+
+	if fo, err := sentinelOptions("sentinel://localhost:26379?master_name=other", nil); err != nil || fo.MasterName != "other" {
+		t.Errorf("options %+v, %v", fo, err)
+	}
+
+	if _, err := DialBroker("sentinel://localhost:26379"); err == nil {
+		t.Error("dialed a sentinel without master name")
+	}
+
+	b, err := DialBrokerWithOptions(rawurl, map[string]interface{}{"master_name": "mymaster"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Close()
+}
+
+func TestClusterOptions(t *testing.T) {
+	co, err := clusterOptions("rediscluster://:secret@10.0.0.1:7000,10.0.0.2:7001/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if co.Password != "secret" || !reflect.DeepEqual(co.Addrs, []string{"10.0.0.1:7000", "10.0.0.2:7001"}) {
+		t.Errorf("options %+v", co)
+	}
+
+	if _, err := DialBackend("rediscluster://"); err == nil {
+		t.Error("dialed a cluster without nodes")
+	}
+}
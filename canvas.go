@@ -0,0 +1,473 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Celery task signature, a task invocation embedded in another message,
+// Task - task name,
+// Id - task UUID,
+// Args - optional task args, any JSON value,
+// KWArgs - optional task kwargs,
+// Options - optional apply_async options,
+// Immutable - when false the parent task result is prepended to Args,
+// ChordSize - optional number of header tasks of the chord it is the body of
+type Signature struct {
+	Task      string
+	Id        string
+	Args      []interface{}
+	KWArgs    map[string]interface{}
+	Options   map[string]interface{}
+	Immutable bool
+	ChordSize int
+}
+
+type FormattedSignature struct {
+	Task        string                 `json:"task"`
+	Args        []interface{}          `json:"args"`
+	KWArgs      map[string]interface{} `json:"kwargs"`
+	Options     map[string]interface{} `json:"options"`
+	SubtaskType *string                `json:"subtask_type"`
+	Immutable   bool                   `json:"immutable"`
+	ChordSize   *int                   `json:"chord_size"`
+}
+
+// Returns a pointer to a new signature object
+func NewSignature(task string, args []interface{}, kwargs map[string]interface{}) (*Signature, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	s := Signature{
+		Task:   task,
+		Id:     id,
+		Args:   args,
+		KWArgs: kwargs,
+	}
+
+	return &s, nil
+}
+
+// Returns a copy of the signature options with key set to value
+func (s *Signature) withOption(key string, value interface{}) *Signature {
+	out := *s
+	out.Options = make(map[string]interface{}, len(s.Options)+1)
+
+	for k, v := range s.Options {
+		out.Options[k] = v
+	}
+
+	out.Options[key] = value
+
+	return &out
+}
+
+// Returns the task a signature describes
+func (s *Signature) task() *Task {
+	t := &Task{
+		Task:   s.Task,
+		Id:     s.Id,
+		Args:   s.Args,
+		KWArgs: s.KWArgs,
+	}
+
+	t.ReplyTo, _ = s.Options["reply_to"].(string)
+	t.IgnoreResult, _ = s.Options["ignore_result"].(bool)
+
+	return t
+}
+
+// Returns the task applying a linked signature to the args of its
+// parent, prepended unless the signature is immutable, the signatures
+// linked in its options are linked to the task
+func (s *Signature) apply(args ...interface{}) (*Task, error) {
+	t := s.task()
+
+	if t.Id == "" {
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+
+		t.Id = id
+	}
+
+	if !s.Immutable {
+		t.Args = append(args, s.Args...)
+	}
+
+	var err error
+
+	if t.Callbacks, err = s.linked("link"); err != nil {
+		return nil, err
+	}
+
+	t.Errbacks, err = s.linked("link_error")
+
+	return t, err
+}
+
+// Returns the signatures linked under an option key, a single
+// signature dict or a list of them
+func (s *Signature) linked(key string) ([]*Signature, error) {
+	switch v := s.Options[key].(type) {
+	case nil:
+		return nil, nil
+	case []*Signature:
+		return v, nil
+	case *Signature:
+		return []*Signature{v}, nil
+	}
+
+	data, err := json.Marshal(s.Options[key])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.Options[key].(map[string]interface{}); ok {
+		data = append(append([]byte("["), data...), ']')
+	}
+
+	var out []*Signature
+	err = json.Unmarshal(data, &out)
+
+	return out, err
+}
+
+// Returns the exchange and routing key set in the signature options,
+// or the given ones
+func (s *Signature) route(exchange, key string) (string, string) {
+	if queue, ok := s.Options["queue"].(string); ok && queue != "" {
+		return "", queue
+	}
+
+	if e, ok := s.Options["exchange"].(string); ok {
+		exchange = e
+	}
+
+	if k, ok := s.Options["routing_key"].(string); ok {
+		key = k
+	}
+
+	return exchange, key
+}
+
+// Marshals a signature into the dict format used by Celery,
+// the signature id is sent as the task_id option
+func (s *Signature) MarshalJSON() ([]byte, error) {
+	out := FormattedSignature{
+		Task:      s.Task,
+		Args:      s.Args,
+		KWArgs:    s.KWArgs,
+		Options:   s.Options,
+		Immutable: s.Immutable,
+	}
+
+	if out.Args == nil {
+		out.Args = []interface{}{}
+	}
+
+	if out.KWArgs == nil {
+		out.KWArgs = map[string]interface{}{}
+	}
+
+	if s.Id != "" {
+		out.Options = s.withOption("task_id", s.Id).Options
+	}
+
+	if s.ChordSize > 0 {
+		out.ChordSize = &s.ChordSize
+	}
+
+	if out.Options == nil {
+		out.Options = map[string]interface{}{}
+	}
+
+	return json.Marshal(out)
+}
+
+func (s *Signature) UnmarshalJSON(data []byte) error {
+	sig := FormattedSignature{}
+	if err := unmarshalNumbers(data, &sig); err != nil {
+		return err
+	}
+
+	s.Task = sig.Task
+	s.Args = sig.Args
+	s.KWArgs = sig.KWArgs
+	s.Options = sig.Options
+	s.Immutable = sig.Immutable
+	s.Id, _ = sig.Options["task_id"].(string)
+	s.ChordSize = 0
+
+	if sig.ChordSize != nil {
+		s.ChordSize = *sig.ChordSize
+	}
+
+	return nil
+}
+
+// Returns a chain as protocol v1 callbacks, each signature
+// links the next one in its options
+func chainCallbacks(chain []*Signature) []*Signature {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	next := chain[0]
+	if rest := chainCallbacks(chain[1:]); rest != nil {
+		next = next.withOption("link", rest)
+	}
+
+	return []*Signature{next}
+}
+
+// Returns a chain in the protocol v2 order, last signature first
+func reverseChain(chain []*Signature) []*Signature {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	out := make([]*Signature, len(chain))
+	for i, s := range chain {
+		out[len(chain)-1-i] = s
+	}
+
+	return out
+}
+
+// Celery chain representation, signatures are executed sequentially
+// by the workers, each receiving the result of the previous one
+type Chain struct {
+	Signatures []*Signature
+}
+
+// Returns a pointer to a new chain of signatures,
+// the equivalent of task1.s() | task2.s() in Python
+func NewChain(signatures ...*Signature) *Chain {
+	return &Chain{Signatures: signatures}
+}
+
+// Returns the first task of the chain, the remaining
+// signatures are embedded in it
+func (c *Chain) task() (*Task, error) {
+	if len(c.Signatures) == 0 {
+		return nil, errors.New("empty chain")
+	}
+
+	t := c.Signatures[0].task()
+	t.Chain = c.Signatures[1:]
+
+	return t, nil
+}
+
+// Publish the chain, only the first task is sent to the broker,
+// workers publish the following ones
+func (c *Chain) Publish(p *Publisher, exchange, key string) error {
+	t, err := c.task()
+	if err != nil {
+		return err
+	}
+
+	return p.Publish(t, exchange, key)
+}
+
+// Publish the chain and return the pending result of its last task,
+// the signatures of the chain are left unchanged
+func (c *Chain) PublishWithResult(p *Publisher, exchange, key string, backend ResultBackend) (*AsyncResult, error) {
+	published := &Chain{Signatures: c.Signatures}
+
+	if rpc, ok := backend.(*RPCBackend); ok {
+		published.Signatures = make([]*Signature, len(c.Signatures))
+
+		for i, s := range c.Signatures {
+			published.Signatures[i] = s.withOption("reply_to", rpc.ReplyTo())
+		}
+	}
+
+	if err := published.Publish(p, exchange, key); err != nil {
+		return nil, err
+	}
+
+	return NewAsyncResult(c.Signatures[len(c.Signatures)-1].Id, backend), nil
+}
+
+// Celery group representation, signatures are executed in parallel
+// and share a group id
+type Group struct {
+	Id         string
+	Signatures []*Signature
+}
+
+// Results of a published group, in the order of the group signatures
+type GroupResult struct {
+	Id      string
+	Results []*AsyncResult
+}
+
+// Returns a pointer to a new group of signatures
+func NewGroup(signatures ...*Signature) (*Group, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Group{Id: id, Signatures: signatures}, nil
+}
+
+// Returns the tasks of the group
+func (g *Group) tasks() []*Task {
+	tasks := make([]*Task, len(g.Signatures))
+
+	for i, s := range g.Signatures {
+		tasks[i] = s.task()
+		tasks[i].GroupID = g.Id
+		tasks[i].GroupIndex = i
+	}
+
+	return tasks
+}
+
+// Publish every task of the group
+func (g *Group) Publish(p *Publisher, exchange, key string) error {
+	for _, t := range g.tasks() {
+		if err := p.Publish(t, exchange, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Publish every task of the group and return their pending results
+func (g *Group) PublishWithResult(p *Publisher, exchange, key string, backend ResultBackend) (*GroupResult, error) {
+	r := &GroupResult{Id: g.Id}
+
+	for _, t := range g.tasks() {
+		result, err := p.PublishWithResult(t, exchange, key, backend)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Results = append(r.Results, result)
+	}
+
+	return r, nil
+}
+
+// Returns true when every task of the group has finished executing
+func (r *GroupResult) Ready() (bool, error) {
+	for _, result := range r.Results {
+		if ready, err := result.Ready(); err != nil || !ready {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Waits for every task of the group and returns their results in order,
+// the first failed task error is returned
+func (r *GroupResult) Join(ctx context.Context) ([]interface{}, error) {
+	values := make([]interface{}, len(r.Results))
+
+	for i, result := range r.Results {
+		value, err := result.Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+// Celery chord representation, the body is applied with the results
+// of the header group once every header task has finished,
+// Unlock - publish a celery.chord_unlock task polling the header results,
+// needed by result backends without native join support
+type Chord struct {
+	Header *Group
+	Body   *Signature
+	Unlock bool
+}
+
+// Returns a pointer to a new chord
+func NewChord(header *Group, body *Signature) *Chord {
+	return &Chord{Header: header, Body: body}
+}
+
+// Returns the header tasks, each carrying the chord body
+func (c *Chord) tasks() []*Task {
+	body := *c.Body
+	body.ChordSize = len(c.Header.Signatures)
+
+	tasks := c.Header.tasks()
+	for _, t := range tasks {
+		t.Chord = &body
+	}
+
+	return tasks
+}
+
+// Returns the celery.chord_unlock task for the chord
+func (c *Chord) unlock() (*Task, error) {
+	results := make([]interface{}, len(c.Header.Signatures))
+	for i, s := range c.Header.Signatures {
+		// AsyncResult.as_tuple() without a parent
+		results[i] = []interface{}{[]interface{}{s.Id, nil}, nil}
+	}
+
+	t, err := NewTask("celery.chord_unlock", nil, map[string]interface{}{
+		"group_id":    c.Header.Id,
+		"callback":    c.Body,
+		"interval":    1,
+		"max_retries": nil,
+		"result":      results,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.Countdown = time.Second
+
+	return t, nil
+}
+
+// Publish the header tasks of the chord
+func (c *Chord) Publish(p *Publisher, exchange, key string) error {
+	if len(c.Header.Signatures) == 0 {
+		return errors.New("empty chord header")
+	}
+
+	for _, t := range c.tasks() {
+		if err := p.Publish(t, exchange, key); err != nil {
+			return err
+		}
+	}
+
+	if !c.Unlock {
+		return nil
+	}
+
+	t, err := c.unlock()
+	if err != nil {
+		return err
+	}
+
+	return p.Publish(t, exchange, key)
+}
+
+// Publish the chord and return the pending result of its body
+func (c *Chord) PublishWithResult(p *Publisher, exchange, key string, backend ResultBackend) (*AsyncResult, error) {
+	if err := c.Publish(p, exchange, key); err != nil {
+		return nil, err
+	}
+
+	return NewAsyncResult(c.Body.Id, backend), nil
+}
@@ -0,0 +1,303 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func newTestChain(t *testing.T) *Chain {
+	var sigs []*Signature
+
+	for _, name := range []string{"tasks.first", "tasks.second", "tasks.third"} {
+		s, err := NewSignature(name, []interface{}{"1"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sigs = append(sigs, s)
+	}
+
+	return NewChain(sigs...)
+}
+
+func TestSignatureJson(t *testing.T) {
+	s, err := NewSignature("tasks.add", []interface{}{"1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	options, ok := result["options"].(map[string]interface{})
+	if !ok || options["task_id"] != s.Id {
+		t.Fail()
+	}
+
+	if result["task"] != "tasks.add" || result["immutable"] != false {
+		t.Fail()
+	}
+
+	if kwargs, ok := result["kwargs"].(map[string]interface{}); !ok || len(kwargs) != 0 {
+		t.Fail()
+	}
+
+	x := &Signature{}
+	if err := json.Unmarshal(b, x); err != nil {
+		t.Fatal(err)
+	}
+
+	if x.Id != s.Id || x.Task != s.Task || len(x.Args) != 1 {
+		t.Fail()
+	}
+
+	if s.Options != nil {
+		t.Error("marshaling modified the signature options")
+	}
+}
+
+func TestChainV1(t *testing.T) {
+	c := newTestChain(t)
+
+	x, err := c.task()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if x.Task != "tasks.first" || x.Id != c.Signatures[0].Id {
+		t.Fail()
+	}
+
+	b, err := x.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := struct {
+		Callbacks []struct {
+			Task    string `json:"task"`
+			Options struct {
+				TaskId string `json:"task_id"`
+				Link   []struct {
+					Task string `json:"task"`
+				} `json:"link"`
+			} `json:"options"`
+		} `json:"callbacks"`
+	}{}
+
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Callbacks) != 1 || result.Callbacks[0].Task != "tasks.second" {
+		t.Fatal(string(b))
+	}
+
+	if result.Callbacks[0].Options.TaskId != c.Signatures[1].Id {
+		t.Fail()
+	}
+
+	link := result.Callbacks[0].Options.Link
+	if len(link) != 1 || link[0].Task != "tasks.third" {
+		t.Fatal(string(b))
+	}
+}
+
+func TestChainV2(t *testing.T) {
+	c := newTestChain(t)
+
+	x, err := c.task()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := x.bodyV2()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []json.RawMessage{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		t.Fatal(err)
+	}
+
+	embed := struct {
+		Chain []*Signature `json:"chain"`
+	}{}
+
+	if err := json.Unmarshal(body[2], &embed); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(embed.Chain) != 2 || embed.Chain[0].Task != "tasks.third" || embed.Chain[1].Task != "tasks.second" {
+		t.Fatal(string(body[2]))
+	}
+
+	if _, err := NewChain().task(); err == nil {
+		t.Fail()
+	}
+}
+
+func TestGroup(t *testing.T) {
+	c := newTestChain(t)
+
+	g, err := NewGroup(c.Signatures...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, x := range g.tasks() {
+		if x.GroupID != g.Id || x.Id != c.Signatures[i].Id {
+			t.Fail()
+		}
+
+		msg, err := x.message(ProtocolV2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.Headers["group"] != g.Id {
+			t.Fail()
+		}
+
+		b, _ := x.MarshalJSON()
+		result := struct {
+			Taskset string `json:"taskset"`
+		}{}
+
+		if err := json.Unmarshal(b, &result); err != nil || result.Taskset != g.Id {
+			t.Fail()
+		}
+	}
+}
+
+func TestGroupResultJoin(t *testing.T) {
+	backend := &memoryResults{results: make(map[string]*ResultMeta)}
+	backend.Store(&ResultMeta{TaskId: "1", Status: StateSuccess, Result: 1.0})
+	backend.Store(&ResultMeta{TaskId: "2", Status: StateSuccess, Result: 2.0})
+
+	r := &GroupResult{Results: []*AsyncResult{NewAsyncResult("1", backend), NewAsyncResult("2", backend)}}
+
+	if ready, err := r.Ready(); err != nil || !ready {
+		t.Fail()
+	}
+
+	values, err := r.Join(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 2 || values[0] != 1.0 || values[1] != 2.0 {
+		t.Fail()
+	}
+}
+
+func TestChord(t *testing.T) {
+	c := newTestChain(t)
+
+	header, err := NewGroup(c.Signatures[:2]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chord := NewChord(header, c.Signatures[2])
+
+	for _, x := range chord.tasks() {
+		if x.GroupID != header.Id || x.Chord == nil || x.Chord.ChordSize != 2 {
+			t.Fatal(x)
+		}
+
+		b, _ := x.MarshalJSON()
+		result := struct {
+			Chord struct {
+				Task      string `json:"task"`
+				ChordSize int    `json:"chord_size"`
+			} `json:"chord"`
+		}{}
+
+		if err := json.Unmarshal(b, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Chord.Task != "tasks.third" || result.Chord.ChordSize != 2 {
+			t.Fail()
+		}
+	}
+
+	if c.Signatures[2].ChordSize != 0 {
+		t.Error("chord modified the body signature")
+	}
+
+	unlock, err := chord.unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unlock.Task != "celery.chord_unlock" || unlock.KWArgs["group_id"] != header.Id || unlock.eta().IsZero() {
+		t.Fail()
+	}
+
+	if _, err := unlock.MarshalJSON(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChordRoundTrip(t *testing.T) {
+	c := newTestChain(t)
+
+	header, err := NewGroup(c.Signatures[:2]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := NewChord(header, c.Signatures[2]).tasks()
+
+	for _, protocol := range []int{ProtocolV1, ProtocolV2} {
+		msg, err := tasks[1].message(protocol)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// timestamps missing from v1 bodies are tolerated as by the worker
+		x, _ := DecodeTask(msg)
+
+		if x.GroupID != header.Id || x.Chord == nil || x.Chord.Task != "tasks.third" || x.Chord.ChordSize != 2 {
+			t.Errorf("protocol %d decoded %+v", protocol, x)
+		}
+
+		if protocol == ProtocolV2 && x.GroupIndex != 1 {
+			t.Errorf("decoded group index %d", x.GroupIndex)
+		}
+	}
+}
+
+func TestChainPublishWithResult(t *testing.T) {
+	b := &routedBroker{}
+	rpc := &RPCBackend{queue: "replies", results: make(map[string]*ResultMeta)}
+
+	add, _ := NewSignature("tasks.add", []interface{}{1}, nil)
+	mul, _ := NewSignature("tasks.mul", []interface{}{2}, nil)
+	signatures := []*Signature{add, mul}
+
+	r, err := NewChain(signatures...).PublishWithResult(NewPublisher(b), "", "celery", rpc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Id != mul.Id || b.messages[0].ReplyTo != "replies" {
+		t.Errorf("published %+v with result %s", b.messages[0], r.Id)
+	}
+
+	// the signatures of the caller get no reply queue
+	if signatures[0] != add || add.Options != nil || mul.Options != nil {
+		t.Errorf("signatures changed to %+v %+v", signatures[0], signatures[1])
+	}
+}
@@ -6,136 +6,444 @@
 package celery
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"github.com/nu7hatch/gouuid"
+	"errors"
+	"fmt"
 	"github.com/streadway/amqp"
-	"log"
 	"time"
 )
 
 // Celery task representation,
 // Task - task name,
+// Shadow - optional name the task is displayed as in events
+// and logs, the task is still routed and executed by its name,
+// Origin - node name of the publisher of the task, set on publish,
 // Id - task UUID,
-// Args - optional task args,
+// Args - optional task args, any JSON value,
 // KWArgs - optional task kwargs,
 // Retries - optional number of retries,
 // ETA - optional time for a scheduled task,
-// Expires - optional time for task expiration
+// Countdown - optional delay from publishing to execution, used when ETA is unset,
+// Expires - optional time for task expiration,
+// ExpiresIn - optional expiration from publishing, used when Expires is unset,
+// Priority - optional message priority, honored by priority queues,
+// TimeLimit - optional hard time limit of the execution,
+// SoftTimeLimit - optional soft time limit of the execution,
+// ReplyTo - optional queue results are sent to by the rpc backend,
+// CorrelationID - correlation id of the consumed message, the task id
+// for messages published by Celery clients,
+// Headers - headers of the consumed message, the protocol v2 task
+// metadata and the custom headers it was published with,
+// Callbacks - optional signatures applied when the task succeeds,
+// Errbacks - optional signatures applied when the task fails,
+// Chain - optional signatures executed after the task, in order,
+// RootID - optional id of the first task of the workflow the task
+// belongs to, the task id when unset,
+// ParentID - optional id of the task that published the task,
+// GroupID - optional id of the group the task belongs to,
+// GroupIndex - position of the task in its group, used by result
+// backends to order the group results,
+// Chord - optional chord body applied once the group completes,
+// IgnoreResult - the task states and result are not stored,
+// sent in the protocol v2 ignore_result header
 type Task struct {
-	Task    string
-	Id      string
-	Args    []string
-	KWArgs  map[string]interface{}
-	Retries int
-	ETA     time.Time
-	Expires time.Time
+	Task          string
+	Shadow        string
+	Origin        string
+	Id            string
+	Args          []interface{}
+	KWArgs        map[string]interface{}
+	Retries       int
+	ETA           time.Time
+	Countdown     time.Duration
+	Expires       time.Time
+	ExpiresIn     time.Duration
+	Priority      uint8
+	TimeLimit     time.Duration
+	SoftTimeLimit time.Duration
+	ReplyTo       string
+	CorrelationID string
+	Headers       map[string]interface{}
+	Callbacks     []*Signature
+	Errbacks      []*Signature
+	Chain         []*Signature
+	RootID        string
+	ParentID      string
+	GroupID       string
+	GroupIndex    int
+	Chord         *Signature
+	IgnoreResult  bool
+
+	ack Acknowledger
 }
 
 type FormattedTask struct {
-	Task    string                 `json:"task"`
-	Id      string                 `json:"id"`
-	Args    []string               `json:"args,omitempty"`
-	KWArgs  map[string]interface{} `json:"kwargs,omitempty"`
-	Retries int                    `json:"retries,omitempty"`
-	ETA     string                 `json:"eta,omitempty"`
-	Expires string                 `json:"expires,omitempty"`
+	Task      string                 `json:"task"`
+	Id        string                 `json:"id"`
+	Args      []interface{}          `json:"args,omitempty"`
+	KWArgs    map[string]interface{} `json:"kwargs,omitempty"`
+	Retries   int                    `json:"retries,omitempty"`
+	ETA       string                 `json:"eta,omitempty"`
+	Expires   string                 `json:"expires,omitempty"`
+	Callbacks []*Signature           `json:"callbacks,omitempty"`
+	Errbacks  []*Signature           `json:"errbacks,omitempty"`
+	Taskset   string                 `json:"taskset,omitempty"`
+	Chord     *Signature             `json:"chord,omitempty"`
+	UTC       *bool                  `json:"utc,omitempty"`
 }
 
 const timeFormat = "2006-01-02T15:04:05.999999"
 
-// Returns a pointer to a new task object
+// Layout of the ETA and expiration times sent, ISO 8601 with
+// microseconds and an explicit offset as Python's isoformat
+const isoTimeFormat = "2006-01-02T15:04:05.000000-07:00"
+
+// Layouts of the times received, with or without an offset
+// and fractional seconds
+var timeLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// Parses an ISO 8601 time sent by Celery, times without an offset
+// are in loc
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported time format %q", s)
+}
+
+// Returns the location of the times without an offset of a protocol v1
+// message, UTC unless the utc flag is false
+func (t *FormattedTask) location() *time.Location {
+	if t.UTC != nil && !*t.UTC {
+		return time.Local
+	}
+
+	return time.UTC
+}
+
+// Returns a pointer to a new task object with string args,
+// kept for compatibility, use NewTaskArgs for args of other types
 func NewTask(task string, args []string, kwargs map[string]interface{}) (*Task, error) {
-	id, err := uuid.NewV4()
+	var values []interface{}
+
+	if args != nil {
+		values = make([]interface{}, len(args))
+		for i, arg := range args {
+			values[i] = arg
+		}
+	}
+
+	return NewTaskArgs(task, values, kwargs)
+}
+
+// Returns a pointer to a new task object, its id given by the
+// package IDGenerator
+func NewTaskArgs(task string, args []interface{}, kwargs map[string]interface{}) (*Task, error) {
+	id, err := newID()
 	if err != nil {
 		return nil, err
 	}
 
-	t := Task{
+	return NewTaskWithID(id, task, args, kwargs), nil
+}
+
+// Returns a pointer to a new task object with a caller supplied id,
+// tasks published twice under the same id are discarded by workers
+// deduplicating them
+func NewTaskWithID(id, task string, args []interface{}, kwargs map[string]interface{}) *Task {
+	return &Task{
 		Task:   task,
-		Id:     id.String(),
+		Id:     id,
 		Args:   args,
 		KWArgs: kwargs,
 	}
-
-	return &t, nil
 }
 
 // Marshals a Task object into JSON bytes array,
-// time objects are converted to UTC and formatted in ISO8601
+// time objects are converted to UTC and formatted in ISO8601 with
+// their offset, the utc flag is set, a chain is sent as nested callbacks
 func (t *Task) MarshalJSON() ([]byte, error) {
+	utc := true
 
 	out := FormattedTask{
-		Task:    t.Task,
-		Id:      t.Id,
-		Args:    t.Args,
-		KWArgs:  t.KWArgs,
-		Retries: t.Retries,
+		Task:     t.Task,
+		Id:       t.Id,
+		Args:     t.Args,
+		KWArgs:   t.KWArgs,
+		Retries:  t.Retries,
+		Errbacks: t.Errbacks,
+		Taskset:  t.GroupID,
+		Chord:    t.Chord,
+		UTC:      &utc,
+	}
+
+	if len(t.Callbacks) > 0 || len(t.Chain) > 0 {
+		out.Callbacks = append(append([]*Signature{}, t.Callbacks...), chainCallbacks(t.Chain)...)
 	}
 
-	if !t.ETA.IsZero() {
-		out.ETA = t.ETA.UTC().Format(timeFormat)
+	if eta := t.eta(); !eta.IsZero() {
+		out.ETA = eta.UTC().Format(isoTimeFormat)
 	}
 
-	if !t.Expires.IsZero() {
-		out.Expires = t.Expires.UTC().Format(timeFormat)
+	if expires := t.expires(); !expires.IsZero() {
+		out.Expires = expires.UTC().Format(isoTimeFormat)
 	}
 
 	return json.Marshal(out)
 }
 
+// Returns the time the task should run at,
+// the countdown is computed from now when no ETA is set
+func (t *Task) eta() time.Time {
+	if t.ETA.IsZero() && t.Countdown > 0 {
+		return time.Now().Add(t.Countdown)
+	}
+
+	return t.ETA
+}
+
+// Returns the name the task is displayed as, its shadow name if set
+func (t *Task) name() string {
+	if t.Shadow != "" {
+		return t.Shadow
+	}
+
+	return t.Task
+}
+
+// Returns the id of the root task of the workflow of the task
+func (t *Task) root() string {
+	if t.RootID != "" {
+		return t.RootID
+	}
+
+	return t.Id
+}
+
+// Returns the id of the parent task, nil for a root task
+func (t *Task) parent() interface{} {
+	if t.ParentID == "" {
+		return nil
+	}
+
+	return t.ParentID
+}
+
+// Sets the lineage of a task published by parent
+func (t *Task) childOf(parent *Task) {
+	t.RootID = parent.root()
+	t.ParentID = parent.Id
+}
+
+// Returns the time the task expires at,
+// the expiration is computed from now when no time is set
+func (t *Task) expires() time.Time {
+	if t.Expires.IsZero() && t.ExpiresIn > 0 {
+		return time.Now().Add(t.ExpiresIn)
+	}
+
+	return t.Expires
+}
+
+// Returns whether the task expired before now
+func (t *Task) expired(now time.Time) bool {
+	return !t.Expires.IsZero() && t.Expires.Before(now)
+}
+
+// Unmarshals a Task object from JSON bytes array,
+// numbers in args and kwargs are decoded as json.Number,
+// missing and null times are zero, the fields that could not be
+// decoded are reported together by a joined error of FieldError
 func (t *Task) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
 	task := FormattedTask{}
-	err := json.Unmarshal(data, &task)
+
+	var errs []error
+
+	for _, f := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"task", &task.Task},
+		{"id", &task.Id},
+		{"args", &task.Args},
+		{"kwargs", &task.KWArgs},
+		{"retries", &task.Retries},
+		{"eta", &task.ETA},
+		{"expires", &task.Expires},
+		{"callbacks", &task.Callbacks},
+		{"errbacks", &task.Errbacks},
+		{"taskset", &task.Taskset},
+		{"chord", &task.Chord},
+		{"utc", &task.UTC},
+	} {
+		if raw, ok := fields[f.name]; ok {
+			if err := unmarshalNumbers(raw, f.value); err != nil {
+				errs = append(errs, &FieldError{Field: f.name, Err: err})
+			}
+		}
+	}
 
 	t.Task = task.Task
 	t.Id = task.Id
 	t.Args = task.Args
 	t.KWArgs = task.KWArgs
 	t.Retries = task.Retries
-	t.ETA, err = time.Parse(timeFormat, task.ETA)
-	t.Expires, err = time.Parse(timeFormat, task.Expires)
+	t.Callbacks = task.Callbacks
+	t.Errbacks = task.Errbacks
+	t.GroupID = task.Taskset
+	t.Chord = task.Chord
+
+	var err error
+
+	if t.ETA, err = optionalTime(task.ETA, task.location()); err != nil {
+		errs = append(errs, &FieldError{Field: "eta", Err: err})
+	}
+
+	if t.Expires, err = optionalTime(task.Expires, task.location()); err != nil {
+		errs = append(errs, &FieldError{Field: "expires", Err: err})
+	}
+
+	return errors.Join(errs...)
+}
+
+// Error decoding a field of a task message,
+// Field - name of the field in the message,
+// Err - the decoding error
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return "invalid " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Parses an optional time, zero when missing or null
+func optionalTime(s string, loc *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
 
-	return err
+	return parseTime(s, loc)
 }
 
-// Publish a task to an AMQP channel,
+// Publish a task to an AMQP channel using protocol v1,
 // default exchange is "",
 // default routing key is "celery"
 func (t *Task) Publish(ch *amqp.Channel, exchange, key string) error {
-	body, err := json.Marshal(t)
+	return t.PublishContext(context.Background(), ch, exchange, key)
+}
+
+// Same as Publish, gives up when ctx is done
+func (t *Task) PublishContext(ctx context.Context, ch *amqp.Channel, exchange, key string) error {
+	p := &Publisher{broker: NewAMQPBroker(ch), Protocol: ProtocolV1}
+	return p.PublishContext(ctx, t, exchange, key)
+}
+
+// Consume tasks from an AMQP queue bound to exchange with key,
+// protocol v1 and v2 messages are decoded into tasks,
+// decoded tasks are sent to messages and acknowledged right away,
+// undecodable messages are logged and rejected, use a Consumer
+// to receive them
+func Consume(ch *amqp.Channel, queue, exchange, key string, messages chan<- Task) error {
+	deliveries, err := NewAMQPBroker(ch).Consume(queue, exchange, key)
 	if err != nil {
 		return err
 	}
 
-	msg := amqp.Publishing{
-		DeliveryMode:    amqp.Persistent,
-		Timestamp:       time.Now(),
-		ContentType:     "application/json",
-		ContentEncoding: "utf-8",
-		Body:            body,
-	}
+	sendTasks(context.Background(), deliveries, messages, false)
 
-	return ch.Publish(exchange, key, false, false, msg)
+	return nil
 }
 
-func Consume(ch *amqp.Channel, queue, exchange, key string, messages chan<- Task) error {
-	if err := ch.QueueBind(queue, key, exchange, false, nil); err != nil {
-		log.Printf("Failed: %v", err)
+// Same as Consume until ctx is done, the AMQP consumer is then
+// cancelled, messages is closed and ctx.Err() is returned
+func ConsumeContext(ctx context.Context, ch *amqp.Channel, queue, exchange, key string, messages chan<- Task) error {
+	defer close(messages)
+
+	deliveries, err := NewAMQPBroker(ch).ConsumeContext(ctx, queue, exchange, key)
+	if err != nil {
 		return err
 	}
 
-	deliveries, err := ch.Consume(queue, "", false, true, false, false, nil)
+	sendTasks(ctx, deliveries, messages, false)
+
+	return ctx.Err()
+}
+
+// Same as ConsumeContext in acks late mode, tasks are sent to messages
+// unacknowledged and the receiver settles them with Ack once done or
+// Nack to requeue them, tasks not settled are redelivered when
+// the channel closes
+func ConsumeAcksLate(ctx context.Context, ch *amqp.Channel, queue, exchange, key string, messages chan<- Task) error {
+	defer close(messages)
+
+	deliveries, err := NewAMQPBroker(ch).ConsumeContext(ctx, queue, exchange, key)
 	if err != nil {
-		log.Printf("Failed: %v", err)
 		return err
 	}
 
-	for msg := range deliveries {
-		task := &Task{}
-		task.UnmarshalJSON(msg.Body)
-		messages <- *task
-		ch.Ack(msg.DeliveryTag, false)
+	sendTasks(ctx, deliveries, messages, true)
+
+	return ctx.Err()
+}
+
+// Same as ConsumeContext with deliveries settled by the receiver,
+// see Consumer.ConsumeDeliveries
+func ConsumeDeliveries(ctx context.Context, ch *amqp.Channel, queue, exchange, key string, deliveries chan<- Delivery) error {
+	return NewConsumer(NewAMQPBroker(ch)).ConsumeDeliveries(ctx, queue, exchange, key, deliveries)
+}
+
+// Decodes deliveries and sends their tasks to messages until
+// deliveries is closed, see Consumer
+func sendTasks(ctx context.Context, deliveries <-chan *Message, messages chan<- Task, acksLate bool) {
+	(&Consumer{AcksLate: acksLate}).send(ctx, deliveries, messages)
+}
+
+// Acknowledges a task consumed in acks late mode,
+// tasks acknowledged on delivery are left as they are
+func (t *Task) Ack() error {
+	if t.ack == nil {
+		return nil
+	}
+
+	return t.ack.Ack()
+}
+
+// Negatively acknowledges a task consumed in acks late mode,
+// requeued tasks are delivered again
+func (t *Task) Nack(requeue bool) error {
+	if t.ack == nil {
+		return nil
 	}
 
-	return nil
+	return t.ack.Nack(requeue)
+}
+
+// Unmarshals JSON data into v keeping numbers as json.Number,
+// so integers, floats and strings sent by Python survive a round trip
+func unmarshalNumbers(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	return d.Decode(v)
 }
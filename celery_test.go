@@ -1,7 +1,9 @@
 package celery
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 	"time"
@@ -44,7 +46,7 @@ func TestNewTask(t *testing.T) {
 
 	x, err = NewTask("task name", args, kwargs)
 
-	if !reflect.DeepEqual(x.Args, args) {
+	if !reflect.DeepEqual(x.Args, []interface{}{"1", "2", "3"}) {
 		t.Fail()
 	}
 
@@ -57,7 +59,9 @@ func TestUnmarshalJson(t *testing.T) {
 	json := []byte("{\"expires\": \"2014-01-01T12:34:56\", \"utc\": true, \"args\": [], \"chord\": null, \"callbacks\": null, \"errbacks\": null, \"taskset\": null, \"id\": \"123abc\", \"retries\": 0, \"task\": \"Task Name\", \"timelimit\": [null, null], \"eta\": null, \"kwargs\": {}}")
 
 	x := &Task{}
-	x.UnmarshalJSON(json)
+	if err := x.UnmarshalJSON(json); err != nil {
+		t.Fatal(err)
+	}
 
 	if x.Task != "Task Name" {
 		t.Fail()
@@ -74,6 +78,78 @@ func TestUnmarshalJson(t *testing.T) {
 	}
 }
 
+func TestParseTime(t *testing.T) {
+	expected := time.Date(2014, 1, 1, 12, 34, 56, 123456000, time.UTC)
+
+	for _, s := range []string{
+		"2014-01-01T12:34:56.123456",
+		"2014-01-01T12:34:56.123456+00:00",
+		"2014-01-01T14:34:56.123456+02:00",
+		"2014-01-01T12:34:56.123456Z",
+		"2014-01-01 12:34:56.123456",
+	} {
+		if parsed, err := parseTime(s, time.UTC); err != nil || !parsed.Equal(expected) {
+			t.Errorf("%s: %v, %v", s, parsed, err)
+		}
+	}
+
+	if parsed, err := parseTime("2014-01-01T12:34:56-05:00", time.UTC); err != nil || !parsed.Equal(expected.Add(5*time.Hour).Truncate(time.Second)) {
+		t.Errorf("parsed %v, %v", parsed, err)
+	}
+
+	if _, err := parseTime("01/01/2014", time.UTC); err == nil {
+		t.Error("parsed an unsupported format")
+	}
+
+	// naive times of messages without the utc flag are local
+	x := &Task{}
+	x.UnmarshalJSON([]byte(`{"task": "tasks.add", "id": "1", "utc": false, "eta": "2014-01-01T12:34:56", "expires": "2014-01-01T12:34:56Z"}`))
+
+	if !x.ETA.Equal(time.Date(2014, 1, 1, 12, 34, 56, 0, time.Local)) || !x.Expires.Equal(time.Date(2014, 1, 1, 12, 34, 56, 0, time.UTC)) {
+		t.Errorf("eta %v, expires %v", x.ETA, x.Expires)
+	}
+
+	x.ETA = time.Date(2014, 1, 1, 14, 34, 56, 0, time.FixedZone("CEST", 2*3600))
+
+	body, _ := x.MarshalJSON()
+
+	sent := map[string]interface{}{}
+	json.Unmarshal(body, &sent)
+
+	if sent["utc"] != true || sent["eta"] != "2014-01-01T12:34:56.000000+00:00" {
+		t.Errorf("sent %s", body)
+	}
+}
+
+func TestUnmarshalJsonErrors(t *testing.T) {
+	x := &Task{}
+	err := x.UnmarshalJSON([]byte(`{"task": "tasks.add", "id": "1", "retries": "two", "eta": "tomorrow", "expires": null, "args": [1]}`))
+
+	// every field error is reported, the other fields are decoded
+	var fields []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var fe *FieldError
+		if errors.As(e, &fe) {
+			fields = append(fields, fe.Field)
+		}
+	}
+
+	if !reflect.DeepEqual(fields, []string{"retries", "eta"}) {
+		t.Errorf("error %v", err)
+	}
+
+	if x.Task != "tasks.add" || len(x.Args) != 1 || !x.ETA.IsZero() || !x.Expires.IsZero() {
+		t.Errorf("decoded %+v", x)
+	}
+
+	y := &Task{}
+	err = y.decodeV2(map[string]interface{}{"task": "tasks.add", "eta": "tomorrow", "expires": "later"}, []byte(`[{}, {}, {}]`))
+
+	if err == nil || err.Error() != "invalid eta: unsupported time format \"tomorrow\"\ninvalid expires: unsupported time format \"later\"\ninvalid args: json: cannot unmarshal object into Go value of type []interface {}" {
+		t.Errorf("error %v", err)
+	}
+}
+
 func TestMarshalJson(t *testing.T) {
 	x, err := NewTask("task name", nil, nil)
 	if err != nil {
@@ -172,3 +248,93 @@ func TestMarshalJson(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestArgsTypes(t *testing.T) {
+	args := []interface{}{1, 2.5, "3", nil, map[string]interface{}{"a": []interface{}{1}}}
+
+	x, err := NewTaskArgs("task name", args, map[string]interface{}{"n": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{
+		json.Number("1"),
+		json.Number("2.5"),
+		"3",
+		nil,
+		map[string]interface{}{"a": []interface{}{json.Number("1")}},
+	}
+
+	for _, protocol := range []int{ProtocolV1, ProtocolV2} {
+		msg, err := x.message(protocol)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		task, err := DecodeTask(msg)
+		if err != nil {
+			t.Fatalf("protocol %d: %v", protocol, err)
+		}
+
+		if !reflect.DeepEqual(task.Args, expected) {
+			t.Errorf("protocol %d: %#v", protocol, task.Args)
+		}
+
+		if task.KWArgs["n"] != json.Number("10") {
+			t.Errorf("protocol %d: %#v", protocol, task.KWArgs)
+		}
+
+		b, err := task.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := struct {
+			Args json.RawMessage `json:"args"`
+		}{}
+
+		if err := json.Unmarshal(b, &result); err != nil {
+			t.Fatal(err)
+		}
+
+		if string(result.Args) != `[1,2.5,"3",null,{"a":[1]}]` {
+			t.Errorf("protocol %d: %s", protocol, result.Args)
+		}
+	}
+}
+
+func TestAcksLate(t *testing.T) {
+	deliveries := make(chan *Message, 2)
+	messages := make(chan Task, 2)
+
+	var acks []*ackRecorder
+
+	for i := 0; i < 2; i++ {
+		x, _ := NewTask("tasks.add", nil, nil)
+		msg, ack := delivery(t, x)
+		deliveries <- msg
+		acks = append(acks, ack)
+	}
+	close(deliveries)
+
+	sendTasks(context.Background(), deliveries, messages, true)
+
+	for _, ack := range acks {
+		if ack.acked || ack.nacked {
+			t.Fatal("task settled before completion")
+		}
+	}
+
+	done, failed := <-messages, <-messages
+	done.Ack()
+	failed.Nack(true)
+
+	if !acks[0].acked || !acks[1].nacked || !acks[1].requeued {
+		t.Fail()
+	}
+
+	unsettled := Task{}
+	if unsettled.Ack() != nil || unsettled.Nack(true) != nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,270 @@
+// Package celerytest provides test doubles of the
+// github.com/bsphere/celery publishers, so application tests can
+// check the tasks they publish without a broker
+package celerytest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bsphere/celery"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Published task captured by a Recorder,
+// Task - the task as a worker would decode it,
+// Exchange, RoutingKey - where the task was published to,
+// Message - the published message
+type Published struct {
+	Task       *celery.Task
+	Exchange   string
+	RoutingKey string
+	Message    *celery.Message
+}
+
+// Publisher and broker recording the published tasks instead of
+// sending them, it can be given to the code under test as a
+// celery.TaskPublisher, or as the broker of a celery.Publisher
+// to keep its settings
+type Recorder struct {
+	mu        sync.Mutex
+	published []Published
+	publisher *celery.Publisher
+}
+
+var errNoConsume = errors.New("recorders cannot be consumed")
+
+var (
+	_ celery.TaskPublisher = (*Recorder)(nil)
+	_ celery.Broker        = (*Recorder)(nil)
+)
+
+// Returns a pointer to a new recorder publishing with protocol v2
+func NewRecorder() *Recorder {
+	r := &Recorder{}
+	r.publisher = celery.NewPublisher(r)
+
+	return r
+}
+
+// Records a task published with options
+func (r *Recorder) ApplyAsync(t *celery.Task, opts ...celery.PublishOption) error {
+	return r.publisher.ApplyAsync(t, opts...)
+}
+
+// Same as ApplyAsync, gives up when ctx is done
+func (r *Recorder) ApplyAsyncContext(ctx context.Context, t *celery.Task, opts ...celery.PublishOption) error {
+	return r.publisher.ApplyAsyncContext(ctx, t, opts...)
+}
+
+// Records a published message, messages a consumer would fail to
+// decode fail
+func (r *Recorder) Publish(exchange, key string, msg *celery.Message) error {
+	task, err := celery.DecodeTask(msg)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.published = append(r.published, Published{Task: task, Exchange: exchange, RoutingKey: key, Message: msg})
+
+	return nil
+}
+
+// Recorders deliver nothing, consuming fails
+func (r *Recorder) Consume(queue, exchange, key string) (<-chan *celery.Message, error) {
+	return nil, errNoConsume
+}
+
+// Recorders have no queues to declare
+func (r *Recorder) DeclareQueue(name string, args map[string]interface{}) error {
+	return nil
+}
+
+// Recorders hold no resources
+func (r *Recorder) Close() error {
+	return nil
+}
+
+// Returns the recorded tasks in publishing order
+func (r *Recorder) Published() []Published {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Published(nil), r.published...)
+}
+
+// Forgets the recorded tasks
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.published = nil
+}
+
+// Returns the recorded tasks named name matching every matcher
+func (r *Recorder) Find(name string, matchers ...Matcher) []Published {
+	var found []Published
+
+	for _, p := range r.Published() {
+		if p.Task.Task == name && mismatch(&p, matchers) == "" {
+			found = append(found, p)
+		}
+	}
+
+	return found
+}
+
+// Fails t unless a task named name matching every matcher was
+// recorded, returns the first such task
+func (r *Recorder) AssertPublished(t testing.TB, name string, matchers ...Matcher) *celery.Task {
+	t.Helper()
+
+	if found := r.Find(name, matchers...); len(found) > 0 {
+		return found[0].Task
+	}
+
+	var reasons []string
+
+	for _, p := range r.Published() {
+		if p.Task.Task == name {
+			reasons = append(reasons, mismatch(&p, matchers))
+		}
+	}
+
+	if len(reasons) == 0 {
+		t.Errorf("task %s not published", name)
+	} else {
+		t.Errorf("task %s not published as expected: %s", name, strings.Join(reasons, "; "))
+	}
+
+	return nil
+}
+
+// Fails t when a task named name matching every matcher was recorded
+func (r *Recorder) AssertNotPublished(t testing.TB, name string, matchers ...Matcher) {
+	t.Helper()
+
+	if found := r.Find(name, matchers...); len(found) > 0 {
+		t.Errorf("task %s published %d times", name, len(found))
+	}
+}
+
+// Checks a recorded task, returns why it does not match,
+// an empty string when it does
+type Matcher func(p *Published) string
+
+// Returns the reason of the first matcher p does not match
+func mismatch(p *Published, matchers []Matcher) string {
+	for _, m := range matchers {
+		if reason := m(p); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+// Matches tasks with the given args, compared as JSON values
+// so numbers of any type match the decoded ones
+func WithArgs(args ...interface{}) Matcher {
+	return func(p *Published) string {
+		if !jsonEqual(p.Task.Args, args) {
+			return fmt.Sprintf("args %v, expected %v", p.Task.Args, args)
+		}
+
+		return ""
+	}
+}
+
+// Matches tasks with the given kwargs, compared as JSON values
+func WithKWArgs(kwargs map[string]interface{}) Matcher {
+	return func(p *Published) string {
+		if !jsonEqual(p.Task.KWArgs, kwargs) {
+			return fmt.Sprintf("kwargs %v, expected %v", p.Task.KWArgs, kwargs)
+		}
+
+		return ""
+	}
+}
+
+// Matches tasks published to a queue through the default exchange
+func WithQueue(queue string) Matcher {
+	return func(p *Published) string {
+		if p.Exchange != "" || p.RoutingKey != queue {
+			return fmt.Sprintf("published to %q with key %q, expected queue %q", p.Exchange, p.RoutingKey, queue)
+		}
+
+		return ""
+	}
+}
+
+// Matches tasks published to exchange with routing key
+func WithRoute(exchange, key string) Matcher {
+	return func(p *Published) string {
+		if p.Exchange != exchange || p.RoutingKey != key {
+			return fmt.Sprintf("published to %q with key %q, expected %q with key %q", p.Exchange, p.RoutingKey, exchange, key)
+		}
+
+		return ""
+	}
+}
+
+// Matches tasks published with a message header, compared as
+// a JSON value
+func WithHeader(name string, value interface{}) Matcher {
+	return func(p *Published) string {
+		if v, ok := p.Message.Headers[name]; !ok || !jsonEqual(v, value) {
+			return fmt.Sprintf("header %s %v, expected %v", name, v, value)
+		}
+
+		return ""
+	}
+}
+
+// Matches tasks checked by f, such as for their ETA or priority
+func WithTask(f func(t *celery.Task) bool) Matcher {
+	return func(p *Published) string {
+		if !f(p.Task) {
+			return "task not matched"
+		}
+
+		return ""
+	}
+}
+
+// Returns whether a and b are the same JSON values, empty
+// collections equal nil ones
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// Returns v decoded from its JSON encoding
+func normalize(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var n interface{}
+	json.Unmarshal(data, &n)
+
+	switch c := n.(type) {
+	case []interface{}:
+		if len(c) == 0 {
+			return nil
+		}
+	case map[string]interface{}:
+		if len(c) == 0 {
+			return nil
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,86 @@
+package celerytest
+
+import (
+	"fmt"
+	"github.com/bsphere/celery"
+	"testing"
+)
+
+// Test recording the failures of the assertions
+type failures struct {
+	testing.TB
+	errors []string
+}
+
+func (f *failures) Helper() {}
+
+func (f *failures) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+// Code under test publishing through an interface
+func signup(p celery.TaskPublisher, user string) error {
+	t, err := celery.NewTaskArgs("app.send_welcome", []interface{}{user, 3}, map[string]interface{}{"lang": "en"})
+	if err != nil {
+		return err
+	}
+
+	return p.ApplyAsync(t, celery.WithQueue("emails"), celery.WithHeaders(map[string]interface{}{"tenant": "acme"}))
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+
+	if err := signup(r, "ada"); err != nil {
+		t.Fatal(err)
+	}
+
+	task := r.AssertPublished(t, "app.send_welcome",
+		WithArgs("ada", 3),
+		WithKWArgs(map[string]interface{}{"lang": "en"}),
+		WithQueue("emails"),
+		WithHeader("tenant", "acme"))
+
+	if task == nil || task.Id == "" {
+		t.Fatalf("asserted %+v", task)
+	}
+
+	r.AssertNotPublished(t, "app.send_invoice")
+
+	f := &failures{}
+	r.AssertPublished(f, "app.send_welcome", WithArgs("bob", 3))
+	r.AssertPublished(f, "app.send_invoice")
+	r.AssertNotPublished(f, "app.send_welcome")
+
+	if len(f.errors) != 3 || f.errors[0] != "task app.send_welcome not published as expected: args [ada 3], expected [bob 3]" {
+		t.Errorf("failed with %q", f.errors)
+	}
+
+	r.Reset()
+	if len(r.Published()) != 0 {
+		t.Error("recorded tasks not reset")
+	}
+}
+
+func TestRecorderBroker(t *testing.T) {
+	r := NewRecorder()
+
+	p := celery.NewPublisher(r)
+	p.Protocol = celery.ProtocolV1
+
+	x, _ := celery.NewTask("app.cleanup", nil, nil)
+	if err := p.Publish(x, "maintenance", "cleanup"); err != nil {
+		t.Fatal(err)
+	}
+
+	r.AssertPublished(t, "app.cleanup", WithRoute("maintenance", "cleanup"), WithArgs())
+
+	corrupt := &celery.Message{ContentType: celery.ContentTypeJSON, Body: []byte(`{"task": "app.cleanup", "id": "1", "args": "oops"}`)}
+	if err := r.Publish("", "celery", corrupt); err == nil || len(r.Published()) != 1 {
+		t.Errorf("recorded a task failing to decode, %v", err)
+	}
+
+	if _, err := r.Consume("celery", "", "celery"); err == nil {
+		t.Error("recorder consumed")
+	}
+}
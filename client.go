@@ -0,0 +1,171 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"github.com/nu7hatch/gouuid"
+	"github.com/streadway/amqp"
+	"sync"
+)
+
+var errClientClosed = errors.New("client reply queue closed")
+
+// RabbitMQ pseudo-queue of direct reply-to, replies are sent straight
+// to the consumer of the channel the request was published on,
+// without a reply queue
+const DirectReplyTo = "amq.rabbitmq.reply-to"
+
+// Synchronous caller of tasks, tasks are published with the exclusive
+// reply queue of the client and their results awaited on it, the same
+// way as with Celery's rpc:// backend but without keeping results,
+// Publisher - publisher of the called tasks
+type Client struct {
+	Publisher *Publisher
+
+	queue string
+
+	mu      sync.Mutex
+	pending map[string]chan *ResultMeta
+	closed  bool
+}
+
+// Returns a pointer to a new client publishing on ch, an exclusive
+// reply queue is declared on ch and consumed until ch is closed
+func NewClient(ch *amqp.Channel) (*Client, error) {
+	return newAMQPClient(ch, false)
+}
+
+// Same as NewClient with RabbitMQ direct reply-to, replies are received
+// on the DirectReplyTo pseudo-queue instead of a declared queue, for
+// lower latency and no queue churn, the tasks must be published on ch
+func NewDirectReplyClient(ch *amqp.Channel) (*Client, error) {
+	return newAMQPClient(ch, true)
+}
+
+func newAMQPClient(ch *amqp.Channel, direct bool) (*Client, error) {
+	queue, deliveries, err := consumeReplies(ch, direct)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newClient(NewPublisher(NewAMQPBroker(ch)), queue)
+
+	go c.receive(deliveries)
+
+	return c, nil
+}
+
+// Declares an exclusive reply queue on ch and consumes it, or consumes
+// the DirectReplyTo pseudo-queue when direct, returns the name
+// of the reply queue
+func consumeReplies(ch *amqp.Channel, direct bool) (string, <-chan amqp.Delivery, error) {
+	queue := DirectReplyTo
+
+	if !direct {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return "", nil, err
+		}
+
+		q, err := ch.QueueDeclare(id.String(), false, true, true, false, nil)
+		if err != nil {
+			return "", nil, err
+		}
+
+		queue = q.Name
+	}
+
+	// direct reply-to requires consuming in no-ack mode
+	deliveries, err := ch.Consume(queue, "", true, !direct, false, false, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return queue, deliveries, nil
+}
+
+// Returns a pointer to a new client waiting for replies on queue
+func newClient(p *Publisher, queue string) *Client {
+	return &Client{
+		Publisher: p,
+		queue:     queue,
+		pending:   make(map[string]chan *ResultMeta),
+	}
+}
+
+// Publishes a task with options and waits for its result until ctx
+// is done, a failed or revoked task returns a *TaskError
+func (c *Client) Call(ctx context.Context, t *Task, opts ...PublishOption) (interface{}, error) {
+	o := c.Publisher.options(t, opts)
+	o.task.ReplyTo = c.queue
+
+	id := o.task.Id
+	reply := make(chan *ResultMeta, 1)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errClientClosed
+	}
+
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.Publisher.publish(ctx, o); err != nil {
+		return nil, err
+	}
+
+	select {
+	case meta, ok := <-reply:
+		if !ok {
+			return nil, errClientClosed
+		}
+
+		return resultValue(meta)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Hands the ready results received on the reply queue to their callers,
+// the pending calls fail once deliveries is closed
+func (c *Client) receive(deliveries <-chan amqp.Delivery) {
+	for msg := range deliveries {
+		meta := &ResultMeta{}
+		if err := meta.UnmarshalJSON(msg.Body); err != nil {
+			loggerOr(c.Publisher.Logger).Warn("Failed to decode result", "error", err)
+			continue
+		}
+
+		if meta.TaskId == "" {
+			meta.TaskId = msg.CorrelationId
+		}
+
+		if !meta.Ready() {
+			continue
+		}
+
+		c.mu.Lock()
+		if reply, ok := c.pending[meta.TaskId]; ok {
+			reply <- meta
+			delete(c.pending, meta.TaskId)
+		}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+}
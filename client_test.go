@@ -0,0 +1,93 @@
+package celery
+
+import (
+	"context"
+	"github.com/streadway/amqp"
+	"testing"
+	"time"
+)
+
+type replyBroker struct {
+	Broker
+	deliveries chan amqp.Delivery
+	replyTo    []string
+}
+
+func (b *replyBroker) Publish(exchange, key string, msg *Message) error {
+	task, _ := DecodeTask(msg)
+	b.replyTo = append(b.replyTo, msg.ReplyTo)
+
+	status := StateSuccess
+	if task.Task == "tasks.fail" {
+		status = StateFailure
+	}
+
+	b.deliveries <- amqp.Delivery{CorrelationId: task.Id, Body: []byte(`{"status": "STARTED", "result": null}`)}
+	b.deliveries <- amqp.Delivery{
+		CorrelationId: task.Id,
+		Body:          []byte(`{"status": "` + status + `", "result": {"exc_type": "ValueError", "exc_message": ["boom"]}}`),
+	}
+
+	return nil
+}
+
+func TestClientCall(t *testing.T) {
+	b := &replyBroker{deliveries: make(chan amqp.Delivery, 2)}
+	c := newClient(NewPublisher(b), "reply")
+
+	go c.receive(b.deliveries)
+	defer close(b.deliveries)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	x, _ := NewTask("tasks.add", nil, nil)
+
+	result, err := c.Call(ctx, x, WithTaskID("1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exc, _ := result.(map[string]interface{}); exc["exc_type"] != "ValueError" {
+		t.Errorf("got %v", result)
+	}
+
+	y, _ := NewTask("tasks.fail", nil, nil)
+
+	if _, err := c.Call(ctx, y); err == nil || err.(*TaskError).Message != "boom" {
+		t.Errorf("got error %v", err)
+	}
+
+	if len(b.replyTo) != 2 || b.replyTo[0] != "reply" {
+		t.Errorf("published with reply queues %v", b.replyTo)
+	}
+
+	closed := make(chan amqp.Delivery)
+	close(closed)
+	c.receive(closed)
+
+	if _, err := c.Call(ctx, x); err != errClientClosed {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestClientDirectReplyTo(t *testing.T) {
+	b := &replyBroker{deliveries: make(chan amqp.Delivery, 2)}
+	c := newClient(NewPublisher(b), DirectReplyTo)
+
+	go c.receive(b.deliveries)
+	defer close(b.deliveries)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	x, _ := NewTask("tasks.add", nil, nil)
+
+	if _, err := c.Call(ctx, x); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.replyTo) != 1 || b.replyTo[0] != "amq.rabbitmq.reply-to" {
+		t.Errorf("published with reply to %v", b.replyTo)
+	}
+}
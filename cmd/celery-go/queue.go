@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/bsphere/celery"
+	"io"
+	"time"
+)
+
+var errNoQueueAdmin = errors.New("broker without queue administration")
+
+var queueCommands = map[string]command{
+	"len":   {usage: "print the number of messages waiting in queues", run: queueLen},
+	"peek":  {usage: "print the tasks at the head of a queue", run: queuePeek},
+	"purge": {usage: "remove the messages waiting in a queue", run: queuePurge},
+	"move":  {usage: "move messages from a queue to another", run: queueMove},
+}
+
+// Administers the queues of the broker, the same as
+// `celery inspect` and `celery purge` for the queues themselves
+func queue(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		queueUsage(stderr)
+		return 2
+	}
+
+	cmd, ok := queueCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "celery-go: unknown queue command %q\n", args[0])
+		queueUsage(stderr)
+		return 2
+	}
+
+	return cmd.run(args[1:], stdout, stderr)
+}
+
+func queueUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: celery-go queue <len|peek|purge|move> [flags] <queue>...")
+
+	for _, name := range []string{"len", "peek", "purge", "move"} {
+		fmt.Fprintf(w, "  %-8s %s\n", name, queueCommands[name].usage)
+	}
+}
+
+// Parses the flags of a queue command expecting nargs queue names,
+// at least one when negative, returns the broker once
+// dialed, or the exit status when the command cannot run
+func queueBroker(flags *flag.FlagSet, broker *string, args []string, nargs int, usage string, stderr io.Writer) (celery.QueueBroker, int) {
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: celery-go queue "+usage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, 2
+	}
+
+	if nargs < 0 && flags.NArg() == 0 || nargs > 0 && flags.NArg() != nargs {
+		flags.Usage()
+		return nil, 2
+	}
+
+	b, err := dialBroker(*broker)
+	if err != nil {
+		fmt.Fprintf(stderr, "celery-go: %v\n", err)
+		return nil, 1
+	}
+
+	qb, ok := b.(celery.QueueBroker)
+	if !ok {
+		b.Close()
+		fmt.Fprintf(stderr, "celery-go: %v\n", errNoQueueAdmin)
+		return nil, 1
+	}
+
+	return qb, 0
+}
+
+func queueLen(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("len", flag.ContinueOnError)
+	broker := flags.String("broker", brokerURL(), "broker URL")
+
+	b, status := queueBroker(flags, broker, args, -1, "len [flags] <queue>...", stderr)
+	if b == nil {
+		return status
+	}
+	defer b.Close()
+
+	for _, name := range flags.Args() {
+		n, err := b.QueueLen(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "celery-go: %s: %v\n", name, err)
+			return 1
+		}
+
+		fmt.Fprintf(stdout, "%s\t%d\n", name, n)
+	}
+
+	return 0
+}
+
+// Decoded task printed by peek, one JSON object per line
+type peekedTask struct {
+	ID      string                 `json:"id,omitempty"`
+	Task    string                 `json:"task,omitempty"`
+	Args    []interface{}          `json:"args,omitempty"`
+	KWArgs  map[string]interface{} `json:"kwargs,omitempty"`
+	Retries int                    `json:"retries,omitempty"`
+	ETA     *time.Time             `json:"eta,omitempty"`
+	Expires *time.Time             `json:"expires,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+func queuePeek(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("peek", flag.ContinueOnError)
+	broker := flags.String("broker", brokerURL(), "broker URL")
+	n := flags.Int("n", 10, "number of messages to print")
+
+	b, status := queueBroker(flags, broker, args, 1, "peek [flags] <queue>", stderr)
+	if b == nil {
+		return status
+	}
+	defer b.Close()
+
+	messages, err := b.Peek(flags.Arg(0), *n)
+	if err != nil {
+		fmt.Fprintf(stderr, "celery-go: %v\n", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(stdout)
+
+	for _, msg := range messages {
+		enc.Encode(peek(msg))
+	}
+
+	return 0
+}
+
+// Returns the printed form of a waiting message
+func peek(msg *celery.Message) peekedTask {
+	task, err := celery.DecodeTask(msg)
+	if err != nil && task.Task == "" {
+		return peekedTask{ID: msg.CorrelationId, Error: err.Error()}
+	}
+
+	p := peekedTask{ID: task.Id, Task: task.Task, Args: task.Args, KWArgs: task.KWArgs, Retries: task.Retries}
+
+	if !task.ETA.IsZero() {
+		p.ETA = &task.ETA
+	}
+
+	if !task.Expires.IsZero() {
+		p.Expires = &task.Expires
+	}
+
+	return p
+}
+
+func queuePurge(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	broker := flags.String("broker", brokerURL(), "broker URL")
+
+	b, status := queueBroker(flags, broker, args, 1, "purge [flags] <queue>", stderr)
+	if b == nil {
+		return status
+	}
+	defer b.Close()
+
+	n, err := b.Purge(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "celery-go: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "purged %d messages from %s\n", n, flags.Arg(0))
+
+	return 0
+}
+
+func queueMove(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("move", flag.ContinueOnError)
+	broker := flags.String("broker", brokerURL(), "broker URL")
+	n := flags.Int("n", 0, "number of messages to move, all the waiting ones by default")
+	idle := flags.Duration("idle", 5*time.Second, "time to wait for a message before giving up")
+
+	b, status := queueBroker(flags, broker, args, 2, "move [flags] <from queue> <to queue>", stderr)
+	if b == nil {
+		return status
+	}
+	defer b.Close()
+
+	from, to := flags.Arg(0), flags.Arg(1)
+
+	moved, err := move(b, from, to, *n, *idle)
+	fmt.Fprintf(stdout, "moved %d messages from %s to %s\n", moved, from, to)
+
+	if err != nil {
+		fmt.Fprintf(stderr, "celery-go: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// Moves up to n messages, or all the waiting ones when n is 0,
+// each message is acknowledged once published to the other queue,
+// gives up when no message was received for idle
+func move(b celery.QueueBroker, from, to string, n int, idle time.Duration) (int, error) {
+	if n <= 0 {
+		waiting, err := b.QueueLen(from)
+		if err != nil || waiting == 0 {
+			return 0, err
+		}
+
+		n = waiting
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var messages <-chan *celery.Message
+	var err error
+
+	if cb, ok := b.(celery.ContextBroker); ok {
+		messages, err = cb.ConsumeContext(ctx, from, "", from)
+	} else {
+		messages, err = b.Consume(from, "", from)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+
+	for moved < n {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return moved, nil
+			}
+
+			copied := *msg
+			copied.Acknowledger = nil
+
+			if err := b.Publish("", to, &copied); err != nil {
+				msg.Nack(true)
+				return moved, err
+			}
+
+			if err := msg.Ack(); err != nil {
+				return moved, err
+			}
+
+			moved++
+		case <-time.After(idle):
+			return moved, nil
+		}
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/bsphere/celery"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Memory broker kept open by the commands closing their broker
+type sharedBroker struct {
+	*celery.MemoryBroker
+}
+
+func (sharedBroker) Close() error { return nil }
+
+// Replaces the broker of the commands with a memory broker
+func memory(t *testing.T) *celery.MemoryBroker {
+	b := celery.NewMemoryBroker()
+
+	dial := dialBroker
+	dialBroker = func(url string) (celery.Broker, error) { return sharedBroker{b}, nil }
+	t.Cleanup(func() { dialBroker = dial })
+
+	return b
+}
+
+func TestQueue(t *testing.T) {
+	b := memory(t)
+	p := celery.NewPublisher(b)
+
+	for i := 0; i < 3; i++ {
+		x, _ := celery.NewTaskArgs("tasks.add", []interface{}{i, 1}, nil)
+		p.ApplyAsync(x, celery.WithQueue("math"))
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	if status := run([]string{"queue", "len", "math", "empty"}, &stdout, &stderr); status != 0 || stdout.String() != "math\t3\nempty\t0\n" {
+		t.Fatalf("len exited %d: %q %s", status, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	if status := run([]string{"queue", "peek", "-n", "2", "math"}, &stdout, &stderr); status != 0 {
+		t.Fatalf("peek exited %d: %s", status, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("peeked %q", lines)
+	}
+
+	var first peekedTask
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Task != "tasks.add" || len(first.Args) != 2 || first.Args[0] != 0.0 {
+		t.Errorf("peeked %q, %v", lines[0], err)
+	}
+
+	stdout.Reset()
+	if status := run([]string{"queue", "move", "-n", "2", "-idle", time.Second.String(), "math", "other"}, &stdout, &stderr); status != 0 {
+		t.Fatalf("move exited %d: %s", status, stderr.String())
+	}
+
+	if len(b.Messages("math")) != 1 || len(b.Messages("other")) != 2 || b.Unacked("math") != 0 {
+		t.Errorf("moved %d messages, %d left", len(b.Messages("other")), len(b.Messages("math")))
+	}
+
+	stdout.Reset()
+	if status := run([]string{"queue", "purge", "other"}, &stdout, &stderr); status != 0 || stdout.String() != "purged 2 messages from other\n" {
+		t.Errorf("purge exited %d: %q", status, stdout.String())
+	}
+
+	if status := run([]string{"queue", "move", "math"}, &stdout, &stderr); status != 2 {
+		t.Errorf("move without destination exited %d", status)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bsphere/celery"
+	"io"
+	"time"
+)
+
+// Publishes a task, the same as `celery call`,
+// prints the id of the published task
+func send(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: celery-go send [flags] <task name>")
+		flags.PrintDefaults()
+	}
+
+	broker := flags.String("broker", brokerURL(), "broker URL")
+	taskArgs := flags.String("args", "[]", "positional arguments as a JSON list")
+	kwargs := flags.String("kwargs", "{}", "keyword arguments as a JSON object")
+	queue := flags.String("queue", "celery", "queue the task is sent to through the default exchange")
+	exchange := flags.String("exchange", "", "exchange the task is sent to, with -routing-key")
+	key := flags.String("routing-key", "", "routing key of the task, used with -exchange")
+	countdown := flags.Float64("countdown", 0, "seconds to wait before executing the task")
+	eta := flags.String("eta", "", "time to execute the task at, in RFC 3339")
+	expires := flags.Float64("expires", 0, "seconds after which the task expires")
+	priority := flags.Uint("priority", 0, "message priority, 0 to 255")
+	id := flags.String("id", "", "task id, a new UUID by default")
+	protocol := flags.Int("protocol", celery.ProtocolV2, "message protocol version, 1 or 2")
+	serializer := flags.String("serializer", "", "registered serializer of the message body, JSON by default")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 || *priority > 255 {
+		flags.Usage()
+		return 2
+	}
+
+	var positional []interface{}
+	if err := decodeJSON(*taskArgs, &positional); err != nil {
+		fmt.Fprintf(stderr, "celery-go: invalid -args: %v\n", err)
+		return 2
+	}
+
+	var keywords map[string]interface{}
+	if err := decodeJSON(*kwargs, &keywords); err != nil {
+		fmt.Fprintf(stderr, "celery-go: invalid -kwargs: %v\n", err)
+		return 2
+	}
+
+	task, err := celery.NewTaskArgs(flags.Arg(0), positional, keywords)
+	if err != nil {
+		fmt.Fprintf(stderr, "celery-go: %v\n", err)
+		return 1
+	}
+
+	opts := []celery.PublishOption{celery.WithQueue(*queue)}
+
+	if *exchange != "" || *key != "" {
+		opts = append(opts, celery.WithExchange(*exchange), celery.WithRoutingKey(*key))
+	}
+
+	if *countdown > 0 {
+		opts = append(opts, celery.WithCountdown(seconds(*countdown)))
+	}
+
+	if *eta != "" {
+		t, err := time.Parse(time.RFC3339, *eta)
+		if err != nil {
+			fmt.Fprintf(stderr, "celery-go: invalid -eta: %v\n", err)
+			return 2
+		}
+
+		opts = append(opts, celery.WithETA(t))
+	}
+
+	if *expires > 0 {
+		opts = append(opts, celery.WithExpiresIn(seconds(*expires)))
+	}
+
+	if *priority > 0 {
+		opts = append(opts, celery.WithPriority(uint8(*priority)))
+	}
+
+	if *id != "" {
+		task.Id = *id
+	}
+
+	if *serializer != "" {
+		opts = append(opts, celery.WithSerializer(*serializer))
+	}
+
+	b, err := dialBroker(*broker)
+	if err != nil {
+		fmt.Fprintf(stderr, "celery-go: %v\n", err)
+		return 1
+	}
+	defer b.Close()
+
+	p := celery.NewPublisher(b)
+	p.Protocol = *protocol
+
+	if err := p.ApplyAsync(task, opts...); err != nil {
+		fmt.Fprintf(stderr, "celery-go: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, task.Id)
+
+	return 0
+}
+
+// Decodes a JSON flag value keeping numbers as they were given
+func decodeJSON(value string, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader([]byte(value)))
+	d.UseNumber()
+
+	return d.Decode(v)
+}
+
+// Returns a duration given in seconds
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
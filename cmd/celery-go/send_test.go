@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"github.com/bsphere/celery"
+	"github.com/bsphere/celery/celerytest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Replaces the broker of the commands with a recorder
+func record(t *testing.T) *celerytest.Recorder {
+	r := celerytest.NewRecorder()
+
+	dial := dialBroker
+	dialBroker = func(url string) (celery.Broker, error) { return r, nil }
+	t.Cleanup(func() { dialBroker = dial })
+
+	return r
+}
+
+func TestSend(t *testing.T) {
+	r := record(t)
+
+	var stdout, stderr bytes.Buffer
+
+	status := run([]string{"send", "-args", "[2, 3.5]", "-kwargs", `{"round": true}`, "-queue", "math",
+		"-countdown", "60", "-priority", "5", "-id", "abc", "tasks.add"}, &stdout, &stderr)
+
+	if status != 0 || strings.TrimSpace(stdout.String()) != "abc" {
+		t.Fatalf("exited %d: %s%s", status, stdout.String(), stderr.String())
+	}
+
+	task := r.AssertPublished(t, "tasks.add",
+		celerytest.WithArgs(2, 3.5),
+		celerytest.WithKWArgs(map[string]interface{}{"round": true}),
+		celerytest.WithQueue("math"))
+
+	if task == nil || task.Id != "abc" || task.Priority != 5 || time.Until(task.ETA) < 50*time.Second {
+		t.Errorf("published %+v", task)
+	}
+}
+
+func TestSendUsage(t *testing.T) {
+	record(t)
+
+	var stdout, stderr bytes.Buffer
+
+	if status := run([]string{"send", "-args", "{", "tasks.add"}, &stdout, &stderr); status != 2 {
+		t.Errorf("invalid args exited %d", status)
+	}
+
+	if status := run([]string{"send"}, &stdout, &stderr); status != 2 {
+		t.Errorf("missing task name exited %d", status)
+	}
+
+	if status := run([]string{"unknown"}, &stdout, &stderr); status != 2 || !strings.Contains(stderr.String(), "send") {
+		t.Errorf("unknown command exited %d", status)
+	}
+}
@@ -0,0 +1,121 @@
+package celery
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// Content type of Kombu's zlib compression, registered as zlib and gzip
+const CompressionZlib = "application/x-gzip"
+
+// Compresses and decompresses message bodies
+type Compressor interface {
+	Compress(body []byte) ([]byte, error)
+	Decompress(body []byte) ([]byte, error)
+}
+
+// Compressors by content type and names to content types,
+// the same names as Kombu's compression registry
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{}
+	compressions  = map[string]string{}
+)
+
+// Compresses bodies with zlib the way Kombu does
+type zlibCompressor struct{}
+
+func init() {
+	RegisterCompressor(CompressionZlib, zlibCompressor{}, "zlib", "gzip")
+}
+
+// Registers a compressor for a content type, it is also looked up
+// by content type or by any of its names when publishing
+func RegisterCompressor(contentType string, c Compressor, names ...string) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+
+	compressors[contentType] = c
+	compressions[contentType] = contentType
+
+	for _, name := range names {
+		compressions[name] = contentType
+	}
+}
+
+// Returns the content type and compressor of a compression name or content type
+func compressor(name string) (string, Compressor, error) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+
+	contentType, ok := compressions[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown compression %q", name)
+	}
+
+	return contentType, compressors[contentType], nil
+}
+
+// Compresses the message body, the content type of the compression
+// is set in the compression header, as Kombu does
+func compress(msg *Message, name string) error {
+	contentType, c, err := compressor(name)
+	if err != nil {
+		return err
+	}
+
+	if msg.Body, err = c.Compress(msg.Body); err != nil {
+		return err
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = map[string]interface{}{}
+	}
+
+	msg.Headers["compression"] = contentType
+
+	return nil
+}
+
+// Decompresses the body of a message with a compression header
+func decompress(msg *Message) ([]byte, error) {
+	name, _ := msg.Headers["compression"].(string)
+	if name == "" {
+		return msg.Body, nil
+	}
+
+	_, c, err := compressor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Decompress(msg.Body)
+}
+
+func (zlibCompressor) Compress(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (zlibCompressor) Decompress(body []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
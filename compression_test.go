@@ -0,0 +1,57 @@
+package celery
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	x, err := NewTaskArgs("task name", []interface{}{"a", "b"}, map[string]interface{}{"c": "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &recordingBroker{}
+	p := NewPublisher(b)
+	p.Compression = "zlib"
+
+	for _, protocol := range []int{ProtocolV1, ProtocolV2} {
+		p.Protocol = protocol
+
+		if err := p.Publish(x, "", "celery"); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := b.messages[len(b.messages)-1]
+		if msg.Headers["compression"] != CompressionZlib {
+			t.Errorf("compression header %v", msg.Headers["compression"])
+		}
+
+		r, err := zlib.NewReader(bytes.NewReader(msg.Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+
+		task, err := DecodeTask(msg)
+		if task.Task != "task name" || task.Id != x.Id {
+			t.Fatal(task, err)
+		}
+
+		if !reflect.DeepEqual(task.Args, x.Args) || !reflect.DeepEqual(task.KWArgs, x.KWArgs) {
+			t.Errorf("protocol %d decoded %v %v", protocol, task.Args, task.KWArgs)
+		}
+	}
+
+	p.Compression = "unknown"
+
+	if err := p.Publish(x, "", "celery"); err == nil {
+		t.Error("published with an unknown compression")
+	}
+}
@@ -0,0 +1,163 @@
+package celery
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("CELERY_BROKER_URL", "redis://localhost:6379/1")
+	t.Setenv("CELERY_TASK_DEFAULT_QUEUE", "jobs")
+	t.Setenv("CELERY_TASK_SERIALIZER", "msgpack")
+	t.Setenv("CELERY_WORKER_CONCURRENCY", "8")
+	t.Setenv("CELERY_TASK_SOFT_TIME_LIMIT", "1.5")
+
+	c, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DefaultConfig()
+	expected.BrokerURL = "redis://localhost:6379/1"
+	expected.DefaultQueue = "jobs"
+	expected.Serializer = "msgpack"
+	expected.Concurrency = 8
+	expected.SoftTimeLimit = 1500 * time.Millisecond
+
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("config %+v, expected %+v", c, expected)
+	}
+
+	t.Setenv("CELERY_TASK_TIME_LIMIT", "soon")
+
+	if _, err := ConfigFromEnv(); err == nil || err.Error() != `invalid CELERY_TASK_TIME_LIMIT: strconv.ParseFloat: parsing "soon": invalid syntax` {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestApp(t *testing.T) {
+	c := DefaultConfig()
+	c.BrokerURL = "memory://"
+	c.ResultBackend = "memory://"
+	c.DefaultQueue = "jobs"
+	c.Concurrency = 3
+	c.TimeLimit = time.Minute
+	c.Routes = TaskRoutes{{Pattern: "tasks.mul", Route: Route{Queue: "math"}}}
+
+	a, err := NewApp(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	w := a.Worker()
+	if w.Concurrency != 3 || w.TimeLimit != time.Minute || w.PrefetchMultiplier != defaultPrefetchMultiplier || w.Backend != a.Backend {
+		t.Errorf("worker %+v", w)
+	}
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	if err := a.Publisher.ApplyAsync(x); err != nil {
+		t.Fatal(err)
+	}
+
+	y, _ := NewTask("tasks.mul", nil, nil)
+	if err := a.Publisher.ApplyAsync(y); err != nil {
+		t.Fatal(err)
+	}
+
+	b := a.Broker.(*MemoryBroker)
+	if n, _ := b.QueueLen("jobs"); n != 1 {
+		t.Errorf("%d tasks in the default queue", n)
+	}
+
+	if n, _ := b.QueueLen("math"); n != 1 {
+		t.Errorf("%d tasks in the routed queue", n)
+	}
+
+	c.DefaultExchange = "tasks"
+	c.DefaultRoutingKey = "task.default"
+
+	if route := c.defaultRoute(); route != (Route{Exchange: "tasks", RoutingKey: "task.default"}) {
+		t.Errorf("default route %+v", route)
+	}
+
+	c.ResultBackend = "redis://localhost:6379/0"
+	c.ResultExpires = time.Hour
+
+	if a, err := NewApp(c); err != nil || a.Backend.(*RedisBackend).Expires != time.Hour {
+		t.Errorf("app %+v, %v", a, err)
+	}
+
+	c.ResultBackend = "couchdb://localhost"
+
+	if _, err := NewApp(c); err == nil {
+		t.Error("app with an unsupported backend")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "celeryconfig.yaml")
+
+	ioutil.WriteFile(path, []byte(`
+broker_url: redis://localhost:6379/0
+broker_transport_options:
+  visibility_timeout: 3600
+task_default_queue: default
+task_serializer: msgpack
+task_time_limit: 30
+task_routes:
+  email.*: {queue: email, priority: 3}
+  tasks.add: math
+  "*": {exchange: tasks, routing_key: task.other}
+accept_content: [json, msgpack]
+result_expires: null
+`), 0600)
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := DefaultConfig()
+	expected.BrokerURL = "redis://localhost:6379/0"
+	expected.TransportOptions = map[string]interface{}{"visibility_timeout": 3600}
+	expected.DefaultQueue = "default"
+	expected.Serializer = "msgpack"
+	expected.TimeLimit = 30 * time.Second
+	expected.ResultExpires = 0
+	expected.Routes = TaskRoutes{
+		{Pattern: "email.*", Route: Route{Queue: "email", Priority: 3}},
+		{Pattern: "tasks.add", Route: Route{Queue: "math"}},
+		{Pattern: "*", Route: Route{Exchange: "tasks", RoutingKey: "task.other"}},
+	}
+
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("config %+v, expected %+v", c, expected)
+	}
+
+	// the same settings as JSON, routes given as a list of dicts
+	err = c.Load([]byte(`{
+	"task_default_queue": "jobs",
+	"task_routes": [{"tasks.add": {"queue": "math"}}, {"*": "other"}]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if route, _ := c.Routes.Route("tasks.mul"); c.DefaultQueue != "jobs" || len(c.Routes) != 2 || route.Queue != "other" {
+		t.Errorf("config %+v", c)
+	}
+
+	t.Setenv("CELERY_TASK_ROUTES", `{"tasks.add": "math"}`)
+
+	if err := c.LoadEnv(); err != nil || len(c.Routes) != 1 || c.Routes[0].Route.Queue != "math" {
+		t.Errorf("routes %+v, %v", c.Routes, err)
+	}
+
+	if err := c.Load([]byte("task_default_queue: [a, b]")); err == nil || err.Error() != "invalid task_default_queue: expected a single value" {
+		t.Errorf("error %v", err)
+	}
+}
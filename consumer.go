@@ -0,0 +1,365 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Returns the protocol version of a consumed message,
+// protocol v2 messages carry the task name and id in their headers
+func protocolVersion(msg *Message) int {
+	if _, ok := msg.Headers["task"]; ok {
+		if _, ok := msg.Headers["id"]; ok {
+			return ProtocolV2
+		}
+	}
+
+	return ProtocolV1
+}
+
+// Decodes a consumed message into a task,
+// both protocol v1 and v2 messages are supported,
+// compressed bodies are decompressed first and bodies are
+// decoded with the serializer of their content type
+func DecodeTask(msg *Message) (*Task, error) {
+	task := &Task{}
+
+	body, err := decompress(msg)
+	if err != nil {
+		return task, err
+	}
+
+	if body, err = deserialize(msg.ContentType, body); err != nil {
+		return task, err
+	}
+
+	if protocolVersion(msg) == ProtocolV2 {
+		err = task.decodeV2(msg.Headers, body)
+	} else {
+		err = task.UnmarshalJSON(body)
+	}
+
+	task.ReplyTo = msg.ReplyTo
+	task.CorrelationID = msg.CorrelationId
+	task.Headers = msg.Headers
+	task.Priority = msg.Priority
+
+	return task, err
+}
+
+// Decodes protocol v2 headers and body into the task, the fields
+// that could not be decoded are reported together
+func (t *Task) decodeV2(headers map[string]interface{}, body []byte) error {
+	t.Task, _ = headers["task"].(string)
+	t.Id, _ = headers["id"].(string)
+	t.Shadow, _ = headers["shadow"].(string)
+	t.Origin, _ = headers["origin"].(string)
+	t.RootID, _ = headers["root_id"].(string)
+	t.ParentID, _ = headers["parent_id"].(string)
+	t.GroupID, _ = headers["group"].(string)
+	t.GroupIndex = headerInt(headers["group_index"])
+	t.Retries = headerInt(headers["retries"])
+	t.IgnoreResult, _ = headers["ignore_result"].(bool)
+
+	if limits, ok := headers["timelimit"].([]interface{}); ok && len(limits) == 2 {
+		t.TimeLimit = headerDuration(limits[0])
+		t.SoftTimeLimit = headerDuration(limits[1])
+	}
+
+	var (
+		errs []error
+		err  error
+	)
+
+	if t.ETA, err = headerTime(headers["eta"]); err != nil {
+		errs = append(errs, &FieldError{Field: "eta", Err: err})
+	}
+
+	if t.Expires, err = headerTime(headers["expires"]); err != nil {
+		errs = append(errs, &FieldError{Field: "expires", Err: err})
+	}
+
+	parts := []json.RawMessage{}
+	if err := json.Unmarshal(body, &parts); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	if len(parts) != 3 {
+		return errors.Join(append(errs, errors.New("protocol v2 body must be [args, kwargs, embed]"))...)
+	}
+
+	if err := unmarshalNumbers(parts[0], &t.Args); err != nil {
+		errs = append(errs, &FieldError{Field: "args", Err: err})
+	}
+
+	if err := unmarshalNumbers(parts[1], &t.KWArgs); err != nil {
+		errs = append(errs, &FieldError{Field: "kwargs", Err: err})
+	}
+
+	embed := struct {
+		Callbacks []*Signature `json:"callbacks"`
+		Errbacks  []*Signature `json:"errbacks"`
+		Chain     []*Signature `json:"chain"`
+		Chord     *Signature   `json:"chord"`
+	}{}
+
+	if err := json.Unmarshal(parts[2], &embed); err != nil {
+		errs = append(errs, &FieldError{Field: "embed", Err: err})
+	}
+
+	t.Callbacks = embed.Callbacks
+	t.Errbacks = embed.Errbacks
+	t.Chain = reverseChain(embed.Chain)
+	t.Chord = embed.Chord
+
+	return errors.Join(errs...)
+}
+
+// Returns an integer header value, headers may use any AMQP integer type
+func headerInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case byte:
+		return int(n)
+	case int8:
+		return int(n)
+	case int16:
+		return int(n)
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case json.Number:
+		i, _ := n.Int64()
+		return int(i)
+	}
+
+	return 0
+}
+
+// Returns a duration header value given in seconds, such as time limits
+func headerDuration(v interface{}) time.Duration {
+	switch n := v.(type) {
+	case float32:
+		return time.Duration(float64(n) * float64(time.Second))
+	case float64:
+		return time.Duration(n * float64(time.Second))
+	case json.Number:
+		f, _ := n.Float64()
+		return time.Duration(f * float64(time.Second))
+	}
+
+	return time.Duration(headerInt(v)) * time.Second
+}
+
+// Returns a time header value, a missing or null header is the zero time
+func headerTime(v interface{}) (time.Time, error) {
+	switch tv := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return tv, nil
+	case string:
+		if tv == "" {
+			return time.Time{}, nil
+		}
+
+		return parseTime(tv, time.UTC)
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported time header %T", v)
+}
+
+// Consumed message that could not be delivered as a task,
+// Message - the raw message,
+// Err - the decoding or settlement error
+type ConsumeError struct {
+	Message *Message
+	Err     error
+}
+
+func (e *ConsumeError) Error() string {
+	return "consume: " + e.Err.Error()
+}
+
+func (e *ConsumeError) Unwrap() error {
+	return e.Err
+}
+
+// Consumes the tasks of a broker queue,
+// AcksLate - send the tasks unacknowledged, the receiver settles them
+// with Ack or Nack, see ConsumeAcksLate,
+// Errors - optional channel the undecodable messages and the settlement
+// errors are reported to, undecodable messages are rejected without
+// requeue so queues with a dead letter exchange keep them,
+// the channel must be received from, errors are logged when unset,
+// Logger - optional logger, the package one by default
+type Consumer struct {
+	AcksLate bool
+	Errors   chan<- *ConsumeError
+	Logger   Logger
+
+	broker Broker
+}
+
+// Returns a pointer to a new consumer of b
+func NewConsumer(b Broker) *Consumer {
+	return &Consumer{broker: b}
+}
+
+// Consumes queue bound to exchange with key and sends its tasks to
+// messages until ctx is done or the broker is closed, messages is then
+// closed and ctx.Err() is returned
+func (c *Consumer) Consume(ctx context.Context, queue, exchange, key string, messages chan<- Task) error {
+	defer close(messages)
+
+	deliveries, err := consumeContext(ctx, c.broker, queue, exchange, key)
+	if err != nil {
+		return err
+	}
+
+	c.send(ctx, deliveries, messages)
+
+	return ctx.Err()
+}
+
+// Decodes deliveries and sends their tasks to messages until
+// deliveries is closed, tasks are acknowledged once sent unless
+// acks late, the task in flight when ctx is done is requeued
+func (c *Consumer) send(ctx context.Context, deliveries <-chan *Message, messages chan<- Task) {
+	for msg := range deliveries {
+		task, ok := c.decode(ctx, msg)
+		if !ok {
+			continue
+		}
+
+		if c.AcksLate {
+			task.ack = msg.Acknowledger
+		}
+
+		select {
+		case messages <- *task:
+			if !c.AcksLate {
+				if err := msg.Ack(); err != nil {
+					c.report(ctx, msg, err)
+				}
+			}
+		case <-ctx.Done():
+			msg.Nack(true)
+		}
+	}
+}
+
+// Returns the task of a consumed message, messages failing to decode
+// are reported and rejected
+func (c *Consumer) decode(ctx context.Context, msg *Message) (*Task, bool) {
+	task, err := DecodeTask(msg)
+	if err != nil {
+		c.report(ctx, msg, err)
+
+		if err := msg.Reject(false); err != nil {
+			c.report(ctx, msg, err)
+		}
+
+		return nil, false
+	}
+
+	return task, true
+}
+
+// Consumed task left unacknowledged, the receiver decides its outcome
+// with Ack, Nack or Reject,
+// Task - the decoded task,
+// Headers - headers of the message,
+// RoutingKey - routing key the message was published with,
+// Redelivered - whether the message was delivered before
+type Delivery struct {
+	Task        *Task
+	Headers     map[string]interface{}
+	RoutingKey  string
+	Redelivered bool
+
+	msg *Message
+}
+
+// Acknowledges the message, it is removed from its queue
+func (d Delivery) Ack() error {
+	return d.msg.Ack()
+}
+
+// Negatively acknowledges the message, requeued messages are
+// delivered again
+func (d Delivery) Nack(requeue bool) error {
+	return d.msg.Nack(requeue)
+}
+
+// Rejects the message without requeue, queues with a dead letter
+// exchange keep it there
+func (d Delivery) Reject() error {
+	return d.msg.Reject(false)
+}
+
+// Consumes queue bound to exchange with key and sends its tasks to
+// deliveries unacknowledged until ctx is done or the broker is closed,
+// deliveries is then closed and ctx.Err() is returned,
+// deliveries never settled are redelivered once the broker is closed
+func (c *Consumer) ConsumeDeliveries(ctx context.Context, queue, exchange, key string, deliveries chan<- Delivery) error {
+	defer close(deliveries)
+
+	messages, err := consumeContext(ctx, c.broker, queue, exchange, key)
+	if err != nil {
+		return err
+	}
+
+	c.deliver(ctx, messages, deliveries)
+
+	return ctx.Err()
+}
+
+// Decodes messages and sends them to deliveries until messages
+// is closed, the delivery in flight when ctx is done is requeued
+func (c *Consumer) deliver(ctx context.Context, messages <-chan *Message, deliveries chan<- Delivery) {
+	for msg := range messages {
+		task, ok := c.decode(ctx, msg)
+		if !ok {
+			continue
+		}
+
+		task.ack = msg.Acknowledger
+
+		d := Delivery{
+			Task:        task,
+			Headers:     msg.Headers,
+			RoutingKey:  msg.RoutingKey,
+			Redelivered: msg.Redelivered,
+			msg:         msg,
+		}
+
+		select {
+		case deliveries <- d:
+		case <-ctx.Done():
+			msg.Nack(true)
+		}
+	}
+}
+
+// Reports the error of a message to Errors or logs it
+func (c *Consumer) report(ctx context.Context, msg *Message, err error) {
+	e := &ConsumeError{Message: msg, Err: err}
+
+	if c.Errors == nil {
+		loggerOr(c.Logger).Warn("Failed to consume message", "error", err)
+		return
+	}
+
+	select {
+	case c.Errors <- e:
+	case <-ctx.Done():
+	}
+}
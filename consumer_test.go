@@ -0,0 +1,191 @@
+package celery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeTask(t *testing.T) {
+	x, err := NewTask("task name", []string{"1", "2"}, map[string]interface{}{"a": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x.Retries = 1
+	x.Expires = time.Date(2014, 1, 1, 12, 34, 56, 0, time.UTC)
+
+	for _, protocol := range []int{ProtocolV1, ProtocolV2} {
+		msg, err := x.message(protocol)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := &Message{Headers: msg.Headers, Body: msg.Body}
+		if protocolVersion(d) != protocol {
+			t.Errorf("protocol %d detected as %d", protocol, protocolVersion(d))
+		}
+
+		task, _ := DecodeTask(d)
+
+		if task.Task != x.Task || task.Id != x.Id || task.Retries != 1 {
+			t.Errorf("protocol %d: %+v", protocol, task)
+		}
+
+		if !reflect.DeepEqual(task.Args, x.Args) || !reflect.DeepEqual(task.KWArgs, x.KWArgs) {
+			t.Errorf("protocol %d: %+v", protocol, task)
+		}
+
+		if !task.Expires.Equal(x.Expires) || !task.ETA.IsZero() {
+			t.Errorf("protocol %d: %+v", protocol, task)
+		}
+	}
+}
+
+func TestDecodeTaskV2(t *testing.T) {
+	d := &Message{
+		Headers: map[string]interface{}{
+			"lang":    "py",
+			"task":    "tasks.add",
+			"id":      "123abc",
+			"retries": int32(3),
+			"eta":     "2014-01-01T12:34:56.123456",
+			"expires": nil,
+		},
+		ReplyTo: "reply",
+		Body:    []byte("[[\"1\"], {}, {\"callbacks\": null, \"errbacks\": null, \"chain\": null, \"chord\": null}]"),
+	}
+
+	task, err := DecodeTask(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Task != "tasks.add" || task.Id != "123abc" || task.Retries != 3 || task.ReplyTo != "reply" {
+		t.Fail()
+	}
+
+	expected, _ := time.Parse(timeFormat, "2014-01-01T12:34:56.123456")
+	if !task.ETA.Equal(expected) {
+		t.Fail()
+	}
+
+	d.Body = []byte("[[\"1\"], {}]")
+	if _, err := DecodeTask(d); err == nil {
+		t.Fail()
+	}
+}
+
+func TestDecodeTimeLimits(t *testing.T) {
+	x, _ := NewTask("tasks.add", nil, nil)
+	x.SoftTimeLimit = 1500 * time.Millisecond
+
+	msg, _ := x.message(ProtocolV2)
+	msg.Headers["timelimit"] = []interface{}{int32(30), 1.5}
+
+	task, err := DecodeTask(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.TimeLimit != 30*time.Second || task.SoftTimeLimit != 1500*time.Millisecond {
+		t.Errorf("time limits %v %v", task.TimeLimit, task.SoftTimeLimit)
+	}
+}
+
+func TestConsumerErrors(t *testing.T) {
+	b := &chanBroker{messages: make(chan *Message, 3)}
+
+	bad := &Message{ContentType: ContentTypeJSON, Body: []byte("not json"), Acknowledger: &ackRecorder{}}
+	b.messages <- bad
+
+	// a task name does not make a corrupt body usable
+	x, _ := NewTask("tasks.add", nil, nil)
+	corrupt, _ := delivery(t, x)
+	corrupt.Body = []byte("[1, {}, {}]")
+	b.messages <- corrupt
+
+	good, ack := delivery(t, x)
+	b.messages <- good
+	close(b.messages)
+
+	errs := make(chan *ConsumeError, 2)
+
+	c := NewConsumer(b)
+	c.Errors = errs
+
+	messages := make(chan Task, 2)
+	if err := c.Consume(context.Background(), "celery", "", "celery", messages); err != nil {
+		t.Fatal(err)
+	}
+
+	var tasks []Task
+	for task := range messages {
+		tasks = append(tasks, task)
+	}
+
+	if len(tasks) != 1 || tasks[0].Id != x.Id || !ack.acked {
+		t.Errorf("consumed %v", tasks)
+	}
+
+	e := <-errs
+	if e.Message != bad || e.Err == nil {
+		t.Errorf("reported %v", e)
+	}
+
+	if r := bad.Acknowledger.(*ackRecorder); !r.rejected || r.requeued {
+		t.Error("undecodable message not rejected")
+	}
+
+	if e := <-errs; e.Message != corrupt || e.Err == nil {
+		t.Errorf("reported %v", e)
+	}
+
+	if r := corrupt.Acknowledger.(*ackRecorder); !r.rejected || r.acked {
+		t.Error("corrupt message not rejected")
+	}
+}
+
+func TestConsumeDeliveries(t *testing.T) {
+	b := &chanBroker{messages: make(chan *Message, 3)}
+
+	var acks []*ackRecorder
+	for i := 0; i < 3; i++ {
+		x, _ := NewTask("tasks.add", nil, nil)
+		msg, ack := delivery(t, x)
+		msg.RoutingKey = "celery"
+		msg.Redelivered = i == 2
+		b.messages <- msg
+		acks = append(acks, ack)
+	}
+	close(b.messages)
+
+	deliveries := make(chan Delivery, 3)
+	if err := NewConsumer(b).ConsumeDeliveries(context.Background(), "celery", "", "celery", deliveries); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Delivery
+	for d := range deliveries {
+		got = append(got, d)
+	}
+
+	if len(got) != 3 || got[0].RoutingKey != "celery" || got[0].Headers == nil || !got[2].Redelivered {
+		t.Fatalf("delivered %v", got)
+	}
+
+	for _, a := range acks {
+		if a.acked || a.nacked || a.rejected {
+			t.Fatal("delivery settled by the consumer")
+		}
+	}
+
+	got[0].Ack()
+	got[1].Nack(true)
+	got[2].Reject()
+
+	if !acks[0].acked || !acks[1].nacked || !acks[1].requeued || !acks[2].rejected || acks[2].requeued {
+		t.Fail()
+	}
+}
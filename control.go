@@ -0,0 +1,348 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	pidboxExchange      = "celery.pidbox"
+	pidboxReplyExchange = "reply.celery.pidbox"
+	pidboxMessageTTL    = 300 * time.Second
+	pidboxQueueExpires  = 10 * time.Second
+	revokedTasksExpires = 3 * time.Hour
+)
+
+// Remote control client, broadcasts commands to the workers
+// through the pidbox exchange the same way celery.app.control does
+type Control struct {
+	broker Broker
+}
+
+// Remote control command, the Kombu mailbox message format,
+// Method - command name such as "revoke",
+// Arguments - command arguments,
+// Destination - optional names of the workers the command is sent to,
+// all of them by default,
+// ReplyTo - optional reply queue binding of the commands expecting replies,
+// Ticket - id of the command matching it with its replies
+type ControlCommand struct {
+	Method      string                 `json:"method"`
+	Arguments   map[string]interface{} `json:"arguments"`
+	Destination []string               `json:"destination"`
+	ReplyTo     *ControlReplyTo        `json:"reply_to,omitempty"`
+	Ticket      string                 `json:"ticket,omitempty"`
+}
+
+// Reply queue binding of a remote control command,
+// Exchange - reply exchange, reply.celery.pidbox,
+// RoutingKey - routing key of the client reply queue
+type ControlReplyTo struct {
+	Exchange   string `json:"exchange"`
+	RoutingKey string `json:"routing_key"`
+}
+
+// Returns a pointer to a new remote control client using b
+func NewControl(b Broker) *Control {
+	return &Control{broker: b}
+}
+
+// Broadcasts a command to the workers in destination, all when empty
+func (c *Control) Broadcast(method string, arguments map[string]interface{}, destination ...string) error {
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+
+	return c.publish(&ControlCommand{Method: method, Arguments: arguments, Destination: destination})
+}
+
+// Revokes tasks, workers skip them when received and cancel
+// the context of the running ones when terminate is set
+func (c *Control) Revoke(ids []string, terminate bool) error {
+	return c.Broadcast("revoke", map[string]interface{}{
+		"task_id":   ids,
+		"terminate": terminate,
+		"signal":    "SIGTERM",
+	})
+}
+
+func (c *Control) publish(cmd *ControlCommand) error {
+	body, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	msg := &Message{
+		ContentType:     ContentTypeJSON,
+		ContentEncoding: "utf-8",
+		DeliveryMode:    Transient,
+		Timestamp:       now,
+		Headers: map[string]interface{}{
+			"clock":   int64(1),
+			"expires": float64(now.Add(pidboxMessageTTL).UnixNano()) / float64(time.Second),
+		},
+		Body: body,
+	}
+
+	return c.broker.Publish(pidboxExchange, "", msg)
+}
+
+// Publishes the reply of a command to its reply queue, the body maps
+// the worker name to the reply and the ticket header matches the
+// command, the Kombu mailbox reply format,
+// the reply exchange is declared by the client
+func (w *Worker) reply(cmd *ControlCommand, reply interface{}) error {
+	if cmd.ReplyTo == nil {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{w.Hostname: reply})
+	if err != nil {
+		return err
+	}
+
+	exchange := cmd.ReplyTo.Exchange
+	if exchange == "" {
+		exchange = pidboxReplyExchange
+	}
+
+	msg := &Message{
+		ContentType:     ContentTypeJSON,
+		ContentEncoding: "utf-8",
+		DeliveryMode:    Transient,
+		Timestamp:       time.Now(),
+		Headers: map[string]interface{}{
+			"ticket": cmd.Ticket,
+			"clock":  int64(1),
+		},
+		Body: body,
+	}
+
+	return w.broker.Publish(exchange, cmd.ReplyTo.RoutingKey, msg)
+}
+
+// Returns the name of the worker pidbox queue
+func (w *Worker) pidboxQueue() string {
+	return w.Hostname + "." + pidboxExchange
+}
+
+// Declares the worker pidbox queue bound to the pidbox exchange
+// and consumes its commands until ctx is done
+func (w *Worker) control(ctx context.Context) error {
+	q := &Queue{
+		Name:         w.pidboxQueue(),
+		Exchange:     pidboxExchange,
+		ExchangeType: ExchangeFanout,
+		Args: map[string]interface{}{
+			"x-message-ttl": int(pidboxMessageTTL / time.Millisecond),
+			"x-expires":     int(pidboxQueueExpires / time.Millisecond),
+		},
+	}
+
+	if err := DeclareQueue(w.broker, q); err != nil {
+		return err
+	}
+
+	commands, err := consumeContext(ctx, w.broker, q.Name, pidboxExchange, "")
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for msg := range commands {
+			w.command(msg)
+			msg.Ack()
+		}
+	}()
+
+	return nil
+}
+
+// Executes a remote control command addressed to the worker
+func (w *Worker) command(msg *Message) {
+	cmd := &ControlCommand{}
+	if err := json.Unmarshal(msg.Body, cmd); err != nil {
+		w.logger().Warn("Failed to decode control command", "error", err)
+		return
+	}
+
+	if !cmd.addressedTo(w.Hostname) {
+		return
+	}
+
+	var reply interface{}
+
+	switch cmd.Method {
+	case "revoke":
+		terminate, _ := cmd.Arguments["terminate"].(bool)
+		ids := commandIDs(cmd.Arguments["task_id"])
+		w.revoke(ids, terminate)
+		reply = map[string]interface{}{"ok": "tasks " + strings.Join(ids, ", ") + " flagged as revoked"}
+	case "ping":
+		reply = map[string]interface{}{"ok": "pong"}
+	case "registered":
+		reply = w.registered()
+	case "active":
+		reply = w.activeRequests()
+	case "stats":
+		reply = w.stats()
+	default:
+		reply = map[string]interface{}{"error": fmt.Sprintf("No such control command: %s", cmd.Method)}
+	}
+
+	if err := w.reply(cmd, reply); err != nil {
+		w.logger().Error("Failed to reply to control command", "method", cmd.Method, "error", err)
+	}
+}
+
+// Returns the registered task names, the inspect registered reply
+func (w *Worker) registered() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	names := []string{}
+	for name := range w.handlers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Returns the tasks in progress in the format of Celery's
+// Request.info, the inspect active reply
+func (w *Worker) activeRequests() []map[string]interface{} {
+	w.runMu.Lock()
+	defer w.runMu.Unlock()
+
+	requests := []map[string]interface{}{}
+
+	for _, r := range w.running {
+		requests = append(requests, map[string]interface{}{
+			"id":           r.task.Id,
+			"name":         r.task.name(),
+			"type":         r.task.Task,
+			"args":         r.task.Args,
+			"kwargs":       r.task.KWArgs,
+			"hostname":     w.Hostname,
+			"time_start":   float64(r.started.UnixNano()) / float64(time.Second),
+			"acknowledged": false,
+			"delivery_info": map[string]interface{}{
+				"exchange":    w.exchange,
+				"routing_key": w.key,
+				"priority":    r.task.Priority,
+				"redelivered": false,
+			},
+			"worker_pid": os.Getpid(),
+		})
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i]["time_start"].(float64) < requests[j]["time_start"].(float64)
+	})
+
+	return requests
+}
+
+// Returns the worker statistics, the inspect stats reply
+func (w *Worker) stats() map[string]interface{} {
+	w.runMu.Lock()
+	total := map[string]interface{}{}
+	for name, n := range w.processed {
+		total[name] = n
+	}
+	w.runMu.Unlock()
+
+	concurrency := w.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return map[string]interface{}{
+		"total":          total,
+		"pid":            os.Getpid(),
+		"clock":          "1",
+		"uptime":         int(time.Since(w.started).Seconds()),
+		"prefetch_count": concurrency * w.PrefetchMultiplier,
+		"pool": map[string]interface{}{
+			"implementation":  "goroutines",
+			"max-concurrency": concurrency,
+		},
+	}
+}
+
+func (cmd *ControlCommand) addressedTo(hostname string) bool {
+	if len(cmd.Destination) == 0 {
+		return true
+	}
+
+	for _, d := range cmd.Destination {
+		if d == hostname {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the task ids of a revoke command, a single id or a list
+func commandIDs(v interface{}) []string {
+	switch ids := v.(type) {
+	case string:
+		return []string{ids}
+	case []interface{}:
+		var s []string
+		for _, id := range ids {
+			if id, ok := id.(string); ok {
+				s = append(s, id)
+			}
+		}
+
+		return s
+	}
+
+	return nil
+}
+
+// Records revoked task ids, the contexts of the running ones
+// are cancelled when terminate is set,
+// ids are forgotten after 3 hours as Celery does
+func (w *Worker) revoke(ids []string, terminate bool) {
+	w.runMu.Lock()
+	defer w.runMu.Unlock()
+
+	now := time.Now()
+
+	for id, revoked := range w.revoked {
+		if now.Sub(revoked) > revokedTasksExpires {
+			delete(w.revoked, id)
+		}
+	}
+
+	for _, id := range ids {
+		w.revoked[id] = now
+
+		if r, ok := w.running[id]; ok && terminate {
+			w.logger().Info("Terminating revoked task", "id", id)
+			r.cancel()
+		}
+	}
+}
+
+// Returns whether a task was revoked
+func (w *Worker) isRevoked(id string) bool {
+	w.runMu.Lock()
+	defer w.runMu.Unlock()
+
+	_, ok := w.revoked[id]
+
+	return ok
+}
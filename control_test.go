@@ -0,0 +1,160 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestControlRevoke(t *testing.T) {
+	b := &routedBroker{}
+
+	if err := NewControl(b).Revoke([]string{"1234"}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.exchanges[0] != pidboxExchange || b.keys[0] != "" {
+		t.Errorf("published to %q with key %q", b.exchanges[0], b.keys[0])
+	}
+
+	cmd := map[string]interface{}{}
+	if err := json.Unmarshal(b.messages[0].Body, &cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"method":      "revoke",
+		"arguments":   map[string]interface{}{"task_id": []interface{}{"1234"}, "terminate": true, "signal": "SIGTERM"},
+		"destination": nil,
+	}
+	if !reflect.DeepEqual(cmd, expected) {
+		t.Errorf("command %v", cmd)
+	}
+}
+
+func TestWorkerRevoke(t *testing.T) {
+	_, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Hostname = "celery@test"
+
+	executed := false
+	w.Register("tasks.add", func(task *Task) (interface{}, error) {
+		executed = true
+		return nil, nil
+	})
+
+	terminated := make(chan error, 1)
+	started := make(chan struct{})
+	w.RegisterContext("tasks.long", func(ctx context.Context, task *Task) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		terminated <- ctx.Err()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := w.control(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	long, _ := NewTask("tasks.long", nil, nil)
+	msg, _ := delivery(t, long)
+	go w.dispatch(msg)
+	<-started
+
+	revoked, _ := NewTask("tasks.add", nil, nil)
+
+	c := NewControl(b)
+	if err := c.Broadcast("revoke", map[string]interface{}{"task_id": revoked.Id}, "celery@other"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Revoke([]string{revoked.Id, long.Id}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-terminated:
+		if err != context.Canceled {
+			t.Errorf("terminated with %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("revoked task not terminated")
+	}
+
+	msg, ack := delivery(t, revoked)
+	w.dispatch(msg)
+
+	if executed || !ack.acked {
+		t.Error("revoked task executed")
+	}
+}
+
+func TestWorkerInspect(t *testing.T) {
+	b := &routedBroker{}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Hostname = "celery@test"
+	w.Concurrency = 2
+	w.Register("tasks.add", func(task *Task) (interface{}, error) { return nil, nil })
+
+	add, _ := NewTask("tasks.add", nil, nil)
+	msg, _ := delivery(t, add)
+	w.dispatch(msg)
+
+	inspect := func(method string) interface{} {
+		cmd := &ControlCommand{
+			Method:    method,
+			Arguments: map[string]interface{}{},
+			ReplyTo:   &ControlReplyTo{Exchange: pidboxReplyExchange, RoutingKey: "reply-key"},
+			Ticket:    "ticket-" + method,
+		}
+
+		body, _ := json.Marshal(cmd)
+		w.command(&Message{Body: body})
+
+		i := len(b.messages) - 1
+		if b.exchanges[i] != pidboxReplyExchange || b.keys[i] != "reply-key" {
+			t.Errorf("replied to %q with key %q", b.exchanges[i], b.keys[i])
+		}
+
+		if ticket := b.messages[i].Headers["ticket"]; ticket != cmd.Ticket {
+			t.Errorf("reply ticket %v", ticket)
+		}
+
+		reply := map[string]interface{}{}
+		if err := json.Unmarshal(b.messages[i].Body, &reply); err != nil {
+			t.Fatal(err)
+		}
+
+		return reply["celery@test"]
+	}
+
+	if reply := inspect("ping"); !reflect.DeepEqual(reply, map[string]interface{}{"ok": "pong"}) {
+		t.Errorf("ping reply %v", reply)
+	}
+
+	if reply := inspect("registered"); !reflect.DeepEqual(reply, []interface{}{"tasks.add"}) {
+		t.Errorf("registered reply %v", reply)
+	}
+
+	if reply := inspect("active"); !reflect.DeepEqual(reply, []interface{}{}) {
+		t.Errorf("active reply %v", reply)
+	}
+
+	stats, _ := inspect("stats").(map[string]interface{})
+	if !reflect.DeepEqual(stats["total"], map[string]interface{}{"tasks.add": float64(1)}) {
+		t.Errorf("stats total %v", stats["total"])
+	}
+
+	if pool, _ := stats["pool"].(map[string]interface{}); pool["max-concurrency"] != float64(2) {
+		t.Errorf("stats pool %v", stats["pool"])
+	}
+}
@@ -0,0 +1,181 @@
+package celery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit of the search for the next run of a crontab schedule
+const crontabSearchYears = 5
+
+var weekdays = map[string]int{
+	"sun": 0, "sunday": 0,
+	"mon": 1, "monday": 1,
+	"tue": 2, "tuesday": 2,
+	"wed": 3, "wednesday": 3,
+	"thu": 4, "thursday": 4,
+	"fri": 5, "friday": 5,
+	"sat": 6, "saturday": 6,
+}
+
+// Schedule running a task at the matching minutes, the same as
+// Celery's crontab, a time matches when all its fields match,
+// including both the day of the month and the day of the week,
+// Location - time zone the fields are evaluated in,
+// the one of the previous run time by default
+type CrontabSchedule struct {
+	Location *time.Location
+
+	minute     uint64
+	hour       uint64
+	dayOfWeek  uint64
+	dayOfMonth uint64
+	month      uint64
+}
+
+// Returns a crontab schedule of Celery's crontab expressions, in the
+// order of the crontab arguments, with "*", numbers, lists "1,2",
+// ranges "1-5" and steps "*/15" or "1-10/2", days of the week are
+// counted from Sunday as 0 and may be names such as "mon-fri",
+// empty expressions match everything
+func Crontab(minute, hour, dayOfWeek, dayOfMonth, monthOfYear string) (*CrontabSchedule, error) {
+	c := &CrontabSchedule{}
+
+	fields := []struct {
+		name     string
+		expr     string
+		min, max int
+		set      *uint64
+	}{
+		{"minute", minute, 0, 59, &c.minute},
+		{"hour", hour, 0, 23, &c.hour},
+		{"day_of_week", dayOfWeek, 0, 6, &c.dayOfWeek},
+		{"day_of_month", dayOfMonth, 1, 31, &c.dayOfMonth},
+		{"month_of_year", monthOfYear, 1, 12, &c.month},
+	}
+
+	for _, f := range fields {
+		set, err := parseCronField(f.expr, f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crontab %s %q: %v", f.name, f.expr, err)
+		}
+
+		*f.set = set
+	}
+
+	return c, nil
+}
+
+// Returns the set of values of a crontab field expression
+func parseCronField(expr string, min, max int) (uint64, error) {
+	if expr == "" {
+		expr = "*"
+	}
+
+	var set uint64
+
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+
+			part, step = part[:i], n
+		}
+
+		first, last := min, max
+
+		switch {
+		case part == "*":
+		case strings.IndexByte(part, '-') > 0:
+			i := strings.IndexByte(part, '-')
+
+			var err error
+			if first, err = cronValue(part[:i], min, max); err != nil {
+				return 0, err
+			}
+
+			if last, err = cronValue(part[i+1:], min, max); err != nil {
+				return 0, err
+			}
+		default:
+			n, err := cronValue(part, min, max)
+			if err != nil {
+				return 0, err
+			}
+
+			first = n
+			if step == 1 {
+				last = n
+			}
+		}
+
+		if first > last {
+			return 0, fmt.Errorf("invalid range %q", part)
+		}
+
+		for v := first; v <= last; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// Returns a crontab field value, a number or a week day name
+func cronValue(s string, min, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		d, ok := weekdays[strings.ToLower(s)]
+		if !ok || max != 6 {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+
+		n = d
+	}
+
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", n, min, max)
+	}
+
+	return n, nil
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+// Returns the first matching minute after last,
+// the zero time when none matches within 5 years
+func (c *CrontabSchedule) Next(last time.Time) time.Time {
+	loc := c.Location
+	if loc == nil {
+		loc = last.Location()
+	}
+
+	t := last.In(loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(crontabSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !has(c.dayOfMonth, t.Day()) || !has(c.dayOfWeek, int(t.Weekday())):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !has(c.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
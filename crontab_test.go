@@ -0,0 +1,48 @@
+package celery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCrontab(t *testing.T) {
+	start := time.Date(2021, 3, 5, 10, 7, 30, 0, time.UTC) // Friday
+
+	cases := []struct {
+		minute, hour, dayOfWeek, dayOfMonth, month string
+		next                                       time.Time
+	}{
+		{"*", "*", "*", "*", "*", time.Date(2021, 3, 5, 10, 8, 0, 0, time.UTC)},
+		{"*/15", "*", "*", "*", "*", time.Date(2021, 3, 5, 10, 15, 0, 0, time.UTC)},
+		{"0", "0", "*", "*", "*", time.Date(2021, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{"30", "7", "mon-fri", "*", "*", time.Date(2021, 3, 8, 7, 30, 0, 0, time.UTC)},
+		{"0", "9,17", "*", "*", "*", time.Date(2021, 3, 5, 17, 0, 0, 0, time.UTC)},
+		{"0", "0", "*", "1", "1-12/3", time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0", "0", "sun", "1", "*", time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)},
+		{"5-10/5", "10", "*", "*", "*", time.Date(2021, 3, 5, 10, 10, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		s, err := Crontab(c.minute, c.hour, c.dayOfWeek, c.dayOfMonth, c.month)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if next := s.Next(start); !next.Equal(c.next) {
+			t.Errorf("crontab(%q, %q, %q, %q, %q) next run %v", c.minute, c.hour, c.dayOfWeek, c.dayOfMonth, c.month, next)
+		}
+	}
+}
+
+func TestCrontabInvalid(t *testing.T) {
+	for _, minute := range []string{"60", "a", "*/0", "10-5", "mon"} {
+		if _, err := Crontab(minute, "*", "*", "*", "*"); err == nil {
+			t.Errorf("crontab minute %q accepted", minute)
+		}
+	}
+
+	s, _ := Crontab("0", "0", "*", "31", "2")
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("February 31st next run %v", next)
+	}
+}
@@ -0,0 +1,365 @@
+package celery
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQL dialects of the database backend
+const (
+	DialectPostgres = "postgresql"
+	DialectMySQL    = "mysql"
+	DialectSQLite   = "sqlite"
+)
+
+// Tables of Celery's database backend and the sequences of their ids
+const (
+	defaultTaskTable  = "celery_taskmeta"
+	defaultGroupTable = "celery_tasksetmeta"
+	taskSequence      = "task_id_sequence"
+	groupSequence     = "taskset_id_sequence"
+)
+
+// Format of the sqlite date_done column read by SQLAlchemy
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000"
+
+// Error of the group results not found in a backend
+var ErrGroupNotFound = errors.New("group result not found")
+
+// SQL result backend, the same as Celery's database backend, results
+// are stored in the celery_taskmeta and celery_tasksetmeta tables
+// SQLAlchemy creates, their result columns pickled as Celery's
+// PickleType columns,
+// TaskTable - table of the task results, Celery's database_table_names
+// task name,
+// GroupTable - table of the group results, Celery's database_table_names
+// group name,
+// Expires - time the results are kept, applied by Cleanup
+type DatabaseBackend struct {
+	TaskTable  string
+	GroupTable string
+	Expires    time.Duration
+
+	db      *sql.DB
+	dialect string
+}
+
+// Returns a pointer to a new database backend using db, dialect is
+// one of DialectPostgres, DialectMySQL and DialectSQLite
+func NewDatabaseBackend(db *sql.DB, dialect string) *DatabaseBackend {
+	return &DatabaseBackend{
+		TaskTable:  defaultTaskTable,
+		GroupTable: defaultGroupTable,
+		Expires:    defaultResultExpires,
+		db:         db,
+		dialect:    dialect,
+	}
+}
+
+// Creates the result tables when missing, with the columns
+// SQLAlchemy creates for Celery, the ids are numbered by the
+// sequences of the models on Postgres
+func (b *DatabaseBackend) CreateTables() error {
+	blob, datetime, id := "BLOB", "DATETIME", "INTEGER NOT NULL"
+
+	switch b.dialect {
+	case DialectPostgres:
+		blob, datetime = "BYTEA", "TIMESTAMP WITHOUT TIME ZONE"
+
+		for _, sequence := range []string{taskSequence, groupSequence} {
+			if _, err := b.db.Exec("CREATE SEQUENCE IF NOT EXISTS " + sequence); err != nil {
+				return err
+			}
+		}
+	case DialectMySQL:
+		id = "INTEGER NOT NULL AUTO_INCREMENT"
+	}
+
+	stmts := []string{
+		"CREATE TABLE IF NOT EXISTS " + b.TaskTable + " (" +
+			"id " + id + ", " +
+			"task_id VARCHAR(155), " +
+			"status VARCHAR(50), " +
+			"result " + blob + ", " +
+			"date_done " + datetime + ", " +
+			"traceback TEXT, " +
+			"PRIMARY KEY (id), " +
+			"UNIQUE (task_id))",
+		"CREATE TABLE IF NOT EXISTS " + b.GroupTable + " (" +
+			"id " + id + ", " +
+			"taskset_id VARCHAR(155), " +
+			"result " + blob + ", " +
+			"date_done " + datetime + ", " +
+			"PRIMARY KEY (id), " +
+			"UNIQUE (taskset_id))",
+	}
+
+	for _, stmt := range stmts {
+		if _, err := b.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns q with the ? placeholders replaced by the ones of the dialect
+func (b *DatabaseBackend) query(q string) string {
+	if b.dialect != DialectPostgres {
+		return q
+	}
+
+	var sb strings.Builder
+
+	n := 0
+	for _, r := range q {
+		if r != '?' {
+			sb.WriteRune(r)
+			continue
+		}
+
+		n++
+		sb.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return sb.String()
+}
+
+// Returns the date_done value of t, naive UTC times as SQLAlchemy
+// stores them
+func (b *DatabaseBackend) timestamp(t time.Time) interface{} {
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	t = t.UTC()
+
+	if b.dialect == DialectSQLite {
+		return t.Format(sqliteTimeFormat)
+	}
+
+	return t
+}
+
+// Returns the statement inserting the row of table with the key column,
+// updating its columns when the key exists, ids are taken from sequence
+// on Postgres where Celery's tables have no id default
+func (b *DatabaseBackend) upsertQuery(table, column, sequence string, columns []string) string {
+	names := append([]string{column}, columns...)
+	values := "?" + strings.Repeat(", ?", len(columns))
+
+	if b.dialect == DialectPostgres {
+		names = append([]string{"id"}, names...)
+		values = "nextval('" + sequence + "'), " + values
+	}
+
+	updates := make([]string, len(columns))
+	for i, c := range columns {
+		if b.dialect == DialectMySQL {
+			updates[i] = c + " = VALUES(" + c + ")"
+		} else {
+			updates[i] = c + " = excluded." + c
+		}
+	}
+
+	q := "INSERT INTO " + table + " (" + strings.Join(names, ", ") + ") VALUES (" + values + ")"
+
+	if b.dialect == DialectMySQL {
+		q += " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	} else {
+		q += " ON CONFLICT (" + column + ") DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+
+	return b.query(q)
+}
+
+// Inserts the row of table with key in the key column, updating
+// it when it exists
+func (b *DatabaseBackend) upsert(table, column, sequence, key string, columns []string, values ...interface{}) error {
+	_, err := b.db.Exec(b.upsertQuery(table, column, sequence, columns), append([]interface{}{key}, values...)...)
+	return err
+}
+
+// Stores a task result
+func (b *DatabaseBackend) Store(meta *ResultMeta) error {
+	result, err := pickleDumps(meta.Result)
+	if err != nil {
+		return err
+	}
+
+	traceback := sql.NullString{String: meta.Traceback, Valid: meta.Traceback != ""}
+
+	return b.upsert(b.TaskTable, "task_id", taskSequence, meta.TaskId, []string{"status", "result", "date_done", "traceback"},
+		meta.Status, result, b.timestamp(meta.DateDone), traceback)
+}
+
+// Returns a task result, unknown tasks are reported as PENDING
+func (b *DatabaseBackend) Get(id string) (*ResultMeta, error) {
+	var (
+		status    sql.NullString
+		result    []byte
+		dateDone  interface{}
+		traceback sql.NullString
+	)
+
+	err := b.db.QueryRow(b.query("SELECT status, result, date_done, traceback FROM "+b.TaskTable+" WHERE task_id = ?"), id).
+		Scan(&status, &result, &dateDone, &traceback)
+	if err == sql.ErrNoRows {
+		return &ResultMeta{TaskId: id, Status: StatePending}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &ResultMeta{TaskId: id, Status: status.String, Traceback: traceback.String}
+
+	if meta.Status == "" {
+		meta.Status = StatePending
+	}
+
+	if len(result) > 0 {
+		value, err := pickleLoadObjects(result)
+		if err != nil {
+			return nil, err
+		}
+
+		meta.Result = pickleValue(value)
+	}
+
+	if meta.DateDone, err = parseDateDone(dateDone); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// Removes a task result
+func (b *DatabaseBackend) Forget(id string) error {
+	_, err := b.db.Exec(b.query("DELETE FROM "+b.TaskTable+" WHERE task_id = ?"), id)
+	return err
+}
+
+// Stores the ids of the tasks of a group, pickled as a Celery
+// GroupResult read back by GroupResult.restore
+func (b *DatabaseBackend) SaveGroup(r *GroupResult) error {
+	results := make([]interface{}, len(r.Results))
+	for i, result := range r.Results {
+		results[i] = &pickleObject{Module: "celery.result", Name: "AsyncResult", Args: []interface{}{result.Id}}
+	}
+
+	result, err := pickleDumps(&pickleObject{Module: "celery.result", Name: "GroupResult", Args: []interface{}{r.Id, results}})
+	if err != nil {
+		return err
+	}
+
+	return b.upsert(b.GroupTable, "taskset_id", groupSequence, r.Id, []string{"result", "date_done"}, result, b.timestamp(time.Time{}))
+}
+
+// Returns the results of a group saved by SaveGroup or by Celery's
+// GroupResult.save, ErrGroupNotFound when unknown
+func (b *DatabaseBackend) GetGroup(id string) (*GroupResult, error) {
+	var result []byte
+
+	err := b.db.QueryRow(b.query("SELECT result FROM "+b.GroupTable+" WHERE taskset_id = ?"), id).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := pickleLoadObjects(result)
+	if err != nil {
+		return nil, err
+	}
+
+	group, ok := value.(*pickleObject)
+	if !ok || len(group.Args) < 2 {
+		return nil, fmt.Errorf("invalid group result %v", value)
+	}
+
+	results, ok := group.Args[1].(*types.List)
+	if !ok {
+		return nil, fmt.Errorf("invalid group results %v", group.Args[1])
+	}
+
+	r := &GroupResult{Id: id}
+
+	for _, item := range *results {
+		result, ok := item.(*pickleObject)
+		if !ok || len(result.Args) == 0 {
+			return nil, fmt.Errorf("invalid group result %v", item)
+		}
+
+		taskId, ok := result.Args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid group result id %v", result.Args[0])
+		}
+
+		r.Results = append(r.Results, NewAsyncResult(taskId, b))
+	}
+
+	return r, nil
+}
+
+// Removes the results of a group, the results of its tasks are kept
+func (b *DatabaseBackend) ForgetGroup(id string) error {
+	_, err := b.db.Exec(b.query("DELETE FROM "+b.GroupTable+" WHERE taskset_id = ?"), id)
+	return err
+}
+
+// Sets the time results are kept
+func (b *DatabaseBackend) SetExpires(expires time.Duration) {
+	b.Expires = expires
+}
+
+// Removes the task and group results done before the expiry,
+// SQL databases do not expire rows
+func (b *DatabaseBackend) Cleanup() error {
+	if b.Expires <= 0 {
+		return nil
+	}
+
+	expired := b.timestamp(time.Now().Add(-b.Expires))
+
+	for _, table := range []string{b.TaskTable, b.GroupTable} {
+		if _, err := b.db.Exec(b.query("DELETE FROM "+table+" WHERE date_done < ?"), expired); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Closes the database
+func (b *DatabaseBackend) Close() error {
+	return b.db.Close()
+}
+
+// Returns the time of a date_done column, drivers scan it as a time
+// or as its text
+func parseDateDone(v interface{}) (time.Time, error) {
+	switch value := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return value.UTC(), nil
+	case []byte:
+		return parseDateDone(string(value))
+	case string:
+		for _, layout := range []string{sqliteTimeFormat, "2006-01-02 15:04:05", time.RFC3339Nano} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date_done %v", v)
+}
@@ -0,0 +1,187 @@
+package celery
+
+import "time"
+
+// Exchange types
+const (
+	ExchangeDirect = "direct"
+	ExchangeTopic  = "topic"
+	ExchangeFanout = "fanout"
+)
+
+// Queue types of RabbitMQ, the x-queue-type argument
+const (
+	QueueClassic = "classic"
+	QueueQuorum  = "quorum"
+)
+
+// Broker with exchanges,
+// DeclareExchange - creates a durable exchange of the given type,
+// BindQueue - routes the messages published to exchange with key to queue
+type ExchangeBroker interface {
+	Broker
+	DeclareExchange(name, kind string) error
+	BindQueue(queue, exchange, key string) error
+}
+
+// Celery queue, the same as a Kombu queue declaration,
+// Name - queue name,
+// Exchange - exchange the queue is bound to, none for the default exchange,
+// ExchangeType - type of the exchange, direct by default,
+// RoutingKey - binding key of the queue,
+// Bindings - optional additional binding keys of the queue, such as
+// the topic patterns reports.* and emails.#,
+// DeadLetterExchange - optional exchange rejected and expired messages
+// are republished to, the x-dead-letter-exchange argument,
+// DeadLetterRoutingKey - optional routing key of the dead letters,
+// their original routing key by default,
+// Type - optional queue type, such as QueueQuorum, the x-queue-type
+// argument, classic by default,
+// DeliveryLimit - optional number of times a message of a quorum queue
+// can be returned before being dead lettered or dropped by the broker,
+// the x-delivery-limit argument, give it to the workers consuming
+// the queue as their DeliveryLimit,
+// MessageTTL - optional time after which the messages waiting in the
+// queue are dropped or dead lettered, the x-message-ttl argument,
+// Expires - optional time after which the queue is deleted once unused,
+// the x-expires argument,
+// Exclusive - declare an exclusive queue deleted with the connection
+// of its consumer, for brokers supporting it, see ExclusiveQueueBroker,
+// Args - optional queue arguments such as x-max-priority
+type Queue struct {
+	Name                 string
+	Exchange             string
+	ExchangeType         string
+	RoutingKey           string
+	Bindings             []string
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	Type                 string
+	DeliveryLimit        int
+	MessageTTL           time.Duration
+	Expires              time.Duration
+	Exclusive            bool
+	Args                 map[string]interface{}
+}
+
+// Returns a pointer to a new queue bound to a direct exchange
+// and routing key of the same name, as Celery creates missing queues
+func NewQueue(name string) *Queue {
+	return &Queue{
+		Name:         name,
+		Exchange:     name,
+		ExchangeType: ExchangeDirect,
+		RoutingKey:   name,
+	}
+}
+
+// Returns a pointer to a new queue bound to a topic exchange with
+// patterns, * matches a word of the dotted routing keys and # any
+// number of words, such as reports.* for the tasks routed by
+// a TopicRouter
+func NewTopicQueue(name, exchange string, patterns ...string) *Queue {
+	q := &Queue{Name: name, Exchange: exchange, ExchangeType: ExchangeTopic}
+
+	if len(patterns) > 0 {
+		q.RoutingKey, q.Bindings = patterns[0], patterns[1:]
+	}
+
+	return q
+}
+
+// Returns a pointer to a new quorum queue the same as NewQueue,
+// messages returned more than deliveryLimit times are dead lettered,
+// unlimited when 0
+func NewQuorumQueue(name string, deliveryLimit int) *Queue {
+	q := NewQueue(name)
+	q.Type = QueueQuorum
+	q.DeliveryLimit = deliveryLimit
+
+	return q
+}
+
+// Declares an exchange, brokers without exchanges ignore it
+func DeclareExchange(b Broker, name, kind string) error {
+	eb, ok := b.(ExchangeBroker)
+	if !ok {
+		return nil
+	}
+
+	return eb.DeclareExchange(name, kind)
+}
+
+// Declares a queue and its exchange and binds them with every
+// binding key,
+// brokers without exchanges only declare the queue
+func DeclareQueue(b Broker, q *Queue) error {
+	declare := b.DeclareQueue
+	if xb, ok := b.(ExclusiveQueueBroker); ok && q.Exclusive {
+		declare = xb.DeclareExclusiveQueue
+	}
+
+	if err := declare(q.Name, q.args()); err != nil {
+		return err
+	}
+
+	eb, ok := b.(ExchangeBroker)
+	if !ok || q.Exchange == "" {
+		return nil
+	}
+
+	kind := q.ExchangeType
+	if kind == "" {
+		kind = ExchangeDirect
+	}
+
+	if err := eb.DeclareExchange(q.Exchange, kind); err != nil {
+		return err
+	}
+
+	for _, key := range append([]string{q.RoutingKey}, q.Bindings...) {
+		if err := eb.BindQueue(q.Name, q.Exchange, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the queue arguments, including the dead letter,
+// quorum and TTL ones
+func (q *Queue) args() map[string]interface{} {
+	if q.DeadLetterExchange == "" && q.DeadLetterRoutingKey == "" && q.Type == "" && q.DeliveryLimit == 0 &&
+		q.MessageTTL == 0 && q.Expires == 0 {
+		return q.Args
+	}
+
+	args := map[string]interface{}{}
+	for k, v := range q.Args {
+		args[k] = v
+	}
+
+	if q.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+
+	if q.Type != "" {
+		args["x-queue-type"] = q.Type
+	}
+
+	if q.DeliveryLimit > 0 {
+		args["x-delivery-limit"] = int64(q.DeliveryLimit)
+	}
+
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL.Milliseconds()
+	}
+
+	if q.Expires > 0 {
+		args["x-expires"] = q.Expires.Milliseconds()
+	}
+
+	return args
+}
@@ -0,0 +1,83 @@
+package celery
+
+import (
+	"testing"
+	"time"
+)
+
+type queueRecorder struct {
+	Broker
+	queues map[string]map[string]interface{}
+}
+
+func (b *queueRecorder) DeclareQueue(name string, args map[string]interface{}) error {
+	b.queues[name] = args
+	return nil
+}
+
+func TestDeclareQueue(t *testing.T) {
+	s, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	if err := DeclareQueue(b, NewQueue("email")); err != nil {
+		t.Fatal(err)
+	}
+
+	x, _ := NewTask("email.send", nil, nil)
+
+	if err := NewPublisher(b).Publish(x, "email", "email"); err != nil {
+		t.Fatal(err)
+	}
+
+	if items, _ := s.List("email"); len(items) != 1 {
+		t.Errorf("email queue holds %d messages", len(items))
+	}
+
+	r := &queueRecorder{queues: map[string]map[string]interface{}{}}
+	q := &Queue{Name: "video", Exchange: "media", Args: map[string]interface{}{"x-max-priority": 9}}
+
+	if err := DeclareQueue(r, q); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.queues["video"]["x-max-priority"] != 9 {
+		t.Errorf("declared %v", r.queues)
+	}
+}
+
+func TestDeadLetterQueueArgs(t *testing.T) {
+	q := NewQueue("celery")
+	q.Args = map[string]interface{}{"x-max-priority": 9}
+	q.DeadLetterExchange = "dlx"
+	q.DeadLetterRoutingKey = "celery.dead"
+
+	args := q.args()
+	if args["x-dead-letter-exchange"] != "dlx" || args["x-dead-letter-routing-key"] != "celery.dead" || args["x-max-priority"] != 9 {
+		t.Errorf("queue args %v", args)
+	}
+
+	if len(q.Args) != 1 {
+		t.Error("queue args modified")
+	}
+}
+
+func TestQueueArgs(t *testing.T) {
+	q := NewQuorumQueue("celery", 5)
+
+	args := q.args()
+	if args["x-queue-type"] != QueueQuorum || args["x-delivery-limit"] != int64(5) {
+		t.Errorf("queue args %v", args)
+	}
+
+	q.MessageTTL = time.Minute
+	q.Expires = time.Hour
+
+	if args := q.args(); args["x-message-ttl"] != int64(60000) || args["x-expires"] != int64(3600000) {
+		t.Errorf("queue args %v", args)
+	}
+
+	if args := NewQueue("celery").args(); args != nil {
+		t.Errorf("classic queue args %v", args)
+	}
+}
@@ -0,0 +1,91 @@
+package celery
+
+import (
+	"container/list"
+	"github.com/go-redis/redis"
+	"sync"
+	"time"
+)
+
+// Record of the tasks processed successfully, workers skip the
+// redelivered ones,
+// Seen - returns whether a task id was processed,
+// Done - records a processed task id
+type DedupeStore interface {
+	Seen(id string) (bool, error)
+	Done(id string) error
+}
+
+// In memory record of the last processed task ids
+type MemoryDedupe struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List
+	ids   map[string]*list.Element
+}
+
+// Returns a pointer to a new record of the last size task ids,
+// the least recently seen ones are forgotten first
+func NewMemoryDedupe(size int) *MemoryDedupe {
+	return &MemoryDedupe{size: size, order: list.New(), ids: make(map[string]*list.Element)}
+}
+
+// Returns whether a task id is recorded
+func (d *MemoryDedupe) Seen(id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, ok := d.ids[id]
+	if ok {
+		d.order.MoveToFront(e)
+	}
+
+	return ok, nil
+}
+
+// Records a task id, forgetting the oldest one when full
+func (d *MemoryDedupe) Done(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if e, ok := d.ids[id]; ok {
+		d.order.MoveToFront(e)
+		return nil
+	}
+
+	d.ids[id] = d.order.PushFront(id)
+
+	for d.size > 0 && d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.ids, oldest.Value.(string))
+	}
+
+	return nil
+}
+
+// Record of the processed task ids in Redis keys expiring after a ttl,
+// shared by the workers
+type RedisDedupe struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+// Returns a pointer to a new record of task ids stored in the keys
+// prefix<id> for ttl, 0 keeps them forever
+func NewRedisDedupe(client redis.UniversalClient, prefix string, ttl time.Duration) *RedisDedupe {
+	return &RedisDedupe{client: client, prefix: prefix, ttl: ttl}
+}
+
+// Returns whether the key of a task id exists
+func (d *RedisDedupe) Seen(id string) (bool, error) {
+	n, err := d.client.Exists(d.prefix + id).Result()
+	return n > 0, err
+}
+
+// Sets the key of a task id
+func (d *RedisDedupe) Done(id string) error {
+	return d.client.Set(d.prefix+id, 1, d.ttl).Err()
+}
@@ -0,0 +1,99 @@
+package celery
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDedupeStores(t *testing.T) {
+	_, client := newTestRedis(t)
+
+	for _, d := range []DedupeStore{NewMemoryDedupe(2), NewRedisDedupe(client, "celery-dedupe-", time.Hour)} {
+		if seen, err := d.Seen("1"); seen || err != nil {
+			t.Errorf("unprocessed task seen: %v", err)
+		}
+
+		if err := d.Done("1"); err != nil {
+			t.Fatal(err)
+		}
+
+		if seen, _ := d.Seen("1"); !seen {
+			t.Error("processed task not seen")
+		}
+	}
+}
+
+func TestMemoryDedupeEviction(t *testing.T) {
+	d := NewMemoryDedupe(2)
+	d.Done("1")
+	d.Done("2")
+	d.Seen("1")
+	d.Done("3")
+
+	if seen, _ := d.Seen("2"); seen {
+		t.Error("least recently seen id kept")
+	}
+
+	if seen, _ := d.Seen("1"); !seen {
+		t.Error("recently seen id forgotten")
+	}
+}
+
+func TestWorkerDedupe(t *testing.T) {
+	w := NewWorker(nil, "celery", "", "celery")
+	w.Dedupe = NewMemoryDedupe(10)
+
+	executed := 0
+	w.Register("tasks.add", func(task *Task) (interface{}, error) {
+		executed++
+		return nil, nil
+	})
+
+	x, _ := NewTask("tasks.add", nil, nil)
+
+	for i := 0; i < 2; i++ {
+		msg, ack := delivery(t, x)
+		w.dispatch(msg)
+
+		if !ack.acked {
+			t.Error("task not acked")
+		}
+	}
+
+	if executed != 1 {
+		t.Errorf("executed %d times", executed)
+	}
+}
+
+// Backend failing to store results
+type failingBackend struct {
+	ResultBackend
+}
+
+func (failingBackend) Store(meta *ResultMeta) error {
+	return errors.New("backend unavailable")
+}
+
+func TestWorkerDedupeStoreFailure(t *testing.T) {
+	w := NewWorker(nil, "celery", "", "celery")
+	w.Backend = failingBackend{}
+	w.Dedupe = NewMemoryDedupe(10)
+
+	executed := 0
+	w.Register("tasks.add", func(task *Task) (interface{}, error) {
+		executed++
+		return nil, nil
+	})
+
+	x, _ := NewTask("tasks.add", nil, nil)
+
+	for i := 0; i < 2; i++ {
+		msg, _ := delivery(t, x)
+		w.dispatch(msg)
+	}
+
+	if executed != 2 {
+		t.Errorf("task with a lost result executed %d times", executed)
+	}
+}
@@ -0,0 +1,319 @@
+package celery
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/go-redis/redis"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Returns a broker connected to a Celery broker URL,
+// amqp://, amqps:// and Kombu's pyamqp:// URLs dial an AMQPBroker,
+// redis:// and rediss:// URLs a RedisBroker, sentinel:// URLs a
+// RedisBroker connected to the master found by Redis Sentinel,
+// memory:// returns a new MemoryBroker
+func DialBroker(rawurl string) (Broker, error) {
+	return DialBrokerWithOptions(rawurl, nil)
+}
+
+// Same as DialBroker with Celery's broker_transport_options, such as
+// the master_name of Sentinel
+func DialBrokerWithOptions(rawurl string, opts map[string]interface{}) (Broker, error) {
+	if strings.HasPrefix(rawurl, "sentinel://") {
+		fo, err := sentinelOptions(rawurl, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRedisBroker(redis.NewFailoverClient(fo)), nil
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "amqp", "amqps":
+		return DialAMQPBroker(rawurl)
+	case "pyamqp":
+		return DialAMQPBroker("amqp" + strings.TrimPrefix(rawurl, "pyamqp"))
+	case "redis", "rediss":
+		opts, err := redis.ParseURL(rawurl)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRedisBroker(redis.NewClient(opts)), nil
+	case "memory":
+		return NewMemoryBroker(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+}
+
+// Returns a result backend connected to a Celery result_backend URL,
+// redis:// and rediss:// URLs return a RedisBackend, sentinel:// URLs a
+// RedisBackend connected to the master found by Redis Sentinel,
+// rediscluster://[:password@]host:port,host:port URLs a RedisBackend
+// of a Redis Cluster, see NewRedisClusterBackend,
+// cache+memcached://host:port;host:port/ URLs a MemcachedBackend,
+// db+ SQLAlchemy URLs of postgresql, mysql and sqlite databases a
+// DatabaseBackend, see databaseSource, s3://bucket/prefix URLs an
+// S3Backend, see s3Config, mongodb:// and mongodb+srv:// URLs a
+// MongoBackend,
+// memory:// and cache+memory:// a new MemoryBackend
+func DialBackend(rawurl string) (ResultBackend, error) {
+	return DialBackendWithOptions(rawurl, nil)
+}
+
+// Same as DialBackend with Celery's result_backend_transport_options,
+// such as the master_name of Sentinel
+func DialBackendWithOptions(rawurl string, opts map[string]interface{}) (ResultBackend, error) {
+	if strings.HasPrefix(rawurl, "sentinel://") {
+		fo, err := sentinelOptions(rawurl, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRedisBackend(redis.NewFailoverClient(fo)), nil
+	}
+
+	if strings.HasPrefix(rawurl, "cache+memcached://") {
+		servers := strings.Split(strings.Trim(strings.TrimPrefix(rawurl, "cache+memcached://"), "/"), ";")
+		return NewMemcachedBackend(memcache.New(servers...)), nil
+	}
+
+	if strings.HasPrefix(rawurl, "db+") {
+		dialect, dsn, err := databaseSource(strings.TrimPrefix(rawurl, "db+"))
+		if err != nil {
+			return nil, err
+		}
+
+		driver, err := databaseDriver(dialect)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewDatabaseBackend(db, dialect), nil
+	}
+
+	if strings.HasPrefix(rawurl, "rediscluster://") {
+		co, err := clusterOptions(rawurl)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRedisClusterBackend(co), nil
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "redis", "rediss":
+		opts, err := redis.ParseURL(rawurl)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRedisBackend(redis.NewClient(opts)), nil
+	case "memory", "cache+memory":
+		return NewMemoryBackend(), nil
+	case "mongodb", "mongodb+srv":
+		return DialMongoBackend(rawurl)
+	case "s3":
+		sess, err := session.NewSession(s3Config(u, opts))
+		if err != nil {
+			return nil, err
+		}
+
+		b := NewS3Backend(s3.New(sess), u.Host)
+		b.Prefix = strings.TrimPrefix(u.Path, "/")
+
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unsupported result backend scheme %q", u.Scheme)
+}
+
+// Returns the options of a Redis Sentinel client from a Kombu sentinel
+// URL, a semicolon separated list of sentinel://[:password@]host:port[/db]
+// URLs, the password and database of the first URL having them are
+// used for the master, the master name is the master_name transport
+// option, or the master_name query parameter of the URLs
+func sentinelOptions(rawurl string, opts map[string]interface{}) (*redis.FailoverOptions, error) {
+	fo := &redis.FailoverOptions{}
+
+	master, _ := opts["master_name"].(string)
+
+	for _, part := range strings.Split(rawurl, ";") {
+		u, err := url.Parse(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Scheme != "sentinel" || u.Host == "" {
+			return nil, fmt.Errorf("invalid sentinel URL %q", part)
+		}
+
+		fo.SentinelAddrs = append(fo.SentinelAddrs, u.Host)
+
+		if password, ok := u.User.Password(); ok && fo.Password == "" {
+			fo.Password = password
+		}
+
+		if db := strings.Trim(u.Path, "/"); db != "" && fo.DB == 0 {
+			if fo.DB, err = strconv.Atoi(db); err != nil {
+				return nil, fmt.Errorf("invalid sentinel database %q", db)
+			}
+		}
+
+		if master == "" {
+			master = u.Query().Get("master_name")
+		}
+	}
+
+	if master == "" {
+		return nil, errors.New("sentinel URL without master_name transport option")
+	}
+
+	fo.MasterName = master
+
+	return fo, nil
+}
+
+// Returns the options of a Redis Cluster client from a
+// rediscluster://[:password@]host:port,host:port URL listing
+// seed nodes of the cluster
+func clusterOptions(rawurl string) (*redis.ClusterOptions, error) {
+	co := &redis.ClusterOptions{}
+
+	nodes := strings.TrimSuffix(strings.TrimPrefix(rawurl, "rediscluster://"), "/")
+
+	if i := strings.LastIndex(nodes, "@"); i >= 0 {
+		auth := nodes[:i]
+		nodes = nodes[i+1:]
+
+		if j := strings.Index(auth, ":"); j >= 0 {
+			co.Password = auth[j+1:]
+		}
+	}
+
+	for _, addr := range strings.Split(nodes, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			co.Addrs = append(co.Addrs, addr)
+		}
+	}
+
+	if len(co.Addrs) == 0 {
+		return nil, fmt.Errorf("invalid cluster URL %q", rawurl)
+	}
+
+	return co, nil
+}
+
+// database/sql drivers of the dialects, the first one registered is used
+var databaseDrivers = map[string][]string{
+	DialectPostgres: {"pgx", "postgres"},
+	DialectMySQL:    {"mysql"},
+	DialectSQLite:   {"sqlite", "sqlite3"},
+}
+
+// Returns the dialect and driver data source of an SQLAlchemy URL,
+// postgresql:// URLs are passed as they are, mysql:// URLs become
+// user:password@tcp(host:port)/db DSNs parsing times, sqlite:///path
+// URLs the path of the file, an in-memory database without one,
+// the +driver of the scheme is ignored
+func databaseSource(rawurl string) (dialect, dsn string, err error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", "", err
+	}
+
+	dialect = strings.SplitN(u.Scheme, "+", 2)[0]
+
+	switch dialect {
+	case "postgresql", "postgres":
+		u.Scheme = "postgres"
+		return DialectPostgres, u.String(), nil
+	case DialectMySQL:
+		query := u.Query()
+		query.Set("parseTime", "true")
+
+		password, _ := u.User.Password()
+		auth := u.User.Username()
+		if password != "" {
+			auth += ":" + password
+		}
+
+		path := u.Path
+		if path == "" {
+			path = "/"
+		}
+
+		return DialectMySQL, auth + "@tcp(" + u.Host + ")" + path + "?" + query.Encode(), nil
+	case DialectSQLite:
+		path := strings.TrimPrefix(u.Path, "/")
+		if path == "" {
+			path = ":memory:"
+		}
+
+		return DialectSQLite, path, nil
+	}
+
+	return "", "", fmt.Errorf("unsupported database %q", u.Scheme)
+}
+
+// Returns the registered database/sql driver of dialect
+func databaseDriver(dialect string) (string, error) {
+	for _, name := range databaseDrivers[dialect] {
+		for _, driver := range sql.Drivers() {
+			if driver == name {
+				return name, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no database/sql driver registered for %s, one of %s is needed", dialect, strings.Join(databaseDrivers[dialect], ", "))
+}
+
+// Returns the AWS config of an s3:// URL, the region and endpoint_url
+// of S3 compatible storages are read from the transport options or
+// the query of the URL, paths are used for the buckets of endpoints
+func s3Config(u *url.URL, opts map[string]interface{}) *aws.Config {
+	c := aws.NewConfig()
+
+	option := func(name string) string {
+		if v, ok := opts[name].(string); ok {
+			return v
+		}
+
+		return u.Query().Get(name)
+	}
+
+	if region := option("region"); region != "" {
+		c.Region = aws.String(region)
+	}
+
+	if endpoint := option("endpoint_url"); endpoint != "" {
+		c.Endpoint = aws.String(endpoint)
+		c.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	return c
+}
@@ -0,0 +1,62 @@
+package celery
+
+// Broker executing the published tasks with the handlers of a worker
+// as they are published
+type eagerBroker struct {
+	worker *Worker
+}
+
+// Settles nothing, eager tasks have no message in a queue
+type eagerAcknowledger struct{}
+
+// Returns a pointer to a new publisher executing the tasks with the
+// handlers of w synchronously instead of publishing them, the same as
+// Celery's task_always_eager, tasks go through the serialization
+// of the publisher, ETAs are ignored, retries are executed right away
+// and the results are stored in the worker Backend, a new MemoryBackend
+// when unset, workers without a broker publish their linked tasks
+// and retries to the publisher
+func NewEagerPublisher(w *Worker) *Publisher {
+	b := &eagerBroker{worker: w}
+
+	if w.broker == nil {
+		w.broker = b
+	}
+
+	if w.Backend == nil {
+		w.Backend = NewMemoryBackend()
+	}
+
+	return NewPublisher(b)
+}
+
+// Executes the task of a message, the task failure is stored
+// in the worker backend rather than returned
+func (b *eagerBroker) Publish(exchange, key string, msg *Message) error {
+	executed := *msg
+	executed.Exchange = exchange
+	executed.RoutingKey = key
+	executed.Acknowledger = eagerAcknowledger{}
+
+	return b.worker.dispatch(&executed)
+}
+
+// Eager brokers deliver nothing, the tasks are never queued
+func (b *eagerBroker) Consume(queue, exchange, key string) (<-chan *Message, error) {
+	messages := make(chan *Message)
+	close(messages)
+
+	return messages, nil
+}
+
+func (b *eagerBroker) DeclareQueue(name string, args map[string]interface{}) error {
+	return nil
+}
+
+func (b *eagerBroker) Close() error {
+	return nil
+}
+
+func (eagerAcknowledger) Ack() error                { return nil }
+func (eagerAcknowledger) Nack(requeue bool) error   { return nil }
+func (eagerAcknowledger) Reject(requeue bool) error { return nil }
@@ -0,0 +1,69 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type addArgs struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func TestEagerPublisher(t *testing.T) {
+	w := NewWorker(nil, "celery", "", "celery")
+	w.Logger = NopLogger
+	w.MaxRetries = 2
+
+	attempts := 0
+	w.Register("tasks.flaky", func(task *Task) (interface{}, error) {
+		if attempts++; attempts < 3 {
+			return nil, errors.New("flaky")
+		}
+		return "done", nil
+	})
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+
+	add := Define[addArgs, int]("tasks.add")
+	add.Register(w, func(ctx context.Context, args addArgs) (int, error) {
+		return args.X + args.Y, nil
+	})
+
+	p := NewEagerPublisher(w)
+	add.Publisher, add.Backend = p, w.Backend
+
+	result, err := add.Delay(addArgs{X: 2, Y: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ready, _ := result.Ready(); !ready {
+		t.Fatal("eager task not executed on delay")
+	}
+
+	if sum, err := result.Get(context.Background()); err != nil || sum != 5 {
+		t.Errorf("got %v, %v", sum, err)
+	}
+
+	flaky, _ := NewTask("tasks.flaky", nil, nil)
+	if err := p.ApplyAsync(flaky); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := NewAsyncResult(flaky.Id, w.Backend).Get(context.Background()); err != nil || v != "done" || attempts != 3 {
+		t.Errorf("retried task got %v, %v after %d attempts", v, err, attempts)
+	}
+
+	failed, _ := NewTask("tasks.fail", nil, nil)
+	if err := p.ApplyAsync(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	var taskErr *TaskError
+	if _, err := NewAsyncResult(failed.Id, w.Backend).Get(context.Background()); !errors.As(err, &taskErr) {
+		t.Errorf("failed task got %v", err)
+	}
+}
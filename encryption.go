@@ -0,0 +1,163 @@
+package celery
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Content type of AES-GCM encrypted bodies
+const ContentTypeEncrypted = "application/x-celery-go-encrypted"
+
+// Provides the keys of an encrypted serializer,
+// keys are 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256
+type KeyProvider interface {
+	// Returns the id and key new bodies are encrypted with
+	EncryptionKey() (string, []byte, error)
+
+	// Returns the key with the given id, for bodies encrypted
+	// with the current key or with a key since rotated
+	DecryptionKey(id string) ([]byte, error)
+}
+
+// Key provider of a fixed set of keys,
+// Current - id of the encryption key,
+// Keys - keys by id
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// Encrypts bodies serialized with an inner serializer with AES-GCM,
+// the key id and inner content type are authenticated with the body,
+// Serializer - inner serializer name or content type, JSON by default
+type EncryptedSerializer struct {
+	Serializer string
+
+	keys KeyProvider
+}
+
+// Encrypted body, JSON encoded
+type encryptedBody struct {
+	Key             string `json:"key"`
+	ContentType     string `json:"content_type"`
+	ContentEncoding string `json:"content_encoding"`
+	Nonce           []byte `json:"nonce"`
+	Body            []byte `json:"body"`
+}
+
+// Returns a pointer to a new encrypted serializer using keys
+func NewEncryptedSerializer(keys KeyProvider) *EncryptedSerializer {
+	return &EncryptedSerializer{keys: keys}
+}
+
+// Registers s as the encrypted serializer and makes it the only
+// content type accepted by consumers, plaintext bodies are refused
+func SetupEncryption(s *EncryptedSerializer) error {
+	RegisterSerializer("encrypted", ContentTypeEncrypted, "binary", s)
+	return AcceptContent(ContentTypeEncrypted)
+}
+
+func (k *StaticKeys) EncryptionKey() (string, []byte, error) {
+	key, err := k.DecryptionKey(k.Current)
+	return k.Current, key, err
+}
+
+func (k *StaticKeys) DecryptionKey(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", id)
+	}
+
+	return key, nil
+}
+
+func (s *EncryptedSerializer) Marshal(v interface{}) ([]byte, error) {
+	e, err := serializer(s.Serializer)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := e.serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	id, key, err := s.keys.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := encryptedBody{
+		Key:             id,
+		ContentType:     e.contentType,
+		ContentEncoding: e.contentEncoding,
+		Nonce:           make([]byte, gcm.NonceSize()),
+	}
+
+	if _, err := io.ReadFull(rand.Reader, enc.Nonce); err != nil {
+		return nil, err
+	}
+
+	enc.Body = gcm.Seal(nil, enc.Nonce, body, enc.additionalData())
+
+	return json.Marshal(enc)
+}
+
+// Decrypts a body before decoding it with the serializer
+// of its inner content type
+func (s *EncryptedSerializer) Unmarshal(data []byte, v interface{}) error {
+	var enc encryptedBody
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+
+	key, err := s.keys.DecryptionKey(enc.Key)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	if len(enc.Nonce) != gcm.NonceSize() {
+		return errors.New("invalid encryption nonce")
+	}
+
+	body, err := gcm.Open(nil, enc.Nonce, enc.Body, enc.additionalData())
+	if err != nil {
+		return err
+	}
+
+	e, err := serializer(enc.ContentType)
+	if err != nil {
+		return err
+	}
+
+	return e.serializer.Unmarshal(body, v)
+}
+
+// Returns the data authenticated along with the body
+func (enc *encryptedBody) additionalData() []byte {
+	return []byte(enc.Key + authSep + enc.ContentType + authSep + enc.ContentEncoding)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,69 @@
+package celery
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEncryptedSerializer(t *testing.T) {
+	keys := &StaticKeys{
+		Current: "2",
+		Keys: map[string][]byte{
+			"1": bytes.Repeat([]byte{1}, 16),
+			"2": bytes.Repeat([]byte{2}, 32),
+		},
+	}
+
+	s := NewEncryptedSerializer(keys)
+	s.Serializer = "msgpack"
+
+	if err := SetupEncryption(s); err != nil {
+		t.Fatal(err)
+	}
+	defer AcceptContent()
+
+	x, _ := NewTaskArgs("tasks.add", []interface{}{"secret"}, map[string]interface{}{"b": "c"})
+
+	b := &recordingBroker{}
+	p := NewPublisher(b)
+	p.Serializer = "encrypted"
+
+	if err := p.Publish(x, "", "celery"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := b.messages[0]
+	if msg.ContentType != ContentTypeEncrypted || bytes.Contains(msg.Body, []byte("secret")) {
+		t.Fatalf("body not encrypted, %q", msg.Body)
+	}
+
+	enc := encryptedBody{}
+	if err := json.Unmarshal(msg.Body, &enc); err != nil || enc.Key != "2" || enc.ContentType != ContentTypeMsgpack {
+		t.Fatal(enc, err)
+	}
+
+	keys.Current = "1"
+
+	task, err := DecodeTask(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(task.Args, x.Args) || !reflect.DeepEqual(task.KWArgs, x.KWArgs) {
+		t.Errorf("decoded %v %v", task.Args, task.KWArgs)
+	}
+
+	enc.ContentType = ContentTypeJSON
+	msg.Body, _ = json.Marshal(enc)
+
+	if _, err := DecodeTask(msg); err == nil {
+		t.Error("decrypted a body with tampered metadata")
+	}
+
+	plain, _ := x.message(ProtocolV2)
+	if _, err := DecodeTask(plain); err == nil {
+		t.Error("plaintext body accepted")
+	}
+}
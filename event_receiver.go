@@ -0,0 +1,313 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nu7hatch/gouuid"
+	"strings"
+	"time"
+)
+
+// Celery's default event_queue_ttl and event_queue_expires
+const (
+	eventQueueTTL     = 5 * time.Second
+	eventQueueExpires = 60 * time.Second
+)
+
+// Celery monitoring event, one of the *Task... and *Worker... events
+// or *UnknownEvent
+type Event interface {
+	Header() EventHeader
+}
+
+// Fields common to all the events,
+// Type - event type such as "task-succeeded",
+// Hostname - node name of the sender,
+// Timestamp - seconds since the epoch the event was sent at,
+// UTCOffset - hours west of UTC of the sender,
+// PID - process id of the sender,
+// Clock - logical clock of the sender
+type EventHeader struct {
+	Type      string  `json:"type"`
+	Hostname  string  `json:"hostname"`
+	Timestamp float64 `json:"timestamp"`
+	UTCOffset int     `json:"utcoffset"`
+	PID       int     `json:"pid"`
+	Clock     int64   `json:"clock"`
+}
+
+// Returns the event header
+func (h EventHeader) Header() EventHeader {
+	return h
+}
+
+// Returns the time the event was sent at
+func (h EventHeader) Time() time.Time {
+	return time.Unix(0, int64(h.Timestamp*float64(time.Second)))
+}
+
+// task-sent event, Args, KWArgs are their reprs
+type TaskSent struct {
+	EventHeader
+	UUID       string `json:"uuid"`
+	Name       string `json:"name"`
+	Args       string `json:"args"`
+	KWArgs     string `json:"kwargs"`
+	Retries    int    `json:"retries"`
+	ETA        string `json:"eta"`
+	Expires    string `json:"expires"`
+	Queue      string `json:"queue"`
+	Exchange   string `json:"exchange"`
+	RoutingKey string `json:"routing_key"`
+	RootID     string `json:"root_id"`
+	ParentID   string `json:"parent_id"`
+}
+
+// task-received event, Args, KWArgs are their reprs
+type TaskReceived struct {
+	EventHeader
+	UUID     string `json:"uuid"`
+	Name     string `json:"name"`
+	Args     string `json:"args"`
+	KWArgs   string `json:"kwargs"`
+	Retries  int    `json:"retries"`
+	ETA      string `json:"eta"`
+	Expires  string `json:"expires"`
+	RootID   string `json:"root_id"`
+	ParentID string `json:"parent_id"`
+}
+
+// task-started event
+type TaskStarted struct {
+	EventHeader
+	UUID string `json:"uuid"`
+}
+
+// task-succeeded event, Result is its repr,
+// Runtime is the execution time in seconds
+type TaskSucceeded struct {
+	EventHeader
+	UUID    string  `json:"uuid"`
+	Result  string  `json:"result"`
+	Runtime float64 `json:"runtime"`
+}
+
+// task-failed event
+type TaskFailed struct {
+	EventHeader
+	UUID      string `json:"uuid"`
+	Exception string `json:"exception"`
+	Traceback string `json:"traceback"`
+}
+
+// task-retried event
+type TaskRetried struct {
+	EventHeader
+	UUID      string `json:"uuid"`
+	Exception string `json:"exception"`
+	Traceback string `json:"traceback"`
+}
+
+// task-revoked event
+type TaskRevoked struct {
+	EventHeader
+	UUID       string `json:"uuid"`
+	Terminated bool   `json:"terminated"`
+	Signum     int    `json:"signum"`
+	Expired    bool   `json:"expired"`
+}
+
+// Fields of the worker events,
+// Freq - heartbeat interval in seconds,
+// Active - number of tasks in progress,
+// Processed - number of tasks executed,
+// LoadAvg - system load averages
+type WorkerInfo struct {
+	Freq      float64   `json:"freq"`
+	SWIdent   string    `json:"sw_ident"`
+	SWVer     string    `json:"sw_ver"`
+	SWSys     string    `json:"sw_sys"`
+	Active    int       `json:"active"`
+	Processed int       `json:"processed"`
+	LoadAvg   []float64 `json:"loadavg"`
+}
+
+// worker-online event
+type WorkerOnline struct {
+	EventHeader
+	WorkerInfo
+}
+
+// worker-heartbeat event
+type WorkerHeartbeat struct {
+	EventHeader
+	WorkerInfo
+}
+
+// worker-offline event
+type WorkerOffline struct {
+	EventHeader
+	WorkerInfo
+}
+
+// Event of another type, with all its fields
+type UnknownEvent struct {
+	EventHeader
+	Fields map[string]interface{}
+}
+
+// Receives the Celery monitoring events from the celeryev exchange
+// through a temporary queue, the same way celery events does
+type EventReceiver struct {
+	broker Broker
+	keys   []string
+}
+
+// Returns a pointer to a new event receiver of the events matching
+// the routing key patterns, such as "task.#" or "worker.heartbeat",
+// all events by default
+func NewEventReceiver(b Broker, keys ...string) *EventReceiver {
+	if len(keys) == 0 {
+		keys = []string{"#"}
+	}
+
+	return &EventReceiver{broker: b, keys: keys}
+}
+
+// Declares the receiver queue and delivers the decoded events
+// until ctx is done or the broker is closed,
+// undecodable events are logged and dropped
+func (r *EventReceiver) Receive(ctx context.Context) (<-chan Event, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		Name:         "celeryev." + id.String(),
+		Exchange:     eventExchange,
+		ExchangeType: ExchangeTopic,
+		RoutingKey:   r.keys[0],
+		Args: map[string]interface{}{
+			"x-message-ttl": int(eventQueueTTL / time.Millisecond),
+			"x-expires":     int(eventQueueExpires / time.Millisecond),
+		},
+	}
+
+	if err := DeclareQueue(r.broker, q); err != nil {
+		return nil, err
+	}
+
+	if eb, ok := r.broker.(ExchangeBroker); ok {
+		for _, key := range r.keys[1:] {
+			if err := eb.BindQueue(q.Name, eventExchange, key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	messages, err := consumeContext(ctx, r.broker, q.Name, eventExchange, r.keys[0])
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+
+	go func() {
+		defer close(events)
+
+		for msg := range messages {
+			msg.Ack()
+
+			event, err := decodeEvent(msg)
+			if err != nil {
+				loggerOr(nil).Warn("Failed to decode event", "error", err)
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// Returns the typed event of a message
+func decodeEvent(msg *Message) (Event, error) {
+	body, err := decompress(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err = deserialize(msg.ContentType, body)
+	if err != nil {
+		return nil, err
+	}
+
+	h := EventHeader{}
+	if err := json.Unmarshal(body, &h); err != nil {
+		return nil, err
+	}
+
+	var event Event
+
+	switch h.Type {
+	case EventTaskSent:
+		event = &TaskSent{}
+	case EventTaskReceived:
+		event = &TaskReceived{}
+	case EventTaskStarted:
+		event = &TaskStarted{}
+	case EventTaskSucceeded:
+		event = &TaskSucceeded{}
+	case EventTaskFailed:
+		event = &TaskFailed{}
+	case EventTaskRetried:
+		event = &TaskRetried{}
+	case EventTaskRevoked:
+		event = &TaskRevoked{}
+	case EventWorkerOnline:
+		event = &WorkerOnline{}
+	case EventWorkerHeartbeat:
+		event = &WorkerHeartbeat{}
+	case EventWorkerOffline:
+		event = &WorkerOffline{}
+	default:
+		u := &UnknownEvent{EventHeader: h}
+		return u, json.Unmarshal(body, &u.Fields)
+	}
+
+	return event, json.Unmarshal(body, event)
+}
+
+// Returns whether a routing key matches a topic binding pattern,
+// "*" matches a word and "#" zero or more words
+func topicMatch(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+
+	if pattern[0] == "#" {
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(words) == 0 || (pattern[0] != "*" && pattern[0] != words[0]) {
+		return false
+	}
+
+	return matchWords(pattern[1:], words[1:])
+}
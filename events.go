@@ -0,0 +1,221 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exchange of the Celery monitoring events
+const eventExchange = "celeryev"
+
+// Celery's default worker heartbeat interval
+const defaultHeartbeatInterval = 2 * time.Second
+
+// Task event types
+const (
+	EventTaskSent      = "task-sent"
+	EventTaskReceived  = "task-received"
+	EventTaskStarted   = "task-started"
+	EventTaskSucceeded = "task-succeeded"
+	EventTaskFailed    = "task-failed"
+	EventTaskRetried   = "task-retried"
+	EventTaskRevoked   = "task-revoked"
+)
+
+// Worker event types
+const (
+	EventWorkerOnline    = "worker-online"
+	EventWorkerHeartbeat = "worker-heartbeat"
+	EventWorkerOffline   = "worker-offline"
+)
+
+// Publishes Celery monitoring events to the celeryev topic exchange,
+// the events Flower and celery events display,
+// Hostname - node name of the events sender
+type EventDispatcher struct {
+	Hostname string
+
+	broker Broker
+
+	mu       sync.Mutex
+	clock    int64
+	declared bool
+}
+
+// Returns a pointer to a new event dispatcher sending events
+// as hostname through b, gen<pid>@<host> when empty
+func NewEventDispatcher(b Broker, hostname string) *EventDispatcher {
+	if hostname == "" {
+		hostname = anonNodeName()
+	}
+
+	return &EventDispatcher{Hostname: hostname, broker: b}
+}
+
+// Sends an event of the given type with its fields,
+// the common hostname, timestamp, utcoffset, pid and clock fields
+// are added, the routing key is the type with dots,
+// a nil dispatcher sends nothing
+func (d *EventDispatcher) Send(kind string, fields map[string]interface{}) error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	if !d.declared {
+		if err := DeclareExchange(d.broker, eventExchange, ExchangeTopic); err != nil {
+			d.mu.Unlock()
+			return err
+		}
+
+		d.declared = true
+	}
+
+	d.clock++
+	clock := d.clock
+	d.mu.Unlock()
+
+	now := time.Now()
+	_, offset := now.Zone()
+
+	event := map[string]interface{}{}
+	for k, v := range fields {
+		event[k] = v
+	}
+
+	event["type"] = kind
+	event["hostname"] = d.Hostname
+	event["timestamp"] = float64(now.UnixNano()) / float64(time.Second)
+	event["utcoffset"] = -offset / 3600
+	event["pid"] = os.Getpid()
+	event["clock"] = clock
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := &Message{
+		ContentType:     ContentTypeJSON,
+		ContentEncoding: "utf-8",
+		DeliveryMode:    Transient,
+		Timestamp:       now,
+		Headers:         map[string]interface{}{"hostname": d.Hostname},
+		Body:            body,
+	}
+
+	return d.broker.Publish(eventExchange, strings.Replace(kind, "-", ".", -1), msg)
+}
+
+// Returns the fields of the task-sent and task-received events
+func (t *Task) eventFields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"uuid":      t.Id,
+		"name":      t.name(),
+		"args":      eventRepr(t.Args),
+		"kwargs":    eventRepr(t.KWArgs),
+		"retries":   t.Retries,
+		"eta":       nil,
+		"expires":   nil,
+		"root_id":   t.root(),
+		"parent_id": t.parent(),
+	}
+
+	if t.Origin != "" {
+		fields["origin"] = t.Origin
+	}
+
+	if eta := t.eta(); !eta.IsZero() {
+		fields["eta"] = eta.UTC().Format(isoTimeFormat)
+	}
+
+	if expires := t.expires(); !expires.IsZero() {
+		fields["expires"] = expires.UTC().Format(isoTimeFormat)
+	}
+
+	return fields
+}
+
+// Returns the text of an event value, Celery sends the reprs
+// of the arguments and results
+func eventRepr(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
+// Sends worker-online, a worker-heartbeat every HeartbeatInterval
+// until ctx is done and worker-offline, monitors consider workers
+// missing heartbeats offline
+func (w *Worker) heartbeat(ctx context.Context) {
+	interval := w.HeartbeatInterval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	w.event(EventWorkerOnline, w.workerFields(interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.event(EventWorkerHeartbeat, w.workerFields(interval))
+		case <-ctx.Done():
+			w.event(EventWorkerOffline, w.workerFields(interval))
+			return
+		}
+	}
+}
+
+// Returns the fields of the worker events
+func (w *Worker) workerFields(interval time.Duration) map[string]interface{} {
+	w.runMu.Lock()
+	processed := 0
+	for _, n := range w.processed {
+		processed += n
+	}
+	w.runMu.Unlock()
+
+	return map[string]interface{}{
+		"freq":      interval.Seconds(),
+		"sw_ident":  "go-celery",
+		"sw_ver":    runtime.Version(),
+		"sw_sys":    runtime.GOOS,
+		"active":    w.Active(),
+		"processed": processed,
+		"loadavg":   loadAverage(),
+	}
+}
+
+// Returns the 1, 5 and 15 minutes system load averages,
+// zeros where /proc/loadavg is not available
+func loadAverage() []float64 {
+	load := []float64{0, 0, 0}
+
+	b, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load
+	}
+
+	for i, f := range strings.Fields(string(b)) {
+		if i >= len(load) {
+			break
+		}
+
+		load[i], _ = strconv.ParseFloat(f, 64)
+	}
+
+	return load
+}
@@ -0,0 +1,174 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Returns the types of the events published to b
+func eventTypes(t *testing.T, b *routedBroker) []string {
+	var types []string
+
+	for i, msg := range b.messages {
+		if b.exchanges[i] != eventExchange {
+			continue
+		}
+
+		event := map[string]interface{}{}
+		if err := json.Unmarshal(msg.Body, &event); err != nil {
+			t.Fatal(err)
+		}
+
+		if event["hostname"] != "celery@test" || event["timestamp"] == nil {
+			t.Errorf("event %v", event)
+		}
+
+		types = append(types, event["type"].(string))
+	}
+
+	return types
+}
+
+func TestPublisherEvents(t *testing.T) {
+	b := &routedBroker{}
+
+	p := NewPublisher(b)
+	p.Events = NewEventDispatcher(b, "celery@test")
+
+	x, _ := NewTaskArgs("tasks.add", []interface{}{2, 3}, nil)
+	if err := p.Publish(x, "", "celery"); err != nil {
+		t.Fatal(err)
+	}
+
+	if types := eventTypes(t, b); !reflect.DeepEqual(types, []string{EventTaskSent}) {
+		t.Errorf("events %v", types)
+	}
+
+	if b.keys[1] != "task.sent" {
+		t.Errorf("event routing key %q", b.keys[1])
+	}
+
+	event := map[string]interface{}{}
+	json.Unmarshal(b.messages[1].Body, &event)
+
+	if event["name"] != "tasks.add" || event["args"] != "[2,3]" || event["routing_key"] != "celery" {
+		t.Errorf("task-sent event %v", event)
+	}
+}
+
+func TestWorkerEvents(t *testing.T) {
+	b := &routedBroker{}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Events = NewEventDispatcher(b, "celery@test")
+	w.Register("tasks.add", func(task *Task) (interface{}, error) { return 5, nil })
+
+	x, _ := NewTaskArgs("tasks.add", []interface{}{2, 3}, nil)
+	msg, _ := delivery(t, x)
+	w.dispatch(msg)
+
+	expected := []string{EventTaskReceived, EventTaskStarted, EventTaskSucceeded}
+	if types := eventTypes(t, b); !reflect.DeepEqual(types, expected) {
+		t.Errorf("events %v", types)
+	}
+
+	event := map[string]interface{}{}
+	json.Unmarshal(b.messages[2].Body, &event)
+
+	if event["result"] != "5" || event["runtime"] == nil {
+		t.Errorf("task-succeeded event %v", event)
+	}
+
+	// results failing to encode fail their task
+	w.Register("tasks.chan", func(task *Task) (interface{}, error) { return make(chan int), nil })
+
+	y, _ := NewTask("tasks.chan", nil, nil)
+	msg, _ = delivery(t, y)
+	w.dispatch(msg)
+
+	expected = append(expected, EventTaskReceived, EventTaskStarted, EventTaskFailed)
+	if types := eventTypes(t, b); !reflect.DeepEqual(types, expected) {
+		t.Errorf("events %v", types)
+	}
+}
+
+func TestWorkerHeartbeat(t *testing.T) {
+	messages := make(chan *Message)
+	b := &routedBroker{recordingBroker: recordingBroker{Broker: &chanBroker{messages: messages}}}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Events = NewEventDispatcher(b, "celery@test")
+	w.HeartbeatInterval = time.Millisecond
+
+	done := make(chan error)
+	go func() { done <- w.Run() }()
+
+	time.Sleep(20 * time.Millisecond)
+	close(messages)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	types := eventTypes(t, b)
+	if len(types) < 3 || types[0] != EventWorkerOnline || types[1] != EventWorkerHeartbeat || types[len(types)-1] != EventWorkerOffline {
+		t.Errorf("events %v", types)
+	}
+}
+
+func TestTopicMatch(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"#", "task.sent", true},
+		{"task.#", "task.sent", true},
+		{"task.*", "task.sent", true},
+		{"task.*", "worker.heartbeat", false},
+		{"*.heartbeat", "worker.heartbeat", true},
+		{"task.sent", "task.sent", true},
+		{"task.#.sent", "task.sent", true},
+		{"task", "task.sent", false},
+	}
+
+	for _, c := range cases {
+		if topicMatch(c.pattern, c.key) != c.match {
+			t.Errorf("%q matching %q", c.pattern, c.key)
+		}
+	}
+}
+
+func TestEventReceiver(t *testing.T) {
+	_, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := NewEventReceiver(b, "task.#").Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewEventDispatcher(b, "celery@test")
+	d.Send(EventWorkerHeartbeat, map[string]interface{}{"active": 1})
+	d.Send(EventTaskSucceeded, map[string]interface{}{"uuid": "1234", "result": "5", "runtime": 0.5})
+
+	select {
+	case event := <-events:
+		succeeded, ok := event.(*TaskSucceeded)
+		if !ok {
+			t.Fatalf("received %#v", event)
+		}
+
+		if succeeded.UUID != "1234" || succeeded.Result != "5" || succeeded.Runtime != 0.5 || succeeded.Hostname != "celery@test" {
+			t.Errorf("received %#v", succeeded)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no event received")
+	}
+}
@@ -0,0 +1,161 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Time Worker.Healthy waits for the broker
+const healthTimeout = 5 * time.Second
+
+var (
+	// Error of the brokers reconnecting
+	ErrNotConnected = errors.New("not connected")
+
+	// Error of the workers not consuming their queue
+	ErrNotRunning = errors.New("not running")
+)
+
+// Error of a failed health check, errors.Is matches its cause,
+// Component - what failed the check, such as broker, connection,
+// channel or worker,
+// Err - the cause, such as ErrNotConnected or ErrBrokerClosed
+type HealthError struct {
+	Component string
+	Err       error
+}
+
+func (e *HealthError) Error() string {
+	return fmt.Sprintf("%s unhealthy: %v", e.Component, e.Err)
+}
+
+func (e *HealthError) Unwrap() error {
+	return e.Err
+}
+
+// Broker actively checking its connection, Ping returns a *HealthError
+// when the broker cannot be used
+type PingBroker interface {
+	Broker
+	Ping(ctx context.Context) error
+}
+
+var (
+	_ PingBroker = (*AMQPBroker)(nil)
+	_ PingBroker = (*RedisBroker)(nil)
+	_ PingBroker = (*MemoryBroker)(nil)
+)
+
+// Returns the result of f, or the error of ctx once done first
+func within(ctx context.Context, f func() error) error {
+	errs := make(chan error, 1)
+	go func() { errs <- f() }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Checks the connection is open and the channel answers a passive
+// declare of the amq.direct exchange, which every RabbitMQ vhost has,
+// fails with ErrNotConnected while reconnecting
+func (b *AMQPBroker) Ping(ctx context.Context) error {
+	select {
+	case <-b.done:
+		return &HealthError{Component: "broker", Err: ErrBrokerClosed}
+	default:
+	}
+
+	if !b.Connected() {
+		return &HealthError{Component: "broker", Err: ErrNotConnected}
+	}
+
+	b.mu.RLock()
+	conn, ch := b.conn, b.ch
+	b.mu.RUnlock()
+
+	if conn != nil && conn.IsClosed() {
+		return &HealthError{Component: "connection", Err: ErrNotConnected}
+	}
+
+	err := within(ctx, func() error {
+		return ch.ExchangeDeclarePassive("amq.direct", "direct", true, false, false, false, nil)
+	})
+	if err != nil {
+		return &HealthError{Component: "channel", Err: err}
+	}
+
+	return nil
+}
+
+// Checks Redis answers a ping
+func (b *RedisBroker) Ping(ctx context.Context) error {
+	select {
+	case <-b.done:
+		return &HealthError{Component: "broker", Err: ErrBrokerClosed}
+	default:
+	}
+
+	if err := within(ctx, func() error { return b.client.Ping().Err() }); err != nil {
+		return &HealthError{Component: "connection", Err: err}
+	}
+
+	return nil
+}
+
+// Checks the broker is not closed
+func (b *MemoryBroker) Ping(ctx context.Context) error {
+	if !b.Connected() {
+		return &HealthError{Component: "broker", Err: ErrBrokerClosed}
+	}
+
+	return nil
+}
+
+// Checks b with its Ping, or its connection state for brokers
+// without one, other brokers are assumed healthy
+func ping(ctx context.Context, b Broker) error {
+	switch pb := b.(type) {
+	case PingBroker:
+		return pb.Ping(ctx)
+	case ConnectedBroker:
+		if !pb.Connected() {
+			return &HealthError{Component: "broker", Err: ErrNotConnected}
+		}
+	}
+
+	return nil
+}
+
+// Checks the broker of the client publisher and its reply queue,
+// returns a *HealthError when calls would fail
+func (c *Client) Ping(ctx context.Context) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+
+	if closed {
+		return &HealthError{Component: "reply queue", Err: errClientClosed}
+	}
+
+	return ping(ctx, c.Publisher.broker)
+}
+
+// Checks the worker consumes its queue and pings its broker,
+// returns a *HealthError when tasks cannot be received
+func (w *Worker) Healthy() error {
+	if atomic.LoadInt32(&w.consuming) == 0 {
+		return &HealthError{Component: "worker", Err: ErrNotRunning}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	return ping(ctx, w.broker)
+}
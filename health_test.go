@@ -0,0 +1,85 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Fails t unless err is a *HealthError of component caused by cause
+func assertUnhealthy(t *testing.T, err error, component string, cause error) {
+	t.Helper()
+
+	var he *HealthError
+	if !errors.As(err, &he) || he.Component != component || !errors.Is(err, cause) {
+		t.Errorf("health error %v, expected %s: %v", err, component, cause)
+	}
+}
+
+func TestBrokerPing(t *testing.T) {
+	ctx := context.Background()
+
+	m := NewMemoryBroker()
+	if err := m.Ping(ctx); err != nil {
+		t.Error(err)
+	}
+
+	m.Close()
+	assertUnhealthy(t, m.Ping(ctx), "broker", ErrBrokerClosed)
+
+	s, client := newTestRedis(t)
+	r := NewRedisBroker(client)
+
+	if err := r.Ping(ctx); err != nil {
+		t.Error(err)
+	}
+
+	s.Close()
+	if err := r.Ping(ctx); err == nil {
+		t.Error("pinged a stopped Redis")
+	}
+
+	r.Close()
+	assertUnhealthy(t, r.Ping(ctx), "broker", ErrBrokerClosed)
+
+	// a dialed broker reconnecting has no channel to check yet
+	assertUnhealthy(t, newAMQPBroker("amqp://").Ping(ctx), "broker", ErrNotConnected)
+}
+
+func TestWorkerHealthy(t *testing.T) {
+	b := NewMemoryBroker()
+
+	w := NewWorker(b, "celery", "", "celery")
+	assertUnhealthy(t, w.Healthy(), "worker", ErrNotRunning)
+
+	done := make(chan error)
+	go func() { done <- w.Run() }()
+	defer w.Stop(context.Background())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Healthy() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal(w.Healthy())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.Close()
+	<-done
+
+	assertUnhealthy(t, w.Healthy(), "worker", ErrNotRunning)
+}
+
+func TestClientPing(t *testing.T) {
+	b := NewMemoryBroker()
+	c := newClient(NewPublisher(b), "reply")
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	b.Close()
+	assertUnhealthy(t, c.Ping(context.Background()), "broker", ErrBrokerClosed)
+}
@@ -0,0 +1,80 @@
+package celery
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/nu7hatch/gouuid"
+	"sync"
+	"time"
+)
+
+// Generator of task, signature and group ids,
+// NewID - returns a new unique id
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// Generator of random version 4 UUIDs, the ids Celery generates
+var UUID4 IDGenerator = uuid4Generator{}
+
+// Generator of version 7 UUIDs, starting with their creation time in
+// milliseconds so the ids sort in creation order
+var UUID7 IDGenerator = uuid7Generator{}
+
+var (
+	idsMu      sync.RWMutex
+	packageIDs = UUID4
+)
+
+// Sets the generator of the ids of new tasks, signatures and groups,
+// UUID4 by default, a nil generator restores the default
+func SetIDGenerator(g IDGenerator) {
+	idsMu.Lock()
+	defer idsMu.Unlock()
+
+	if g == nil {
+		g = UUID4
+	}
+
+	packageIDs = g
+}
+
+// Returns a new id from the package generator
+func newID() (string, error) {
+	idsMu.RLock()
+	g := packageIDs
+	idsMu.RUnlock()
+
+	return g.NewID()
+}
+
+type uuid4Generator struct{}
+
+func (uuid4Generator) NewID() (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+type uuid7Generator struct{}
+
+func (uuid7Generator) NewID() (string, error) {
+	var b [16]byte
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*uint(i)))
+	}
+
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
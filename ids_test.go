@@ -0,0 +1,47 @@
+package celery
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+)
+
+// the variant of gouuid ids is not the RFC 4122 one
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([0-9a-f])[0-9a-f]{3}-([0-9a-f])[0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestIDGenerator(t *testing.T) {
+	SetIDGenerator(UUID7)
+	defer SetIDGenerator(nil)
+
+	var ids []string
+
+	for i := 0; i < 3; i++ {
+		x, err := NewTask("tasks.add", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m := uuidPattern.FindStringSubmatch(x.Id); m == nil || m[1] != "7" || m[2] < "8" || m[2] > "b" {
+			t.Errorf("id %q", x.Id)
+		}
+
+		ids = append(ids, x.Id)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("ids %v", ids)
+	}
+
+	SetIDGenerator(nil)
+
+	if s, _ := NewSignature("tasks.add", nil, nil); !uuidPattern.MatchString(s.Id) || s.Id[14] != '4' {
+		t.Errorf("id %q", s.Id)
+	}
+
+	x := NewTaskWithID("order-1234", "tasks.charge", nil, nil)
+	if x.Id != "order-1234" {
+		t.Errorf("id %q", x.Id)
+	}
+}
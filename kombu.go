@@ -0,0 +1,101 @@
+package celery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/nu7hatch/gouuid"
+)
+
+// Message envelope used by Kombu's virtual transports (Redis, SQS),
+// the body is base64 encoded and the AMQP properties are emulated
+type kombuEnvelope struct {
+	Body            string                 `json:"body"`
+	ContentEncoding string                 `json:"content-encoding"`
+	ContentType     string                 `json:"content-type"`
+	Headers         map[string]interface{} `json:"headers"`
+	Properties      kombuProperties        `json:"properties"`
+}
+
+type kombuProperties struct {
+	BodyEncoding  string            `json:"body_encoding"`
+	CorrelationId string            `json:"correlation_id,omitempty"`
+	ReplyTo       string            `json:"reply_to,omitempty"`
+	DeliveryMode  uint8             `json:"delivery_mode"`
+	DeliveryInfo  kombuDeliveryInfo `json:"delivery_info"`
+	DeliveryTag   string            `json:"delivery_tag"`
+	Priority      uint8             `json:"priority"`
+	Expiration    string            `json:"expiration,omitempty"`
+}
+
+type kombuDeliveryInfo struct {
+	Exchange   string `json:"exchange"`
+	RoutingKey string `json:"routing_key"`
+}
+
+// Returns the JSON Kombu envelope of a message published
+// to exchange with routing key, a new delivery tag is generated
+func encodeEnvelope(exchange, key string, msg *Message) ([]byte, error) {
+	tag, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	env := kombuEnvelope{
+		Body:            base64.StdEncoding.EncodeToString(msg.Body),
+		ContentEncoding: msg.ContentEncoding,
+		ContentType:     msg.ContentType,
+		Headers:         msg.Headers,
+		Properties: kombuProperties{
+			BodyEncoding:  "base64",
+			CorrelationId: msg.CorrelationId,
+			ReplyTo:       msg.ReplyTo,
+			DeliveryMode:  msg.DeliveryMode,
+			DeliveryInfo:  kombuDeliveryInfo{Exchange: exchange, RoutingKey: key},
+			DeliveryTag:   tag.String(),
+			Priority:      msg.Priority,
+			Expiration:    msg.Expiration,
+		},
+	}
+
+	if env.Headers == nil {
+		env.Headers = map[string]interface{}{}
+	}
+
+	return json.Marshal(env)
+}
+
+// Decodes a JSON Kombu envelope and returns it with the decoded body
+func decodeEnvelope(raw []byte) (*kombuEnvelope, []byte, error) {
+	env := &kombuEnvelope{}
+	if err := json.Unmarshal(raw, env); err != nil {
+		return nil, nil, err
+	}
+
+	if env.Properties.BodyEncoding != "base64" {
+		return env, []byte(env.Body), nil
+	}
+
+	body, err := base64.StdEncoding.DecodeString(env.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return env, body, nil
+}
+
+// Returns the consumed message carried by the envelope
+func (env *kombuEnvelope) message(body []byte) *Message {
+	return &Message{
+		ContentType:     env.ContentType,
+		ContentEncoding: env.ContentEncoding,
+		DeliveryMode:    env.Properties.DeliveryMode,
+		Priority:        env.Properties.Priority,
+		CorrelationId:   env.Properties.CorrelationId,
+		ReplyTo:         env.Properties.ReplyTo,
+		Expiration:      env.Properties.Expiration,
+		Headers:         env.Headers,
+		Body:            body,
+		Exchange:        env.Properties.DeliveryInfo.Exchange,
+		RoutingKey:      env.Properties.DeliveryInfo.RoutingKey,
+	}
+}
@@ -0,0 +1,96 @@
+package celery
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Structured logger, the fields are alternating keys and values,
+// *slog.Logger implements it and zap's SugaredLogger through
+// its Debugw, Infow, Warnw and Errorw methods
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// Logger discarding everything
+var NopLogger Logger = nopLogger{}
+
+var (
+	loggerMu      sync.RWMutex
+	packageLogger Logger = stdLogger{}
+)
+
+// Sets the logger of the package, used by the components without
+// a logger of their own, the standard log package by default,
+// a nil logger restores the default
+func SetLogger(l Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	if l == nil {
+		l = stdLogger{}
+	}
+
+	packageLogger = l
+}
+
+// Returns l, or the package logger when nil
+func loggerOr(l Logger) Logger {
+	if l != nil {
+		return l
+	}
+
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+
+	return packageLogger
+}
+
+// Logger writing to the standard log package, debug messages
+// are dropped
+type stdLogger struct{}
+
+func (stdLogger) Debug(msg string, fields ...interface{}) {}
+
+func (stdLogger) Info(msg string, fields ...interface{}) {
+	log.Print(format("INFO", msg, fields))
+}
+
+func (stdLogger) Warn(msg string, fields ...interface{}) {
+	log.Print(format("WARN", msg, fields))
+}
+
+func (stdLogger) Error(msg string, fields ...interface{}) {
+	log.Print(format("ERROR", msg, fields))
+}
+
+// Returns a log line of a message and its key=value fields
+func format(level, msg string, fields []interface{}) string {
+	var b strings.Builder
+
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 < len(fields) {
+			fmt.Fprintf(&b, " %v=%v", fields[i], fields[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", fields[i])
+		}
+	}
+
+	return b.String()
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...interface{}) {}
+func (nopLogger) Info(msg string, fields ...interface{})  {}
+func (nopLogger) Warn(msg string, fields ...interface{})  {}
+func (nopLogger) Error(msg string, fields ...interface{}) {}
@@ -0,0 +1,61 @@
+package celery
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// slog loggers are accepted as they are
+var _ Logger = slog.Default()
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) record(level, msg string, fields []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lines = append(l.lines, format(level, msg, fields))
+}
+
+func (l *recordingLogger) Debug(msg string, fields ...interface{}) { l.record("DEBUG", msg, fields) }
+func (l *recordingLogger) Info(msg string, fields ...interface{})  { l.record("INFO", msg, fields) }
+func (l *recordingLogger) Warn(msg string, fields ...interface{})  { l.record("WARN", msg, fields) }
+func (l *recordingLogger) Error(msg string, fields ...interface{}) { l.record("ERROR", msg, fields) }
+
+func TestWorkerLogger(t *testing.T) {
+	l := &recordingLogger{}
+
+	w := NewWorker(&recordingBroker{}, "celery", "", "celery")
+	w.Logger = l
+
+	x, _ := NewTask("tasks.missing", nil, nil)
+	msg, _ := delivery(t, x)
+	w.dispatch(msg)
+
+	expected := fmt.Sprintf("ERROR Received unregistered task task=tasks.missing id=%s", x.Id)
+	if len(l.lines) != 1 || l.lines[0] != expected {
+		t.Errorf("logged %q", l.lines)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	l := &recordingLogger{}
+
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	if loggerOr(nil) != l {
+		t.Error("package logger not set")
+	}
+
+	SetLogger(nil)
+
+	if _, ok := loggerOr(nil).(stdLogger); !ok {
+		t.Error("default logger not restored")
+	}
+}
@@ -0,0 +1,87 @@
+package celery
+
+import (
+	"github.com/bradfitz/gomemcache/memcache"
+	"time"
+)
+
+// Memcached operations of a memcache.Client used by the backend
+type MemcacheClient interface {
+	Get(key string) (*memcache.Item, error)
+	Set(item *memcache.Item) error
+	Delete(key string) error
+}
+
+// Memcached result backend, the same as Celery's cache+memcached://
+// backend, results are stored as JSON under celery-task-meta-<id> keys,
+// Expires - time the results are kept, the item expiration rounded
+// up to seconds
+type MemcachedBackend struct {
+	Expires time.Duration
+
+	client MemcacheClient
+}
+
+// Returns a pointer to a new Memcached result backend using client,
+// such as memcache.New("127.0.0.1:11211")
+func NewMemcachedBackend(client MemcacheClient) *MemcachedBackend {
+	return &MemcachedBackend{Expires: defaultResultExpires, client: client}
+}
+
+// Sets the time results are kept
+func (b *MemcachedBackend) SetExpires(expires time.Duration) {
+	b.Expires = expires
+}
+
+// Returns the expiration of the items in seconds, rounded up as 0
+// never expires, Memcached takes longer expirations than 30 days
+// as Unix times
+func (b *MemcachedBackend) expiration() int32 {
+	switch {
+	case b.Expires <= 0:
+		return 0
+	case b.Expires > 30*24*time.Hour:
+		return int32(time.Now().Add(b.Expires).Unix())
+	}
+
+	return int32((b.Expires + time.Second - 1) / time.Second)
+}
+
+// Stores a task result
+func (b *MemcachedBackend) Store(meta *ResultMeta) error {
+	body, err := meta.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	return b.client.Set(&memcache.Item{Key: resultKeyPrefix + meta.TaskId, Value: body, Expiration: b.expiration()})
+}
+
+// Returns a task result, unknown and expired tasks are reported
+// as PENDING
+func (b *MemcachedBackend) Get(id string) (*ResultMeta, error) {
+	item, err := b.client.Get(resultKeyPrefix + id)
+	if err == memcache.ErrCacheMiss {
+		return &ResultMeta{TaskId: id, Status: StatePending}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &ResultMeta{}
+	if err := meta.UnmarshalJSON(item.Value); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// Removes a task result
+func (b *MemcachedBackend) Forget(id string) error {
+	if err := b.client.Delete(resultKeyPrefix + id); err != nil && err != memcache.ErrCacheMiss {
+		return err
+	}
+
+	return nil
+}
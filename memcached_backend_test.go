@@ -0,0 +1,81 @@
+package celery
+
+import (
+	"github.com/bradfitz/gomemcache/memcache"
+	"testing"
+	"time"
+)
+
+type fakeMemcache struct {
+	items map[string]*memcache.Item
+}
+
+func (f *fakeMemcache) Get(key string) (*memcache.Item, error) {
+	item, ok := f.items[key]
+	if !ok {
+		return nil, memcache.ErrCacheMiss
+	}
+
+	return item, nil
+}
+
+func (f *fakeMemcache) Set(item *memcache.Item) error {
+	f.items[item.Key] = item
+	return nil
+}
+
+func (f *fakeMemcache) Delete(key string) error {
+	if _, ok := f.items[key]; !ok {
+		return memcache.ErrCacheMiss
+	}
+
+	delete(f.items, key)
+
+	return nil
+}
+
+func TestMemcachedBackend(t *testing.T) {
+	f := &fakeMemcache{items: map[string]*memcache.Item{}}
+	b := NewMemcachedBackend(f)
+
+	if meta, err := b.Get("1234"); err != nil || meta.Status != StatePending {
+		t.Errorf("got %+v, %v", meta, err)
+	}
+
+	if err := b.Store(&ResultMeta{TaskId: "1234", Status: StateSuccess, Result: 3.0}); err != nil {
+		t.Fatal(err)
+	}
+
+	item := f.items["celery-task-meta-1234"]
+	if item == nil || item.Expiration != 86400 {
+		t.Fatalf("stored %+v", item)
+	}
+
+	if meta, err := b.Get("1234"); err != nil || meta.Status != StateSuccess || meta.Result != 3.0 {
+		t.Errorf("got %+v, %v", meta, err)
+	}
+
+	b.Expires = 60 * 24 * time.Hour
+	if exp := b.expiration(); int64(exp) < time.Now().Unix() {
+		t.Errorf("expiration %d", exp)
+	}
+
+	b.Expires = 500 * time.Millisecond
+	if exp := b.expiration(); exp != 1 {
+		t.Errorf("sub-second expiration %d", exp)
+	}
+
+	if err := b.Forget("1234"); err != nil || len(f.items) != 0 {
+		t.Errorf("forget %v, %d items", err, len(f.items))
+	}
+
+	if err := b.Forget("1234"); err != nil {
+		t.Error(err)
+	}
+
+	if backend, err := DialBackend("cache+memcached://127.0.0.1:11211;127.0.0.2:11211/"); err != nil {
+		t.Error(err)
+	} else if _, ok := backend.(*MemcachedBackend); !ok {
+		t.Errorf("dialed %T", backend)
+	}
+}
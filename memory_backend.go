@@ -0,0 +1,52 @@
+package celery
+
+import "sync"
+
+// In-memory result backend for tests and eager execution,
+// the same as Celery's cache+memory:// backend
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	results map[string]*ResultMeta
+}
+
+// Returns a pointer to a new empty memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{results: make(map[string]*ResultMeta)}
+}
+
+// Saves a copy of a result under its task id
+func (b *MemoryBackend) Store(meta *ResultMeta) error {
+	stored := *meta
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.results[meta.TaskId] = &stored
+
+	return nil
+}
+
+// Returns a copy of the result of a task, a PENDING result when unknown
+func (b *MemoryBackend) Get(id string) (*ResultMeta, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	meta, ok := b.results[id]
+	if !ok {
+		return &ResultMeta{TaskId: id, Status: StatePending}, nil
+	}
+
+	stored := *meta
+
+	return &stored, nil
+}
+
+// Removes the result of a task
+func (b *MemoryBackend) Forget(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.results, id)
+
+	return nil
+}
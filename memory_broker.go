@@ -0,0 +1,382 @@
+package celery
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// In-memory broker for tests, the same as Kombu's memory:// transport,
+// messages are delivered in the order they were published, messages
+// requeued by a Nack get their place back in the queue, exchanges route to
+// the queues bound to them as direct, topic or fanout exchanges,
+// the default exchange routes to the queue named by the routing key,
+// queues are created on first use
+type MemoryBroker struct {
+	mu        sync.Mutex
+	queues    map[string]*memoryQueue
+	exchanges map[string]string
+	bindings  map[amqpBinding]bool
+	published uint64
+
+	once sync.Once
+	done chan struct{}
+}
+
+// Queue of a memory broker, ready is closed and replaced
+// when messages are added
+type memoryQueue struct {
+	messages []memoryMessage
+	unacked  int
+	ready    chan struct{}
+}
+
+// Queued message, seq orders the messages of a queue
+type memoryMessage struct {
+	msg *Message
+	seq uint64
+}
+
+// Settles a message consumed from a memory broker once
+type memoryAcknowledger struct {
+	b       *MemoryBroker
+	queue   string
+	queued  memoryMessage
+	settled bool
+}
+
+// Returns a pointer to a new empty memory broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues:    make(map[string]*memoryQueue),
+		exchanges: make(map[string]string),
+		bindings:  make(map[amqpBinding]bool),
+		done:      make(chan struct{}),
+	}
+}
+
+// Returns the queue named name, created when missing,
+// must be called with mu held
+func (b *MemoryBroker) queue(name string) *memoryQueue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{ready: make(chan struct{})}
+		b.queues[name] = q
+	}
+
+	return q
+}
+
+// Adds a message to q at its place and wakes up the consumers,
+// must be called with mu held
+func (q *memoryQueue) insert(m memoryMessage) {
+	i := sort.Search(len(q.messages), func(i int) bool { return q.messages[i].seq > m.seq })
+
+	q.messages = append(q.messages, memoryMessage{})
+	copy(q.messages[i+1:], q.messages[i:])
+	q.messages[i] = m
+
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+// Returns the queues bound to exchange with routing key,
+// must be called with mu held
+func (b *MemoryBroker) lookup(exchange, key string) []string {
+	if exchange == "" {
+		return []string{key}
+	}
+
+	kind := b.exchanges[exchange]
+
+	var queues []string
+
+	for binding := range b.bindings {
+		if binding.exchange != exchange {
+			continue
+		}
+
+		switch {
+		case kind == "fanout",
+			kind == "topic" && topicMatch(binding.key, key),
+			binding.key == key:
+			queues = append(queues, binding.queue)
+		}
+	}
+
+	return queues
+}
+
+// Publish a message to every queue bound to exchange with routing key
+func (b *MemoryBroker) Publish(exchange, key string, msg *Message) error {
+	return b.PublishContext(context.Background(), exchange, key, msg)
+}
+
+// Same as Publish, nothing is queued once ctx is done
+func (b *MemoryBroker) PublishContext(ctx context.Context, exchange, key string, msg *Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return ErrBrokerClosed
+	default:
+	}
+
+	queues := b.lookup(exchange, key)
+	if len(queues) == 0 && msg.Mandatory {
+		return unroutable(exchange, key, msg)
+	}
+
+	for _, name := range queues {
+		queued := *msg
+		queued.Exchange = exchange
+		queued.RoutingKey = key
+		queued.Redelivered = false
+		queued.Acknowledger = nil
+
+		b.published++
+		b.queue(name).insert(memoryMessage{msg: &queued, seq: b.published})
+	}
+
+	return nil
+}
+
+// Binds queue to exchange with key and starts consuming it
+func (b *MemoryBroker) Consume(queue, exchange, key string) (<-chan *Message, error) {
+	return b.ConsumeContext(context.Background(), queue, exchange, key)
+}
+
+// Same as Consume, stops consuming and closes the messages channel
+// once ctx is done, the message not handed to the receiver yet
+// is put back in the queue
+func (b *MemoryBroker) ConsumeContext(ctx context.Context, queue, exchange, key string) (<-chan *Message, error) {
+	if exchange != "" {
+		if err := b.BindQueue(queue, exchange, key); err != nil {
+			return nil, err
+		}
+	}
+
+	messages := make(chan *Message)
+
+	go b.receive(ctx, queue, messages)
+
+	return messages, nil
+}
+
+// Hands the messages of queue to messages until ctx is done
+// or the broker is closed
+func (b *MemoryBroker) receive(ctx context.Context, queue string, messages chan<- *Message) {
+	defer close(messages)
+
+	for {
+		msg, ready := b.pop(queue)
+
+		if msg == nil {
+			select {
+			case <-ready:
+				continue
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			}
+		}
+
+		// messages requeued before msg are handed first
+		select {
+		case messages <- msg:
+		case <-ready:
+			b.unpop(queue, msg)
+		case <-ctx.Done():
+			b.unpop(queue, msg)
+			return
+		case <-b.done:
+			b.unpop(queue, msg)
+			return
+		}
+	}
+}
+
+// Removes the message at the head of queue, it is unacknowledged until
+// settled, returns the channel closed once messages are added
+func (b *MemoryBroker) pop(name string) (*Message, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := b.queue(name)
+	if len(q.messages) == 0 {
+		return nil, q.ready
+	}
+
+	head := q.messages[0]
+	q.messages = q.messages[1:]
+	q.unacked++
+
+	msg := *head.msg
+	msg.Acknowledger = &memoryAcknowledger{b: b, queue: name, queued: head}
+
+	return &msg, q.ready
+}
+
+// Puts back a message popped but never delivered
+func (b *MemoryBroker) unpop(name string, msg *Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	a := msg.Acknowledger.(*memoryAcknowledger)
+
+	q := b.queue(name)
+	q.unacked--
+	q.insert(a.queued)
+}
+
+// Memory queues need no declaration, they are created on first use
+func (b *MemoryBroker) DeclareQueue(name string, args map[string]interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.queue(name)
+
+	return nil
+}
+
+// Declares an exchange of the given kind (direct, topic, fanout),
+// undeclared exchanges route as direct ones
+func (b *MemoryBroker) DeclareExchange(name, kind string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.exchanges[name] = kind
+
+	return nil
+}
+
+// Binds queue to exchange with key
+func (b *MemoryBroker) BindQueue(queue, exchange, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bindings[amqpBinding{queue: queue, exchange: exchange, key: key}] = true
+	b.queue(queue)
+
+	return nil
+}
+
+// Returns copies of the messages waiting in queue, in delivery order,
+// the messages about to be delivered to a consumer excluded
+func (b *MemoryBroker) Messages(queue string) []*Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil
+	}
+
+	messages := make([]*Message, len(q.messages))
+	for i, queued := range q.messages {
+		m := *queued.msg
+		messages[i] = &m
+	}
+
+	return messages
+}
+
+// Returns the number of messages waiting in queue
+func (b *MemoryBroker) QueueLen(queue string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if q, ok := b.queues[queue]; ok {
+		return len(q.messages), nil
+	}
+
+	return 0, nil
+}
+
+// Returns copies of up to n messages waiting in queue
+func (b *MemoryBroker) Peek(queue string, n int) ([]*Message, error) {
+	messages := b.Messages(queue)
+	if len(messages) > n {
+		messages = messages[:n]
+	}
+
+	return messages, nil
+}
+
+// Returns the number of messages of queue delivered, or about to be
+// delivered to a consumer, but not settled yet
+func (b *MemoryBroker) Unacked(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if q, ok := b.queues[queue]; ok {
+		return q.unacked
+	}
+
+	return 0
+}
+
+// Removes the messages waiting in queue, returns their number
+func (b *MemoryBroker) Purge(queue string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[queue]
+	if !ok {
+		return 0, nil
+	}
+
+	n := len(q.messages)
+	q.messages = nil
+
+	return n, nil
+}
+
+// Stops the consumers, their messages channels are closed
+func (b *MemoryBroker) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return nil
+}
+
+// Settles the message, requeued messages get their place back in
+// their queue and are marked redelivered
+func (a *memoryAcknowledger) settle(requeue bool) error {
+	a.b.mu.Lock()
+	defer a.b.mu.Unlock()
+
+	if a.settled {
+		return nil
+	}
+
+	a.settled = true
+
+	q := a.b.queue(a.queue)
+	q.unacked--
+
+	if requeue {
+		redelivered := *a.queued.msg
+		redelivered.Redelivered = true
+
+		q.insert(memoryMessage{msg: &redelivered, seq: a.queued.seq})
+	}
+
+	return nil
+}
+
+func (a *memoryAcknowledger) Ack() error {
+	return a.settle(false)
+}
+
+func (a *memoryAcknowledger) Nack(requeue bool) error {
+	return a.settle(requeue)
+}
+
+func (a *memoryAcknowledger) Reject(requeue bool) error {
+	return a.settle(requeue)
+}
@@ -0,0 +1,109 @@
+package celery
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	b := NewMemoryBroker()
+	p := NewPublisher(b)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		x, _ := NewTask("tasks.add", nil, nil)
+		if err := p.ApplyAsync(x); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, x.Id)
+	}
+
+	if queued := b.Messages("celery"); len(queued) != 3 || queued[0].CorrelationId != ids[0] {
+		t.Fatalf("queued %v", queued)
+	}
+
+	messages, err := b.Consume("celery", "", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := <-messages
+	if first.CorrelationId != ids[0] || first.RoutingKey != "celery" {
+		t.Fatalf("received %+v first", first)
+	}
+
+	first.Nack(true)
+
+	for i, id := range ids {
+		msg := <-messages
+		if msg.CorrelationId != id || msg.Redelivered != (i == 0) {
+			t.Fatalf("received %+v at %d", msg, i)
+		}
+		msg.Ack()
+	}
+
+	if b.Unacked("celery") != 0 || len(b.Messages("celery")) != 0 {
+		t.Error("messages left in the queue")
+	}
+
+	b.Close()
+
+	if _, ok := <-messages; ok {
+		t.Error("messages not closed with the broker")
+	}
+}
+
+func TestMemoryBrokerRouting(t *testing.T) {
+	b := NewMemoryBroker()
+
+	if err := DeclareQueue(b, &Queue{Name: "images", Exchange: "media", ExchangeType: "topic", RoutingKey: "media.image.*"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b.DeclareExchange("broadcast", "fanout")
+	b.BindQueue("a", "broadcast", "")
+	b.BindQueue("b", "broadcast", "")
+
+	b.Publish("media", "media.image.resize", &Message{Body: []byte("1")})
+	b.Publish("media", "media.video.encode", &Message{Body: []byte("2")})
+	b.Publish("broadcast", "anything", &Message{Body: []byte("3")})
+
+	if len(b.Messages("images")) != 1 || len(b.Messages("a")) != 1 || len(b.Messages("b")) != 1 {
+		t.Errorf("routed %d %d %d", len(b.Messages("images")), len(b.Messages("a")), len(b.Messages("b")))
+	}
+
+	if err := b.Publish("media", "media.video.encode", &Message{Mandatory: true}); err == nil {
+		t.Error("unroutable mandatory message accepted")
+	}
+
+	if n, _ := b.Purge("images"); n != 1 || len(b.Messages("images")) != 0 {
+		t.Error("queue not purged")
+	}
+}
+
+func TestMemoryBrokerWorker(t *testing.T) {
+	b := NewMemoryBroker()
+
+	w := NewWorker(b, "celery", "", "celery")
+	done := make(chan *Task, 1)
+	w.Register("tasks.add", func(task *Task) (interface{}, error) {
+		done <- task
+		return nil, nil
+	})
+
+	go w.Run()
+	defer w.Stop(context.Background())
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	NewPublisher(b).ApplyAsync(x)
+
+	select {
+	case task := <-done:
+		if task.Id != x.Id {
+			t.Errorf("executed %+v", task)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("task not executed")
+	}
+}
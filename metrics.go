@@ -0,0 +1,46 @@
+package celery
+
+import "time"
+
+// Outcomes of MessageSettled
+const (
+	SettledAck    = "ack"
+	SettledNack   = "nack"
+	SettledReject = "reject"
+)
+
+// Observer of the task and broker activity, the metrics package
+// implements it with Prometheus collectors,
+// TaskPublished - a task was published, err is the publish error,
+// TaskReceived - a worker received a task,
+// TaskExecuted - a handler returned after d, err is its error,
+// TaskRetried - a failed task was published again,
+// MessageSettled - a consumed message was settled, SettledAck,
+// SettledNack or SettledReject,
+// Reconnected - a broker recovered its connection
+type Metrics interface {
+	TaskPublished(task string, err error)
+	TaskReceived(task string)
+	TaskExecuted(task string, d time.Duration, err error)
+	TaskRetried(task string)
+	MessageSettled(outcome string)
+	Reconnected()
+}
+
+// Returns m, or metrics recording nothing when nil
+func metricsOr(m Metrics) Metrics {
+	if m != nil {
+		return m
+	}
+
+	return nopMetrics{}
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) TaskPublished(task string, err error)                 {}
+func (nopMetrics) TaskReceived(task string)                             {}
+func (nopMetrics) TaskExecuted(task string, d time.Duration, err error) {}
+func (nopMetrics) TaskRetried(task string)                              {}
+func (nopMetrics) MessageSettled(outcome string)                        {}
+func (nopMetrics) Reconnected()                                         {}
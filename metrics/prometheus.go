@@ -0,0 +1,95 @@
+// Package metrics provides Prometheus collectors of the
+// github.com/bsphere/celery task and broker activity
+package metrics
+
+import (
+	"github.com/bsphere/celery"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Prometheus collectors of the celery metrics,
+// set it as the Metrics of publishers, workers and AMQP brokers
+type Prometheus struct {
+	published  *prometheus.CounterVec
+	received   *prometheus.CounterVec
+	runtime    *prometheus.HistogramVec
+	retried    *prometheus.CounterVec
+	settled    *prometheus.CounterVec
+	reconnects prometheus.Counter
+}
+
+var _ celery.Metrics = (*Prometheus)(nil)
+
+// Returns a pointer to new collectors registered on reg
+func NewPrometheus(reg prometheus.Registerer) (*Prometheus, error) {
+	p := &Prometheus{
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "celery_tasks_published_total",
+			Help: "Number of published tasks.",
+		}, []string{"task", "status"}),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "celery_tasks_received_total",
+			Help: "Number of tasks received by workers.",
+		}, []string{"task"}),
+		runtime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "celery_task_runtime_seconds",
+			Help:    "Execution time of the task handlers.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"task", "status"}),
+		retried: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "celery_tasks_retried_total",
+			Help: "Number of failed tasks published again.",
+		}, []string{"task"}),
+		settled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "celery_messages_settled_total",
+			Help: "Number of consumed messages acked, nacked or rejected.",
+		}, []string{"outcome"}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "celery_broker_reconnects_total",
+			Help: "Number of broker reconnections.",
+		}),
+	}
+
+	collectors := []prometheus.Collector{p.published, p.received, p.runtime, p.retried, p.settled, p.reconnects}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Returns the status label of an error
+func status(err error) string {
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
+
+func (p *Prometheus) TaskPublished(task string, err error) {
+	p.published.WithLabelValues(task, status(err)).Inc()
+}
+
+func (p *Prometheus) TaskReceived(task string) {
+	p.received.WithLabelValues(task).Inc()
+}
+
+func (p *Prometheus) TaskExecuted(task string, d time.Duration, err error) {
+	p.runtime.WithLabelValues(task, status(err)).Observe(d.Seconds())
+}
+
+func (p *Prometheus) TaskRetried(task string) {
+	p.retried.WithLabelValues(task).Inc()
+}
+
+func (p *Prometheus) MessageSettled(outcome string) {
+	p.settled.WithLabelValues(outcome).Inc()
+}
+
+func (p *Prometheus) Reconnected() {
+	p.reconnects.Inc()
+}
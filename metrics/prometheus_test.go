@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/bsphere/celery"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+	"time"
+)
+
+func TestPrometheus(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	m, err := NewPrometheus(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := celery.NewMemoryBroker()
+
+	p := celery.NewPublisher(b)
+	p.Metrics = m
+
+	for _, name := range []string{"tasks.add", "tasks.add", "tasks.fail"} {
+		task, _ := celery.NewTask(name, nil, nil)
+		if err := p.Publish(task, "", "celery"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := celery.NewWorker(b, "celery", "", "celery")
+	w.Metrics = m
+	w.Register("tasks.add", func(task *celery.Task) (interface{}, error) { return nil, nil })
+	w.Register("tasks.fail", func(task *celery.Task) (interface{}, error) { return nil, errors.New("failed") })
+
+	done := make(chan error)
+	go func() { done <- w.Run() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if n, _ := b.QueueLen("celery"); n == 0 && b.Unacked("celery") == 0 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w.Stop(context.Background())
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.ToFloat64(m.published.WithLabelValues("tasks.add", "success")); n != 2 {
+		t.Errorf("published %v tasks", n)
+	}
+
+	if n := testutil.ToFloat64(m.received.WithLabelValues("tasks.fail")); n != 1 {
+		t.Errorf("received %v tasks", n)
+	}
+
+	if n := testutil.ToFloat64(m.settled.WithLabelValues(celery.SettledAck)); n != 2 {
+		t.Errorf("acked %v messages", n)
+	}
+
+	if n := testutil.ToFloat64(m.settled.WithLabelValues(celery.SettledNack)); n != 1 {
+		t.Errorf("nacked %v messages", n)
+	}
+
+	if n := testutil.CollectAndCount(m.runtime); n != 2 {
+		t.Errorf("collected %d runtime series", n)
+	}
+
+	if _, err := NewPrometheus(reg); err == nil {
+		t.Error("collectors registered twice")
+	}
+}
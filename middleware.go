@@ -0,0 +1,89 @@
+package celery
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// Wraps the execution of the tasks by a worker, as HTTP middleware
+// wraps handlers, such as for logging, auth or tenant scoping,
+// the returned handler calls next to execute the task
+type Middleware func(next ContextTaskHandler) ContextTaskHandler
+
+// Adds middleware wrapping the handlers of the worker, the first
+// middleware added is the outermost one
+func (w *Worker) Use(middleware ...Middleware) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.middleware = append(w.middleware, middleware...)
+}
+
+// Returns h wrapped by the worker middleware
+func (w *Worker) wrap(h ContextTaskHandler) ContextTaskHandler {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for i := len(w.middleware) - 1; i >= 0; i-- {
+		h = w.middleware[i](h)
+	}
+
+	return h
+}
+
+// Returns middleware turning the panics of the handlers it wraps into
+// task errors, logged with their stack by l, the package logger when
+// nil, middleware added after it is recovered as well
+func Recover(l Logger) Middleware {
+	return func(next ContextTaskHandler) ContextTaskHandler {
+		return func(ctx context.Context, task *Task) (result interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					loggerOr(l).Error("Task panicked", "task", task.name(), "id", task.Id, "panic", r, "stack", string(debug.Stack()))
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+
+			return next(ctx, task)
+		}
+	}
+}
+
+// Returns middleware reporting the execution time and error of every
+// task to observe
+func Timing(observe func(task *Task, d time.Duration, err error)) Middleware {
+	return func(next ContextTaskHandler) ContextTaskHandler {
+		return func(ctx context.Context, task *Task) (interface{}, error) {
+			start := time.Now()
+
+			result, err := next(ctx, task)
+			observe(task, time.Since(start), err)
+
+			return result, err
+		}
+	}
+}
+
+// Returns middleware logging every task execution with l,
+// the package logger when nil, failures are logged as warnings
+func LogRequests(l Logger) Middleware {
+	return func(next ContextTaskHandler) ContextTaskHandler {
+		return func(ctx context.Context, task *Task) (interface{}, error) {
+			start := time.Now()
+
+			loggerOr(l).Info("Task received", "task", task.name(), "id", task.Id, "retries", task.Retries)
+
+			result, err := next(ctx, task)
+
+			if err != nil {
+				loggerOr(l).Warn("Task failed", "task", task.name(), "id", task.Id, "runtime", time.Since(start), "error", err)
+			} else {
+				loggerOr(l).Info("Task succeeded", "task", task.name(), "id", task.Id, "runtime", time.Since(start))
+			}
+
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerMiddleware(t *testing.T) {
+	w := NewWorker(&recordingBroker{}, "celery", "", "celery")
+	w.Logger = NopLogger
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next ContextTaskHandler) ContextTaskHandler {
+			return func(ctx context.Context, task *Task) (interface{}, error) {
+				calls = append(calls, name)
+				return next(ctx, task)
+			}
+		}
+	}
+
+	var timed time.Duration
+	var timedErr error
+
+	w.Use(trace("outer"), trace("inner"))
+	w.Use(Timing(func(task *Task, d time.Duration, err error) { timed, timedErr = d, err }))
+	w.Register("tasks.add", func(task *Task) (interface{}, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	})
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	msg, ack := delivery(t, x)
+	w.dispatch(msg)
+
+	if strings.Join(calls, ",") != "outer,inner,handler" || !ack.acked || timed <= 0 || timedErr != nil {
+		t.Fatalf("called %v, timed %v", calls, timed)
+	}
+
+	x, _ = NewTask("tasks.fail", nil, nil)
+	msg, _ = delivery(t, x)
+	w.dispatch(msg)
+
+	if timedErr == nil || timedErr.Error() != "failed" {
+		t.Errorf("timed error %v", timedErr)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	l := &recordingLogger{}
+
+	h := Recover(l)(func(ctx context.Context, task *Task) (interface{}, error) {
+		panic("boom")
+	})
+
+	if _, err := h(context.Background(), &Task{Task: "tasks.panic"}); err == nil || err.Error() != "panic: boom" {
+		t.Errorf("recovered %v", err)
+	}
+
+	if len(l.lines) != 1 || !strings.HasPrefix(l.lines[0], "ERROR Task panicked task=tasks.panic") {
+		t.Errorf("logged %q", l.lines)
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	l := &recordingLogger{}
+
+	h := LogRequests(l)(func(ctx context.Context, task *Task) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	h(context.Background(), &Task{Task: "tasks.fail", Id: "1"})
+
+	if len(l.lines) != 2 || l.lines[0] != "INFO Task received task=tasks.fail id=1 retries=0" || !strings.HasPrefix(l.lines[1], "WARN Task failed task=tasks.fail id=1") {
+		t.Errorf("logged %q", l.lines)
+	}
+}
@@ -0,0 +1,304 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"strings"
+	"time"
+)
+
+// Database and collections of Celery's MongoDB backend
+const (
+	defaultMongoDatabase        = "celery"
+	defaultMongoTaskCollection  = "celery_taskmeta"
+	defaultMongoGroupCollection = "celery_groupmeta"
+)
+
+// Operations of a mongo.Collection used by the backend
+type MongoCollection interface {
+	ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...options.Lister[options.ReplaceOptions]) (*mongo.UpdateResult, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
+	DeleteOne(ctx context.Context, filter interface{}, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...options.Lister[options.DeleteManyOptions]) (*mongo.DeleteResult, error)
+}
+
+// MongoDB result backend, the same as Celery's mongodb:// backend,
+// results are stored in the celery_taskmeta collection by task id,
+// their result JSON encoded as with Celery's json result serializer,
+// group results in the celery_groupmeta collection,
+// Expires - time the results are kept, applied by Cleanup
+type MongoBackend struct {
+	Expires time.Duration
+
+	tasks  MongoCollection
+	groups MongoCollection
+	client *mongo.Client
+}
+
+// Document of a task result
+type mongoTaskMeta struct {
+	Id        string        `bson:"_id"`
+	Status    string        `bson:"status"`
+	Result    interface{}   `bson:"result"`
+	Traceback *string       `bson:"traceback"`
+	Children  []interface{} `bson:"children"`
+	DateDone  time.Time     `bson:"date_done"`
+}
+
+// Document of a group result, the JSON encoded ids of its tasks
+type mongoGroupMeta struct {
+	Id       string    `bson:"_id"`
+	Result   string    `bson:"result"`
+	DateDone time.Time `bson:"date_done"`
+}
+
+// Returns a pointer to a new MongoDB result backend storing results
+// in the collections of db, such as client.Database("celery")
+func NewMongoBackend(db *mongo.Database) *MongoBackend {
+	return NewMongoCollectionBackend(db.Collection(defaultMongoTaskCollection), db.Collection(defaultMongoGroupCollection))
+}
+
+// Returns a pointer to a new MongoDB result backend storing task
+// results in tasks and group results in groups
+func NewMongoCollectionBackend(tasks, groups MongoCollection) *MongoBackend {
+	return &MongoBackend{Expires: defaultResultExpires, tasks: tasks, groups: groups}
+}
+
+// Returns a pointer to a new MongoDB result backend connected to
+// a mongodb:// URL, results are stored in the database of the URL,
+// the celery database without one
+func DialMongoBackend(rawurl string) (*MongoBackend, error) {
+	client, err := mongo.Connect(options.Client().ApplyURI(rawurl))
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewMongoBackend(client.Database(mongoDatabase(rawurl)))
+	b.client = client
+
+	return b, nil
+}
+
+// Stores a task result, replacing the previous one
+func (b *MongoBackend) Store(meta *ResultMeta) error {
+	result, err := json.Marshal(meta.Result)
+	if err != nil {
+		return err
+	}
+
+	doc := &mongoTaskMeta{
+		Id:       meta.TaskId,
+		Status:   meta.Status,
+		Result:   string(result),
+		Children: meta.Children,
+		DateDone: meta.DateDone,
+	}
+
+	if doc.Children == nil {
+		doc.Children = []interface{}{}
+	}
+
+	if meta.Traceback != "" {
+		doc.Traceback = &meta.Traceback
+	}
+
+	if doc.DateDone.IsZero() {
+		doc.DateDone = time.Now()
+	}
+
+	doc.DateDone = doc.DateDone.UTC()
+
+	_, err = b.tasks.ReplaceOne(context.Background(), bson.M{"_id": meta.TaskId}, doc, options.Replace().SetUpsert(true))
+
+	return err
+}
+
+// Returns a task result, unknown tasks are reported as PENDING
+func (b *MongoBackend) Get(id string) (*ResultMeta, error) {
+	doc := &mongoTaskMeta{}
+
+	err := b.tasks.FindOne(context.Background(), bson.M{"_id": id}).Decode(doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &ResultMeta{TaskId: id, Status: StatePending}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &ResultMeta{TaskId: id, Status: doc.Status, DateDone: doc.DateDone.UTC()}
+
+	// results stored by the bson serializer are documents
+	if encoded, ok := doc.Result.(string); ok {
+		if err := json.Unmarshal([]byte(encoded), &meta.Result); err != nil {
+			return nil, err
+		}
+	} else {
+		meta.Result = mongoValue(doc.Result)
+	}
+
+	if doc.Traceback != nil {
+		meta.Traceback = *doc.Traceback
+	}
+
+	if doc.Children != nil {
+		meta.Children = mongoValue(bson.A(doc.Children)).([]interface{})
+	}
+
+	return meta, nil
+}
+
+// Removes a task result
+func (b *MongoBackend) Forget(id string) error {
+	_, err := b.tasks.DeleteOne(context.Background(), bson.M{"_id": id})
+	return err
+}
+
+// Stores the ids of the tasks of a group, read back by Celery's
+// GroupResult.restore
+func (b *MongoBackend) SaveGroup(r *GroupResult) error {
+	ids := make([]string, len(r.Results))
+	for i, result := range r.Results {
+		ids[i] = result.Id
+	}
+
+	result, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	doc := &mongoGroupMeta{Id: r.Id, Result: string(result), DateDone: time.Now().UTC()}
+
+	_, err = b.groups.ReplaceOne(context.Background(), bson.M{"_id": r.Id}, doc, options.Replace().SetUpsert(true))
+
+	return err
+}
+
+// Returns the results of a group saved by SaveGroup or by Celery's
+// GroupResult.save, ErrGroupNotFound when unknown
+func (b *MongoBackend) GetGroup(id string) (*GroupResult, error) {
+	doc := &mongoGroupMeta{}
+
+	err := b.groups.FindOne(context.Background(), bson.M{"_id": id}).Decode(doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrGroupNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if err := json.Unmarshal([]byte(doc.Result), &ids); err != nil {
+		return nil, err
+	}
+
+	r := &GroupResult{Id: id}
+	for _, taskId := range ids {
+		r.Results = append(r.Results, NewAsyncResult(taskId, b))
+	}
+
+	return r, nil
+}
+
+// Removes the results of a group, the results of its tasks are kept
+func (b *MongoBackend) ForgetGroup(id string) error {
+	_, err := b.groups.DeleteOne(context.Background(), bson.M{"_id": id})
+	return err
+}
+
+// Sets the time results are kept
+func (b *MongoBackend) SetExpires(expires time.Duration) {
+	b.Expires = expires
+}
+
+// Removes the task and group results done before the expiry
+func (b *MongoBackend) Cleanup() error {
+	if b.Expires <= 0 {
+		return nil
+	}
+
+	expired := bson.M{"date_done": bson.M{"$lt": time.Now().Add(-b.Expires).UTC()}}
+
+	for _, c := range []MongoCollection{b.tasks, b.groups} {
+		if _, err := c.DeleteMany(context.Background(), expired); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Disconnects the client dialed by DialMongoBackend
+func (b *MongoBackend) Close() error {
+	if b.client == nil {
+		return nil
+	}
+
+	return b.client.Disconnect(context.Background())
+}
+
+// Returns the database of a mongodb:// or mongodb+srv:// URL, the path
+// following the hosts
+func mongoDatabase(rawurl string) string {
+	rest := rawurl
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+
+	db := ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		db = rest[i+1:]
+	}
+
+	if i := strings.Index(db, "?"); i >= 0 {
+		db = db[:i]
+	}
+
+	if db == "" {
+		return defaultMongoDatabase
+	}
+
+	return db
+}
+
+// Returns the generic JSON value of a decoded BSON value
+func mongoValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case bson.A:
+		values := make([]interface{}, len(value))
+		for i, item := range value {
+			values[i] = mongoValue(item)
+		}
+
+		return values
+
+	case bson.D:
+		m := make(map[string]interface{}, len(value))
+		for _, e := range value {
+			m[e.Key] = mongoValue(e.Value)
+		}
+
+		return m
+
+	case bson.M:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			m[k] = mongoValue(item)
+		}
+
+		return m
+
+	case int32:
+		return float64(value)
+
+	case int64:
+		return float64(value)
+	}
+
+	return v
+}
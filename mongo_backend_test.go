@@ -0,0 +1,137 @@
+package celery
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeCollection struct {
+	docs map[string]bson.Raw
+}
+
+func (f *fakeCollection) ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...options.Lister[options.ReplaceOptions]) (*mongo.UpdateResult, error) {
+	doc, err := bson.Marshal(replacement)
+	if err != nil {
+		return nil, err
+	}
+
+	f.docs[filter.(bson.M)["_id"].(string)] = doc
+
+	return &mongo.UpdateResult{}, nil
+}
+
+func (f *fakeCollection) FindOne(ctx context.Context, filter interface{}, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+	doc, ok := f.docs[filter.(bson.M)["_id"].(string)]
+	if !ok {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func (f *fakeCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error) {
+	delete(f.docs, filter.(bson.M)["_id"].(string))
+	return &mongo.DeleteResult{}, nil
+}
+
+func (f *fakeCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...options.Lister[options.DeleteManyOptions]) (*mongo.DeleteResult, error) {
+	before := filter.(bson.M)["date_done"].(bson.M)["$lt"].(time.Time)
+
+	for id, doc := range f.docs {
+		if doc.Lookup("date_done").Time().Before(before) {
+			delete(f.docs, id)
+		}
+	}
+
+	return &mongo.DeleteResult{}, nil
+}
+
+func TestMongoBackend(t *testing.T) {
+	tasks := &fakeCollection{docs: map[string]bson.Raw{}}
+	groups := &fakeCollection{docs: map[string]bson.Raw{}}
+	b := NewMongoCollectionBackend(tasks, groups)
+
+	if meta, err := b.Get("1234"); err != nil || meta.Status != StatePending {
+		t.Errorf("got %+v, %v", meta, err)
+	}
+
+	done := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	stored := &ResultMeta{TaskId: "1234", Status: StateSuccess, Result: map[string]interface{}{"sum": 3.0}, DateDone: done}
+
+	if err := b.Store(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc bson.M
+	bson.Unmarshal(tasks.docs["1234"], &doc)
+
+	if doc["result"] != `{"sum":3}` || doc["status"] != StateSuccess || doc["traceback"] != nil || doc["date_done"] != bson.NewDateTimeFromTime(done) {
+		t.Errorf("document %v", doc)
+	}
+
+	meta, err := b.Get("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored.Children = []interface{}{}
+	if !reflect.DeepEqual(meta, stored) {
+		t.Errorf("got %+v, expected %+v", meta, stored)
+	}
+
+	if err := b.Forget("1234"); err != nil || len(tasks.docs) != 0 {
+		t.Errorf("forget %v, %d documents", err, len(tasks.docs))
+	}
+
+	r := &GroupResult{Id: "g1", Results: []*AsyncResult{NewAsyncResult("t1", b), NewAsyncResult("t2", b)}}
+	if err := b.SaveGroup(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if saved, err := b.GetGroup("g1"); err != nil || len(saved.Results) != 2 || saved.Results[1].Id != "t2" {
+		t.Errorf("group %+v, %v", saved, err)
+	}
+
+	b.ForgetGroup("g1")
+
+	if _, err := b.GetGroup("g1"); err != ErrGroupNotFound {
+		t.Errorf("forgotten group error %v", err)
+	}
+
+	b.SetExpires(time.Hour)
+
+	b.Store(&ResultMeta{TaskId: "old", Status: StateSuccess, DateDone: time.Now().Add(-2 * time.Hour)})
+	b.Store(&ResultMeta{TaskId: "new", Status: StateSuccess})
+
+	if err := b.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := tasks.docs["old"]; ok || len(tasks.docs) != 1 {
+		t.Errorf("results after cleanup %v", tasks.docs)
+	}
+
+	for rawurl, db := range map[string]string{
+		"mongodb://localhost:27017":                   "celery",
+		"mongodb://u:p@h1:27017,h2:27017/results?w=1": "results",
+		"mongodb+srv://cluster.example.com/":          "celery",
+	} {
+		if name := mongoDatabase(rawurl); name != db {
+			t.Errorf("%s: database %q", rawurl, name)
+		}
+	}
+
+	backend, err := DialBackend("mongodb://localhost:27017/results")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.(*MongoBackend).Close(); err != nil {
+		t.Error(err)
+	}
+}
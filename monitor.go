@@ -0,0 +1,171 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Broker reporting whether it is connected, shown in the status
+// of the workers consuming it
+type ConnectedBroker interface {
+	Broker
+	Connected() bool
+}
+
+var (
+	_ ConnectedBroker = (*AMQPBroker)(nil)
+	_ ConnectedBroker = (*RedisBroker)(nil)
+	_ ConnectedBroker = (*MemoryBroker)(nil)
+)
+
+// Returns whether the broker has an open channel,
+// false while reconnecting and once closed
+func (b *AMQPBroker) Connected() bool {
+	b.mu.RLock()
+	ready := b.ready
+	b.mu.RUnlock()
+
+	select {
+	case <-b.done:
+		return false
+	default:
+	}
+
+	select {
+	case <-ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns whether Redis answers a ping, false once closed
+func (b *RedisBroker) Connected() bool {
+	select {
+	case <-b.done:
+		return false
+	default:
+	}
+
+	return b.client.Ping().Err() == nil
+}
+
+// Returns whether the broker is not closed
+func (b *MemoryBroker) Connected() bool {
+	select {
+	case <-b.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Connection states of the brokers in the worker status
+const (
+	brokerConnected    = "connected"
+	brokerDisconnected = "disconnected"
+	brokerUnknown      = "unknown"
+)
+
+// Returns the connection state of the worker broker,
+// unknown when it does not report one
+func (w *Worker) brokerState() string {
+	cb, ok := w.broker.(ConnectedBroker)
+	if !ok {
+		return brokerUnknown
+	}
+
+	if cb.Connected() {
+		return brokerConnected
+	}
+
+	return brokerDisconnected
+}
+
+// Returns the worker status served by the monitoring endpoints
+func (w *Worker) status() map[string]interface{} {
+	concurrency := w.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return map[string]interface{}{
+		"hostname":    w.Hostname,
+		"ready":       w.Healthy() == nil,
+		"uptime":      int(time.Since(w.started).Seconds()),
+		"concurrency": concurrency,
+		"prefetch":    concurrency * w.PrefetchMultiplier,
+		"active":      w.Active(),
+		"tasks":       w.activeRequests(),
+		"total":       w.stats()["total"],
+		"succeeded":   atomic.LoadInt64(&w.succeeded),
+		"failed":      atomic.LoadInt64(&w.failed),
+		"retried":     atomic.LoadInt64(&w.retried),
+		"broker":      w.brokerState(),
+	}
+}
+
+// Returns the monitoring endpoints of the worker, so Kubernetes
+// probes and dashboards can observe it,
+// /healthz - liveness, always 200 while the process serves requests,
+// /readyz - readiness, 200 while the worker is Healthy, 503 with
+// the error otherwise,
+// /status - the worker status as JSON, its concurrency, the tasks in
+// progress, the processed, succeeded, failed and retried counters
+// and the broker connection state
+func (w *Worker) Monitor() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, map[string]interface{}{"status": "ok"})
+	})
+
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter, r *http.Request) {
+		if err := w.Healthy(); err != nil {
+			writeJSON(rw, http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable", "error": err.Error()})
+			return
+		}
+
+		writeJSON(rw, http.StatusOK, map[string]interface{}{"status": "ok"})
+	})
+
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, w.status())
+	})
+
+	return mux
+}
+
+// Writes v as the JSON body of a response with code
+func writeJSON(rw http.ResponseWriter, code int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(v)
+}
+
+// Serves the monitoring endpoints on addr until shutdown is called
+func (w *Worker) serveMonitor(addr string) (shutdown func(), err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{Handler: w.Monitor()}
+
+	go func() {
+		if err := srv.Serve(l); err != http.ErrServerClosed {
+			w.logger().Error("Monitoring server failed", "addr", addr, "error", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		srv.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,115 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Returns the status code and JSON body of a monitoring endpoint
+func monitor(t *testing.T, h http.Handler, path string) (int, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+
+	return rec.Code, body
+}
+
+func TestWorkerMonitor(t *testing.T) {
+	b := NewMemoryBroker()
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Concurrency = 2
+
+	started, release := make(chan bool, 1), make(chan bool)
+	w.Register("tasks.add", func(task *Task) (interface{}, error) { return 3, nil })
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) { return nil, errors.New("failed") })
+	w.Register("tasks.wait", func(task *Task) (interface{}, error) {
+		started <- true
+		<-release
+		return nil, nil
+	})
+
+	h := w.Monitor()
+
+	if code, _ := monitor(t, h, "/healthz"); code != http.StatusOK {
+		t.Errorf("healthz %d", code)
+	}
+
+	if code, _ := monitor(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz %d before running", code)
+	}
+
+	done := make(chan error)
+	go func() { done <- w.Run() }()
+	defer w.Stop(context.Background())
+
+	p := NewPublisher(b)
+	for _, name := range []string{"tasks.add", "tasks.fail", "tasks.wait"} {
+		x, _ := NewTask(name, nil, nil)
+		p.ApplyAsync(x)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task not executed")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, status := monitor(t, h, "/status")
+		if status["succeeded"] == 1.0 && status["failed"] == 1.0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("status %v", status)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if code, body := monitor(t, h, "/readyz"); code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("readyz %d %v while running", code, body)
+	}
+
+	_, status := monitor(t, h, "/status")
+	if status["concurrency"] != 2.0 || status["active"] != 1.0 || status["broker"] != brokerConnected {
+		t.Errorf("status %v", status)
+	}
+
+	if tasks, _ := status["tasks"].([]interface{}); len(tasks) != 1 || tasks[0].(map[string]interface{})["name"] != "tasks.wait" {
+		t.Errorf("tasks %v", status["tasks"])
+	}
+
+	close(release)
+	b.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not stopped")
+	}
+
+	if code, body := monitor(t, h, "/readyz"); code != http.StatusServiceUnavailable || body["error"] == nil {
+		t.Errorf("readyz %d %v once closed", code, body)
+	}
+}
+
+func TestWorkerMonitorAddr(t *testing.T) {
+	w := NewWorker(NewMemoryBroker(), "celery", "", "celery")
+	w.MonitorAddr = "256.0.0.1:0"
+
+	if err := w.Run(); err == nil {
+		t.Error("worker run without its monitoring endpoints")
+	}
+}
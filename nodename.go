@@ -0,0 +1,28 @@
+package celery
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Returns a Celery node name, name@hostname, the host name of
+// the machine is used when hostname is empty, names already
+// containing a host are returned as they are
+func NodeName(name, hostname string) string {
+	if strings.Contains(name, "@") {
+		return name
+	}
+
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	return name + "@" + hostname
+}
+
+// Returns the node name of a process without one, gen<pid>@<host>
+// as the Celery clients
+func anonNodeName() string {
+	return NodeName("gen"+strconv.Itoa(os.Getpid()), "")
+}
@@ -0,0 +1,198 @@
+package celery
+
+import (
+	"context"
+	"github.com/streadway/amqp"
+	"time"
+)
+
+// Option of a single publish, the keyword arguments of apply_async
+type PublishOption func(*publishOptions)
+
+// Settings of a single publish and the task being published,
+// a copy of the task given to ApplyAsync
+type publishOptions struct {
+	exchange    string
+	key         string
+	serializer  string
+	compression string
+	retry       *RetryPolicy
+	headers     map[string]interface{}
+	mandatory   bool
+	ttl         time.Duration
+	task        *Task
+}
+
+// Publish to a queue through the default exchange
+func WithQueue(queue string) PublishOption {
+	return func(o *publishOptions) {
+		o.exchange = ""
+		o.key = queue
+	}
+}
+
+// Publish to exchange
+func WithExchange(exchange string) PublishOption {
+	return func(o *publishOptions) { o.exchange = exchange }
+}
+
+// Publish with routing key
+func WithRoutingKey(key string) PublishOption {
+	return func(o *publishOptions) { o.key = key }
+}
+
+// Delay the task execution from publishing
+func WithCountdown(countdown time.Duration) PublishOption {
+	return func(o *publishOptions) { o.task.Countdown = countdown }
+}
+
+// Schedule the task execution
+func WithETA(eta time.Time) PublishOption {
+	return func(o *publishOptions) { o.task.ETA = eta }
+}
+
+// Expire the task if not executed by expires
+func WithExpires(expires time.Time) PublishOption {
+	return func(o *publishOptions) { o.task.Expires = expires }
+}
+
+// Expire the task if not executed within expires from publishing,
+// the same as Celery's expires given in seconds
+func WithExpiresIn(expires time.Duration) PublishOption {
+	return func(o *publishOptions) { o.task.ExpiresIn = expires }
+}
+
+// Publish with a message priority
+func WithPriority(priority uint8) PublishOption {
+	return func(o *publishOptions) { o.task.Priority = priority }
+}
+
+// Limit the task execution time, soft limits cancel the handler context
+// and hard limits abandon it
+func WithTimeLimit(hard, soft time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.task.TimeLimit = hard
+		o.task.SoftTimeLimit = soft
+	}
+}
+
+// Display the task under another name in events and logs
+func WithShadow(name string) PublishOption {
+	return func(o *publishOptions) { o.task.Shadow = name }
+}
+
+// Publish the task under a given id
+func WithTaskID(id string) PublishOption {
+	return func(o *publishOptions) { o.task.Id = id }
+}
+
+// Do not store the task states and result, the same as ignore_result
+func WithIgnoreResult() PublishOption {
+	return func(o *publishOptions) { o.task.IgnoreResult = true }
+}
+
+// Send the task result to a reply queue
+func WithReplyTo(queue string) PublishOption {
+	return func(o *publishOptions) { o.task.ReplyTo = queue }
+}
+
+// Apply signatures when the task succeeds
+func WithLink(signatures ...*Signature) PublishOption {
+	return func(o *publishOptions) {
+		o.task.Callbacks = append(o.task.Callbacks[:len(o.task.Callbacks):len(o.task.Callbacks)], signatures...)
+	}
+}
+
+// Apply signatures when the task fails, they receive the id
+// of the failed task as their first arg
+func WithLinkError(signatures ...*Signature) PublishOption {
+	return func(o *publishOptions) {
+		o.task.Errbacks = append(o.task.Errbacks[:len(o.task.Errbacks):len(o.task.Errbacks)], signatures...)
+	}
+}
+
+// Publish with custom message headers, such as tenant ids,
+// headers of the message protocol take precedence
+func WithHeaders(headers map[string]interface{}) PublishOption {
+	return func(o *publishOptions) {
+		h := make(map[string]interface{}, len(o.headers)+len(headers))
+
+		for k, v := range o.headers {
+			h[k] = v
+		}
+
+		for k, v := range headers {
+			h[k] = v
+		}
+
+		o.headers = h
+	}
+}
+
+// Publish with a time to live, the AMQP expiration property, a task
+// still waiting in its queue once ttl elapsed is dropped or dead
+// lettered by the broker, brokers without message TTLs ignore it
+func WithTTL(ttl time.Duration) PublishOption {
+	return func(o *publishOptions) { o.ttl = ttl }
+}
+
+// Publish as mandatory, a task no queue is bound for fails with
+// a *PublishError instead of being dropped, see AMQPBroker.NotifyReturn
+func WithMandatory() PublishOption {
+	return func(o *publishOptions) { o.mandatory = true }
+}
+
+// Serialize the task with a registered serializer instead
+// of the publisher one
+func WithSerializer(name string) PublishOption {
+	return func(o *publishOptions) { o.serializer = name }
+}
+
+// Compress the task with a registered compressor instead
+// of the publisher one
+func WithCompression(name string) PublishOption {
+	return func(o *publishOptions) { o.compression = name }
+}
+
+// Publish a task with options,
+// the task is published to the route picked by the publisher router,
+// or to the "celery" queue by default
+func (p *Publisher) ApplyAsync(t *Task, opts ...PublishOption) error {
+	return p.ApplyAsyncContext(context.Background(), t, opts...)
+}
+
+// Same as ApplyAsync, gives up when ctx is done
+func (p *Publisher) ApplyAsyncContext(ctx context.Context, t *Task, opts ...PublishOption) error {
+	return p.publish(ctx, p.options(t, opts))
+}
+
+// Returns the settings of a copy of t published with opts
+func (p *Publisher) options(t *Task, opts []PublishOption) *publishOptions {
+	task := *t
+
+	o := &publishOptions{
+		key:         "celery",
+		serializer:  p.Serializer,
+		compression: p.Compression,
+		retry:       p.RetryPolicy,
+		task:        &task,
+	}
+
+	if p.Router != nil {
+		if route, ok := p.Router.Route(t.Task); ok {
+			opts = append(route.options(), opts...)
+		}
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// Publish a task with options to an AMQP channel,
+// see Publisher.ApplyAsync
+func (t *Task) ApplyAsync(ch *amqp.Channel, opts ...PublishOption) error {
+	return NewPublisher(NewAMQPBroker(ch)).ApplyAsync(t, opts...)
+}
@@ -0,0 +1,149 @@
+package celery
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type routedBroker struct {
+	recordingBroker
+	exchanges []string
+	keys      []string
+}
+
+func (b *routedBroker) Publish(exchange, key string, msg *Message) error {
+	b.exchanges = append(b.exchanges, exchange)
+	b.keys = append(b.keys, key)
+
+	return b.recordingBroker.Publish(exchange, key, msg)
+}
+
+func TestApplyAsync(t *testing.T) {
+	x, _ := NewTask("tasks.send", nil, nil)
+	expires := time.Now().Add(time.Hour)
+
+	b := &routedBroker{}
+	p := NewPublisher(b)
+
+	err := p.ApplyAsync(x,
+		WithQueue("email"),
+		WithCountdown(30*time.Second),
+		WithPriority(9),
+		WithExpires(expires),
+		WithTaskID("1234"),
+		WithCompression("zlib"),
+		WithShadow("email.welcome"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.exchanges[0] != "" || b.keys[0] != "email" {
+		t.Errorf("published to %q with key %q", b.exchanges[0], b.keys[0])
+	}
+
+	msg := b.messages[0]
+	if msg.Priority != 9 || msg.Headers["compression"] != CompressionZlib {
+		t.Fail()
+	}
+
+	task, err := DecodeTask(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Id != "1234" || task.Priority != 9 || task.Task != "tasks.send" || task.name() != "email.welcome" || !task.Expires.Equal(expires.UTC().Truncate(time.Microsecond)) {
+		t.Errorf("decoded %+v", task)
+	}
+
+	if d := time.Until(task.ETA); d < 20*time.Second || d > 30*time.Second {
+		t.Errorf("eta in %v", d)
+	}
+
+	if x.Id == "1234" || x.Countdown != 0 || x.Priority != 0 {
+		t.Error("options modified the task")
+	}
+
+	if err := p.ApplyAsync(x, WithExchange("tasks"), WithRoutingKey("send")); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.exchanges[1] != "tasks" || b.keys[1] != "send" {
+		t.Errorf("published to %q with key %q", b.exchanges[1], b.keys[1])
+	}
+
+	if err := p.ApplyAsync(x); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.keys[2] != "celery" {
+		t.Errorf("default routing key %q", b.keys[2])
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	x, _ := NewTask("tasks.send", nil, nil)
+
+	b := &routedBroker{}
+	p := NewPublisher(b)
+
+	if err := p.ApplyAsync(x); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Origin = NodeName("billing", "host1")
+	if err := p.ApplyAsync(x); err != nil {
+		t.Fatal(err)
+	}
+
+	if origin, _ := b.messages[0].Headers["origin"].(string); !strings.HasPrefix(origin, "gen") || !strings.Contains(origin, "@") {
+		t.Errorf("published with origin %q", origin)
+	}
+
+	task, _ := DecodeTask(b.messages[1])
+	if task.Origin != "billing@host1" || task.eventFields()["origin"] != "billing@host1" {
+		t.Errorf("decoded origin %q", task.Origin)
+	}
+
+	if x.Origin != "" {
+		t.Error("publishing modified the task")
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	x, _ := NewTask("tasks.send", nil, nil)
+
+	b := &routedBroker{}
+	p := NewPublisher(b)
+
+	for _, protocol := range []int{ProtocolV1, ProtocolV2} {
+		p.Protocol = protocol
+
+		err := p.ApplyAsync(x,
+			WithHeaders(map[string]interface{}{"tenant": "acme", "task": "tasks.other", "id": "1234"}),
+			WithHeaders(map[string]interface{}{"flag": true}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		task, _ := DecodeTask(b.messages[len(b.messages)-1])
+		if task.Task != "tasks.send" || task.Headers["tenant"] != "acme" || task.Headers["flag"] != true {
+			t.Errorf("protocol %d decoded %+v", protocol, task)
+		}
+	}
+}
+
+func TestWithTTL(t *testing.T) {
+	b := &routedBroker{}
+	x, _ := NewTask("tasks.send", nil, nil)
+
+	if err := NewPublisher(b).ApplyAsync(x, WithTTL(90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := b.messages[0]; msg.Expiration != "90000" {
+		t.Errorf("published with expiration %q", msg.Expiration)
+	}
+}
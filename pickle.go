@@ -0,0 +1,268 @@
+package celery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nlpodyssey/gopickle/pickle"
+	"github.com/nlpodyssey/gopickle/types"
+	"math"
+	"math/big"
+)
+
+// Content type of pickled Python bodies
+const ContentTypePickle = "application/x-python-serialize"
+
+var errPickleReadOnly = errors.New("pickle serialization is not supported, pickle bodies can only be decoded")
+
+// Decodes pickled bodies sent by Python producers,
+// tuples, lists and sets become slices, dicts become maps with
+// string keys and objects of other classes become their string form
+type pickleSerializer struct{}
+
+func init() {
+	RegisterSerializer("pickle", ContentTypePickle, "binary", pickleSerializer{})
+}
+
+func (pickleSerializer) Marshal(v interface{}) ([]byte, error) {
+	return nil, errPickleReadOnly
+}
+
+func (pickleSerializer) Unmarshal(data []byte, v interface{}) error {
+	ptr, ok := v.(*interface{})
+	if !ok {
+		return fmt.Errorf("pickle bodies can not be decoded into %T", v)
+	}
+
+	value, err := pickle.Loads(string(data))
+	if err != nil {
+		return err
+	}
+
+	*ptr = pickleValue(value)
+
+	return nil
+}
+
+// Returns the generic JSON value of an unpickled Python value
+func pickleValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil, bool, int, float64, string:
+		return value
+
+	case []byte:
+		return string(value)
+
+	case *big.Int:
+		return json.Number(value.String())
+
+	case *types.Tuple:
+		return pickleValues(*value)
+
+	case *types.List:
+		return pickleValues(*value)
+
+	case *types.Set:
+		values := make([]interface{}, 0, len(*value))
+		for k := range *value {
+			values = append(values, pickleValue(k))
+		}
+
+		return values
+
+	case *types.Dict:
+		m := make(map[string]interface{}, len(*value))
+		for _, entry := range *value {
+			m[pickleKey(entry.Key)] = pickleValue(entry.Value)
+		}
+
+		return m
+
+	case *types.OrderedDict:
+		m := make(map[string]interface{}, len(value.Map))
+		for _, entry := range value.Map {
+			m[pickleKey(entry.Key)] = pickleValue(entry.Value)
+		}
+
+		return m
+	}
+
+	return fmt.Sprint(v)
+}
+
+func pickleValues(values []interface{}) []interface{} {
+	converted := make([]interface{}, len(values))
+	for i, v := range values {
+		converted[i] = pickleValue(v)
+	}
+
+	return converted
+}
+
+func pickleKey(k interface{}) string {
+	if s, ok := pickleValue(k).(string); ok {
+		return s
+	}
+
+	return fmt.Sprint(k)
+}
+
+// Python object created by calling its class with arguments, as pickled
+// by the __reduce__ of Celery's result classes
+type pickleObject struct {
+	Module string
+	Name   string
+	Args   []interface{}
+}
+
+// Keeps no state, the objects are only read for their arguments
+func (o *pickleObject) PySetState(state interface{}) error {
+	return nil
+}
+
+// Python class referenced by a pickle, creates objects of the class
+type pickleClass struct {
+	module, name string
+}
+
+func (c *pickleClass) Call(args ...interface{}) (interface{}, error) {
+	return &pickleObject{Module: c.module, Name: c.name, Args: args}, nil
+}
+
+func (c *pickleClass) PyNew(args ...interface{}) (interface{}, error) {
+	return c.Call(args...)
+}
+
+// Unpickles data, the classes referenced by the pickle are loaded
+// as pickleObject values
+func pickleLoadObjects(data []byte) (interface{}, error) {
+	u := pickle.NewUnpickler(bytes.NewReader(data))
+	u.FindClass = func(module, name string) (interface{}, error) {
+		return &pickleClass{module: module, name: name}, nil
+	}
+
+	return u.Load()
+}
+
+// Pickles a generic JSON value with protocol 2, read by every Python 3
+// release, integral numbers are pickled as ints as json.loads reads them,
+// other Go values are pickled as their JSON encoding is decoded
+func pickleDumps(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.Write([]byte{0x80, 2})
+
+	if err := pickleEncode(&buf, v); err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('.')
+
+	return buf.Bytes(), nil
+}
+
+func pickleEncode(buf *bytes.Buffer, v interface{}) error {
+	switch value := v.(type) {
+	case nil:
+		buf.WriteByte('N')
+
+	case bool:
+		if value {
+			buf.WriteByte(0x88)
+		} else {
+			buf.WriteByte(0x89)
+		}
+
+	case int:
+		pickleInt(buf, int64(value))
+
+	case int64:
+		pickleInt(buf, value)
+
+	case float64:
+		if value == math.Trunc(value) && math.Abs(value) < 1<<63 {
+			pickleInt(buf, int64(value))
+			break
+		}
+
+		buf.WriteByte('G')
+		binary.Write(buf, binary.BigEndian, value)
+
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			pickleInt(buf, i)
+			break
+		}
+
+		f, err := value.Float64()
+		if err != nil {
+			return err
+		}
+
+		return pickleEncode(buf, f)
+
+	case string:
+		buf.WriteByte('X')
+		binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+		buf.WriteString(value)
+
+	case []interface{}:
+		buf.WriteString("](")
+
+		for _, item := range value {
+			if err := pickleEncode(buf, item); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte('e')
+
+	case map[string]interface{}:
+		buf.WriteString("}(")
+
+		for k, item := range value {
+			pickleEncode(buf, k)
+
+			if err := pickleEncode(buf, item); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte('u')
+
+	case *pickleObject:
+		buf.WriteString("c" + value.Module + "\n" + value.Name + "\n(")
+
+		for _, arg := range value.Args {
+			if err := pickleEncode(buf, arg); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteString("tR")
+
+	default:
+		generic, err := encodeResult(value)
+		if err != nil {
+			return err
+		}
+
+		return pickleEncode(buf, generic)
+	}
+
+	return nil
+}
+
+// Pickles an int, as a 4 bytes BININT when it fits or a LONG1
+func pickleInt(buf *bytes.Buffer, i int64) {
+	if i >= math.MinInt32 && i <= math.MaxInt32 {
+		buf.WriteByte('J')
+		binary.Write(buf, binary.LittleEndian, int32(i))
+		return
+	}
+
+	buf.Write([]byte{0x8a, 8})
+	binary.Write(buf, binary.LittleEndian, i)
+}
@@ -0,0 +1,83 @@
+package celery
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPickleV2(t *testing.T) {
+	msg := &Message{
+		ContentType: ContentTypePickle,
+		Headers:     map[string]interface{}{"task": "tasks.add", "id": "1234"},
+		Body:        []byte("\x80\x04\x95d\x00\x00\x00\x00\x00\x00\x00(K\x01\x8c\x03two\x94\x8a\t\x00\x00\x00\x00\x00\x00\x00\x00@C\x03raw\x94t\x94}\x94\x8c\x01a\x94]\x94(G?\xf8\x00\x00\x00\x00\x00\x00N\x88es}\x94(\x8c\tcallbacks\x94N\x8c\x08errbacks\x94N\x8c\x05chain\x94N\x8c\x05chord\x94Nu\x87\x94."),
+	}
+
+	task, err := DecodeTask(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []interface{}{json.Number("1"), "two", json.Number("1180591620717411303424"), "raw"}
+	if !reflect.DeepEqual(task.Args, args) {
+		t.Errorf("decoded args %v", task.Args)
+	}
+
+	kwargs := map[string]interface{}{"a": []interface{}{json.Number("1.5"), nil, true}}
+	if !reflect.DeepEqual(task.KWArgs, kwargs) {
+		t.Errorf("decoded kwargs %v", task.KWArgs)
+	}
+}
+
+func TestPickleV1(t *testing.T) {
+	msg := &Message{
+		ContentType: ContentTypePickle,
+		Body:        []byte("\x80\x02}q\x00(X\x04\x00\x00\x00taskq\x01X\t\x00\x00\x00tasks.addq\x02X\x02\x00\x00\x00idq\x03X\x04\x00\x00\x001234q\x04X\x04\x00\x00\x00argsq\x05K\x01K\x02\x86q\x06X\x06\x00\x00\x00kwargsq\x07}q\x08X\x07\x00\x00\x00retriesq\tK\x00X\x03\x00\x00\x00etaq\nNX\x07\x00\x00\x00expiresq\x0bNu."),
+	}
+
+	task, _ := DecodeTask(msg)
+	if task.Task != "tasks.add" || task.Id != "1234" {
+		t.Fatal(task)
+	}
+
+	if !reflect.DeepEqual(task.Args, []interface{}{json.Number("1"), json.Number("2")}) {
+		t.Errorf("decoded args %v", task.Args)
+	}
+}
+
+func TestPickleReadOnly(t *testing.T) {
+	x, _ := NewTask("tasks.add", nil, nil)
+
+	p := NewPublisher(&recordingBroker{})
+	p.Serializer = "pickle"
+
+	if err := p.Publish(x, "", "celery"); err != errPickleReadOnly {
+		t.Errorf("published pickle, %v", err)
+	}
+}
+
+func TestPickleDumps(t *testing.T) {
+	v := map[string]interface{}{
+		"list":   []interface{}{nil, true, false, 3.0, 1.5, "é", float64(1 << 40)},
+		"number": -7,
+	}
+
+	data, err := pickleDumps(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := pickleLoadObjects(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"list":   []interface{}{nil, true, false, 3, 1.5, "é", 1 << 40},
+		"number": -7,
+	}
+
+	if value := pickleValue(loaded); !reflect.DeepEqual(value, expected) {
+		t.Errorf("got %#v, expected %#v", value, expected)
+	}
+}
@@ -0,0 +1,113 @@
+package celery
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"sync"
+)
+
+var errPoolClosed = errors.New("pool closed")
+
+// Pool of AMQP connections to a broker url, the connections are dialed
+// on first use and dialed again once broken, channels are opened on
+// them in turn,
+// Dial - optional function dialing the connections, such as one
+// calling amqp.DialTLS, amqp.Dial by default
+type Pool struct {
+	Dial func(url string) (*amqp.Connection, error)
+
+	url string
+
+	mu     sync.Mutex
+	conns  []*amqp.Connection
+	next   int
+	closed bool
+}
+
+// Returns a pointer to a new pool of size connections to url,
+// nothing is dialed until a channel is requested
+func NewPool(url string, size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+
+	return &Pool{url: url, conns: make([]*amqp.Connection, size)}
+}
+
+// Returns the next connection of the pool, dialed when not connected
+// yet or broken
+func (p *Pool) Connection() (*amqp.Connection, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errPoolClosed
+	}
+
+	i := p.next
+	p.next = (p.next + 1) % len(p.conns)
+
+	if conn := p.conns[i]; conn != nil && !conn.IsClosed() {
+		return conn, nil
+	}
+
+	dial := p.Dial
+	if dial == nil {
+		dial = amqp.Dial
+	}
+
+	conn, err := dial(p.url)
+	if err != nil {
+		return nil, err
+	}
+
+	p.conns[i] = conn
+
+	return conn, nil
+}
+
+// Opens a channel on the next connection of the pool, the caller
+// closes it once done
+func (p *Pool) Channel() (*amqp.Channel, error) {
+	conn, err := p.Connection()
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.Channel()
+}
+
+// Returns a pointer to a new AMQP broker on a channel of the pool,
+// consumers stop when the channel is closed
+func (p *Pool) Broker() (*AMQPBroker, error) {
+	ch, err := p.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAMQPBroker(ch), nil
+}
+
+// Closes the connections of the pool and their channels
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	var err error
+
+	for i, conn := range p.conns {
+		if conn == nil {
+			continue
+		}
+
+		if cerr := conn.Close(); cerr != nil && err == nil && cerr != amqp.ErrClosed {
+			err = cerr
+		}
+
+		p.conns[i] = nil
+	}
+
+	return err
+}
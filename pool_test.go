@@ -0,0 +1,44 @@
+package celery
+
+import (
+	"errors"
+	"github.com/streadway/amqp"
+	"testing"
+)
+
+func TestPoolConnection(t *testing.T) {
+	p := NewPool("amqp://localhost", 2)
+
+	dials := 0
+	p.Dial = func(url string) (*amqp.Connection, error) {
+		if dials++; dials == 1 {
+			return nil, errors.New("connection refused")
+		}
+
+		return &amqp.Connection{}, nil
+	}
+
+	if _, err := p.Connection(); err == nil {
+		t.Fatal("failed dial not reported")
+	}
+
+	first, err := p.Connection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, _ := p.Connection()
+	if again, _ := p.Connection(); first == second || again != first || dials != 3 {
+		t.Errorf("dialed %d times", dials)
+	}
+
+	p.mu.Lock()
+	p.conns = make([]*amqp.Connection, 2)
+	p.mu.Unlock()
+
+	p.Close()
+
+	if _, err := p.Channel(); err != errPoolClosed {
+		t.Errorf("got error %v", err)
+	}
+}
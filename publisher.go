@@ -0,0 +1,327 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Celery message protocol versions
+const (
+	ProtocolV1 = 1
+	ProtocolV2 = 2
+)
+
+// Publishes tasks to a broker,
+// Protocol - message protocol version, ProtocolV1 or ProtocolV2,
+// DelayedDelivery - delay tasks with an ETA or countdown in the broker,
+// they are sent with an x-delay header instead of an ETA to an exchange
+// declared with DeclareDelayedExchange (RabbitMQ delayed message plugin),
+// Serializer - registered serializer name or content type of
+// the message bodies, such as "msgpack", JSON by default,
+// Compression - optional compression of the message bodies,
+// a registered compressor name or content type such as "zlib",
+// Router - optional router picking the destination of the tasks
+// published with ApplyAsync, options given to ApplyAsync take precedence,
+// RetryPolicy - optional policy retrying the publishes failing with
+// transient broker errors, such as DefaultRetryPolicy,
+// Events - optional dispatcher of the task-sent events,
+// the same as Celery's task_send_sent_event,
+// Logger - optional logger, the package one by default,
+// Metrics - optional observer of the published tasks,
+// Tracer - optional tracer of the published tasks, their trace
+// context is propagated in the message headers,
+// Origin - node name sent in the origin header of the tasks,
+// gen<pid>@<host> by default as the Celery clients
+type Publisher struct {
+	Protocol        int
+	DelayedDelivery bool
+	Serializer      string
+	Compression     string
+	Router          Router
+	RetryPolicy     *RetryPolicy
+	Events          *EventDispatcher
+	Logger          Logger
+	Metrics         Metrics
+	Tracer          Tracer
+	Origin          string
+
+	broker Broker
+	hooks  []PublishHook
+}
+
+// Called with every task about to be published, before it is
+// serialized, hooks may change the task and add to the custom headers
+// it is published with, such as trace context, an error vetoes
+// the publish and is returned to the caller
+type PublishHook func(ctx context.Context, t *Task, headers map[string]interface{}) error
+
+// Adds hooks called in order before every publish, hooks must be
+// added before the publisher is used
+func (p *Publisher) Use(hooks ...PublishHook) {
+	p.hooks = append(p.hooks, hooks...)
+}
+
+// Returns a pointer to a new publisher using protocol v2
+func NewPublisher(b Broker) *Publisher {
+	return &Publisher{broker: b, Protocol: ProtocolV2}
+}
+
+// Publishes tasks with apply_async style options, implemented by
+// *Publisher and by test doubles such as celerytest.Recorder
+type TaskPublisher interface {
+	ApplyAsync(t *Task, opts ...PublishOption) error
+	ApplyAsyncContext(ctx context.Context, t *Task, opts ...PublishOption) error
+}
+
+var _ TaskPublisher = (*Publisher)(nil)
+
+// Publish a task,
+// default exchange is "",
+// default routing key is "celery"
+func (p *Publisher) Publish(t *Task, exchange, key string) error {
+	return p.PublishContext(context.Background(), t, exchange, key)
+}
+
+// Same as Publish, gives up when ctx is done
+func (p *Publisher) PublishContext(ctx context.Context, t *Task, exchange, key string) error {
+	return p.ApplyAsyncContext(ctx, t, WithExchange(exchange), WithRoutingKey(key))
+}
+
+// Publishes the task of o with its settings
+func (p *Publisher) publish(ctx context.Context, o *publishOptions) error {
+	ctx, msg, finish, err := p.prepare(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	err = o.retry.do(ctx, func() error {
+		return publishContext(ctx, p.broker, o.exchange, o.key, msg)
+	})
+
+	finish(err)
+
+	return err
+}
+
+// Returns the message of the task of o, and the func to call with
+// the publish error once sent, the returned context carries the
+// publish span when traced, tasks published from the context of
+// a handler are children of its task
+func (p *Publisher) prepare(ctx context.Context, o *publishOptions) (context.Context, *Message, func(error), error) {
+	t := o.task
+	delay := time.Duration(0)
+
+	if parent, ok := RequestFromContext(ctx); ok && t.ParentID == "" {
+		t.childOf(parent.Task)
+	}
+
+	if t.Origin == "" {
+		t.Origin = p.Origin
+	}
+
+	if t.Origin == "" {
+		t.Origin = anonNodeName()
+	}
+
+	if len(p.hooks) > 0 && o.headers == nil {
+		o.headers = map[string]interface{}{}
+	}
+
+	for _, hook := range p.hooks {
+		if err := hook(ctx, t, o.headers); err != nil {
+			return ctx, nil, nil, err
+		}
+	}
+
+	var sent map[string]interface{}
+	if p.Events != nil {
+		sent = t.eventFields()
+		sent["queue"] = o.key
+		sent["exchange"] = o.exchange
+		sent["routing_key"] = o.key
+	}
+
+	if p.DelayedDelivery {
+		delay = time.Until(t.eta())
+
+		t.ETA = time.Time{}
+		t.Countdown = 0
+	}
+
+	msg, err := t.message(p.Protocol)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+
+	msg.Mandatory = o.mandatory
+
+	if o.ttl > 0 {
+		msg.Expiration = strconv.FormatInt(o.ttl.Milliseconds(), 10)
+	}
+
+	// task and id headers would make a v1 message look like a v2 one
+	for k, v := range o.headers {
+		if msg.Headers == nil {
+			msg.Headers = map[string]interface{}{}
+		}
+
+		if _, ok := msg.Headers[k]; !ok && k != "task" && k != "id" {
+			msg.Headers[k] = v
+		}
+	}
+
+	if delay > 0 {
+		if msg.Headers == nil {
+			msg.Headers = map[string]interface{}{}
+		}
+
+		msg.Headers["x-delay"] = int64(delay / time.Millisecond)
+	}
+
+	if err := serialize(msg, o.serializer); err != nil {
+		return ctx, nil, nil, err
+	}
+
+	if o.compression != "" {
+		if err := compress(msg, o.compression); err != nil {
+			return ctx, nil, nil, err
+		}
+	}
+
+	end := func(error) {}
+
+	if p.Tracer != nil {
+		if msg.Headers == nil {
+			msg.Headers = map[string]interface{}{}
+		}
+
+		ctx, end = p.Tracer.StartPublish(ctx, t, msg.Headers)
+	}
+
+	finish := func(err error) {
+		end(err)
+
+		metricsOr(p.Metrics).TaskPublished(t.Task, err)
+
+		if err == nil && p.Events != nil {
+			if err := p.Events.Send(EventTaskSent, sent); err != nil {
+				loggerOr(p.Logger).Error("Failed to send task-sent event", "id", t.Id, "error", err)
+			}
+		}
+	}
+
+	return ctx, msg, finish, nil
+}
+
+// Publish a task and return its pending result,
+// tasks published without a reply queue get the one of an rpc backend
+func (p *Publisher) PublishWithResult(t *Task, exchange, key string, backend ResultBackend) (*AsyncResult, error) {
+	if rpc, ok := backend.(*RPCBackend); ok && t.ReplyTo == "" {
+		t.ReplyTo = rpc.ReplyTo()
+	}
+
+	if err := p.Publish(t, exchange, key); err != nil {
+		return nil, err
+	}
+
+	return NewAsyncResult(t.Id, backend), nil
+}
+
+// Returns the message for a task in the given protocol version
+func (t *Task) message(protocol int) (*Message, error) {
+	msg := &Message{
+		DeliveryMode:    Persistent,
+		Priority:        t.Priority,
+		Timestamp:       time.Now(),
+		ContentType:     ContentTypeJSON,
+		ContentEncoding: "utf-8",
+		ReplyTo:         t.ReplyTo,
+		CorrelationId:   t.Id,
+	}
+
+	var err error
+
+	if protocol == ProtocolV2 {
+		msg.Headers = t.headers()
+		msg.Body, err = t.bodyV2()
+	} else {
+		msg.Body, err = json.Marshal(t)
+	}
+
+	return msg, err
+}
+
+// Returns the protocol v2 message headers carrying the task metadata
+func (t *Task) headers() map[string]interface{} {
+	h := map[string]interface{}{
+		"lang":          "go",
+		"task":          t.Task,
+		"id":            t.Id,
+		"root_id":       t.root(),
+		"parent_id":     t.parent(),
+		"group":         nil,
+		"group_index":   nil,
+		"shadow":        nil,
+		"retries":       t.Retries,
+		"timelimit":     []interface{}{headerSeconds(t.TimeLimit), headerSeconds(t.SoftTimeLimit)},
+		"eta":           nil,
+		"expires":       nil,
+		"ignore_result": t.IgnoreResult,
+	}
+
+	if t.GroupID != "" {
+		h["group"] = t.GroupID
+		h["group_index"] = t.GroupIndex
+	}
+
+	if t.Shadow != "" {
+		h["shadow"] = t.Shadow
+	}
+
+	if t.Origin != "" {
+		h["origin"] = t.Origin
+	}
+
+	if eta := t.eta(); !eta.IsZero() {
+		h["eta"] = eta.UTC().Format(isoTimeFormat)
+	}
+
+	if expires := t.expires(); !expires.IsZero() {
+		h["expires"] = expires.UTC().Format(isoTimeFormat)
+	}
+
+	return h
+}
+
+// Returns a duration header value in seconds, null when unset
+func headerSeconds(d time.Duration) interface{} {
+	if d <= 0 {
+		return nil
+	}
+
+	return d.Seconds()
+}
+
+// Returns the protocol v2 message body, [args, kwargs, embed]
+func (t *Task) bodyV2() ([]byte, error) {
+	args := t.Args
+	if args == nil {
+		args = []interface{}{}
+	}
+
+	kwargs := t.KWArgs
+	if kwargs == nil {
+		kwargs = map[string]interface{}{}
+	}
+
+	embed := map[string]interface{}{
+		"callbacks": t.Callbacks,
+		"errbacks":  t.Errbacks,
+		"chain":     reverseChain(t.Chain),
+		"chord":     t.Chord,
+	}
+
+	return json.Marshal([]interface{}{args, kwargs, embed})
+}
@@ -0,0 +1,187 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/streadway/amqp"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageV1(t *testing.T) {
+	x, err := NewTask("task name", []string{"1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := x.message(ProtocolV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Headers != nil || msg.CorrelationId != x.Id || msg.ContentType != "application/json" {
+		t.Fail()
+	}
+
+	if task, _ := DecodeTask(msg); task.CorrelationID != x.Id {
+		t.Errorf("decoded correlation id %q", task.CorrelationID)
+	}
+
+	body, _ := x.MarshalJSON()
+	if !reflect.DeepEqual(msg.Body, body) {
+		t.Fail()
+	}
+}
+
+func TestMessageV2(t *testing.T) {
+	kwargs := map[string]interface{}{"a": "b"}
+
+	x, err := NewTask("task name", []string{"1", "2"}, kwargs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x.Retries = 2
+	x.ETA = time.Date(2014, 1, 1, 12, 34, 56, 0, time.UTC)
+
+	msg, err := x.message(ProtocolV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := amqp.Table(msg.Headers).Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Headers["task"] != "task name" || msg.Headers["id"] != x.Id || msg.Headers["lang"] != "go" {
+		t.Fail()
+	}
+
+	if msg.Headers["eta"] != "2014-01-01T12:34:56.000000+00:00" || msg.Headers["expires"] != nil || msg.Headers["retries"] != 2 {
+		t.Fail()
+	}
+
+	if msg.CorrelationId != x.Id {
+		t.Fail()
+	}
+
+	body := []interface{}{}
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body) != 3 {
+		t.Fatal(body)
+	}
+
+	if !reflect.DeepEqual(body[0], []interface{}{"1", "2"}) {
+		t.Fail()
+	}
+
+	if !reflect.DeepEqual(body[1], map[string]interface{}{"a": "b"}) {
+		t.Fail()
+	}
+
+	embed, ok := body[2].(map[string]interface{})
+	if !ok {
+		t.Fatal(body[2])
+	}
+
+	for _, key := range []string{"callbacks", "errbacks", "chain", "chord"} {
+		if v, ok := embed[key]; !ok || v != nil {
+			t.Errorf("embed %s", key)
+		}
+	}
+}
+
+type recordingBroker struct {
+	Broker
+	messages []*Message
+}
+
+func (b *recordingBroker) Publish(exchange, key string, msg *Message) error {
+	b.messages = append(b.messages, msg)
+	return nil
+}
+
+func TestCountdown(t *testing.T) {
+	x, err := NewTask("task name", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x.Countdown = time.Minute
+
+	b := &recordingBroker{}
+	p := NewPublisher(b)
+
+	if err := p.Publish(x, "", "celery"); err != nil {
+		t.Fatal(err)
+	}
+
+	eta, err := headerTime(b.messages[0].Headers["eta"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := time.Until(eta); d < 50*time.Second || d > time.Minute {
+		t.Errorf("eta in %v", d)
+	}
+
+	p.DelayedDelivery = true
+
+	if err := p.Publish(x, "", "celery"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := b.messages[1]
+	if msg.Headers["eta"] != nil {
+		t.Fail()
+	}
+
+	if delay, ok := msg.Headers["x-delay"].(int64); !ok || delay < 50000 || delay > 60000 {
+		t.Errorf("x-delay %v", msg.Headers["x-delay"])
+	}
+
+	if x.Countdown != time.Minute {
+		t.Error("publishing modified the task")
+	}
+}
+
+func TestPublishHooks(t *testing.T) {
+	b := &recordingBroker{}
+	p := NewPublisher(b)
+
+	errMaintenance := errors.New("maintenance")
+
+	p.Use(func(ctx context.Context, t *Task, headers map[string]interface{}) error {
+		headers["tenant"] = "acme"
+		t.Shadow = "acme." + t.Task
+		return nil
+	}, func(ctx context.Context, t *Task, headers map[string]interface{}) error {
+		if t.Task == "tasks.blocked" {
+			return errMaintenance
+		}
+		return nil
+	})
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	if err := p.ApplyAsync(x); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := b.messages[0].Headers; h["tenant"] != "acme" || h["shadow"] != "acme.tasks.add" {
+		t.Errorf("published headers %v", h)
+	}
+
+	if x.Shadow != "" {
+		t.Error("hook changed the task of the caller")
+	}
+
+	blocked, _ := NewTask("tasks.blocked", nil, nil)
+	if err := p.ApplyAsync(blocked); err != errMaintenance || len(b.messages) != 1 {
+		t.Errorf("vetoed publish returned %v", err)
+	}
+}
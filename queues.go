@@ -0,0 +1,141 @@
+package celery
+
+import "context"
+
+// Broker with queue administration,
+// QueueLen - returns the number of messages waiting in a queue,
+// Peek - returns up to n messages from the head of a queue, in
+// delivery order, the messages are left in the queue,
+// Purge - removes the messages waiting in a queue, returns their number
+type QueueBroker interface {
+	Broker
+	QueueLen(queue string) (int, error)
+	Peek(queue string, n int) ([]*Message, error)
+	Purge(queue string) (int, error)
+}
+
+var (
+	_ QueueBroker = (*AMQPBroker)(nil)
+	_ QueueBroker = (*RedisBroker)(nil)
+	_ QueueBroker = (*MemoryBroker)(nil)
+)
+
+// Returns the number of ready messages of queue, the unacknowledged
+// ones are not counted
+func (b *AMQPBroker) QueueLen(queue string) (int, error) {
+	ch, err := b.channel(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	q, err := ch.QueueInspect(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	return q.Messages, nil
+}
+
+// Gets up to n messages of queue and requeues them, RabbitMQ marks
+// them redelivered
+func (b *AMQPBroker) Peek(queue string, n int) ([]*Message, error) {
+	ch, err := b.channel(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*Message
+
+	defer func() {
+		for _, msg := range messages {
+			msg.Nack(true)
+		}
+	}()
+
+	for len(messages) < n {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			break
+		}
+
+		messages = append(messages, delivered(d))
+	}
+
+	peeked := make([]*Message, len(messages))
+	for i, msg := range messages {
+		m := *msg
+		m.Acknowledger = nil
+		peeked[i] = &m
+	}
+
+	return peeked, nil
+}
+
+// Purges the ready messages of queue
+func (b *AMQPBroker) Purge(queue string) (int, error) {
+	ch, err := b.channel(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	return ch.QueuePurge(queue, false)
+}
+
+// Returns the number of messages in the lists of queue
+func (b *RedisBroker) QueueLen(queue string) (int, error) {
+	total := 0
+
+	for _, key := range priorityKeys(queue) {
+		n, err := b.client.LLen(key).Result()
+		if err != nil {
+			return 0, err
+		}
+
+		total += int(n)
+	}
+
+	return total, nil
+}
+
+// Returns up to n messages of queue, highest priority first,
+// messages that are not Kombu envelopes are skipped
+func (b *RedisBroker) Peek(queue string, n int) ([]*Message, error) {
+	var messages []*Message
+
+	for _, key := range priorityKeys(queue) {
+		if len(messages) >= n {
+			break
+		}
+
+		// messages are popped from the right end of the lists
+		raw, err := b.client.LRange(key, int64(-(n - len(messages))), -1).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := len(raw) - 1; i >= 0; i-- {
+			env, body, err := decodeEnvelope([]byte(raw[i]))
+			if err != nil {
+				continue
+			}
+
+			messages = append(messages, env.message(body))
+		}
+	}
+
+	return messages, nil
+}
+
+// Deletes the lists of queue
+func (b *RedisBroker) Purge(queue string) (int, error) {
+	n, err := b.QueueLen(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, b.client.Del(priorityKeys(queue)...).Err()
+}
@@ -0,0 +1,110 @@
+package celery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token bucket holding a single token, the same as Kombu's,
+// tasks wait for a token before executing
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// Returns the tasks per second of a Celery rate limit,
+// "10/s", "100/m", "1000/h" or a plain number of tasks per second
+func parseRate(rate string) (float64, error) {
+	if rate == "" {
+		return 0, nil
+	}
+
+	count, unit := rate, "s"
+	if i := strings.IndexByte(rate, '/'); i >= 0 {
+		count, unit = rate[:i], rate[i+1:]
+	}
+
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate limit %q", rate)
+	}
+
+	switch unit {
+	case "s":
+		return n, nil
+	case "m":
+		return n / 60, nil
+	case "h":
+		return n / 3600, nil
+	}
+
+	return 0, fmt.Errorf("invalid rate limit %q", rate)
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: 1, last: time.Now()}
+}
+
+// Takes a token and returns the time to wait for it
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > 1 {
+		b.tokens = 1
+	}
+
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Limits the execution rate of a task name with Celery's rate syntax,
+// "10/s", "100/m" or "1000/h", tasks over the limit wait for their
+// turn, an empty or zero rate removes the limit
+func (w *Worker) RateLimit(name, rate string) error {
+	r, err := parseRate(rate)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if r == 0 {
+		delete(w.rateLimits, name)
+		return nil
+	}
+
+	w.rateLimits[name] = newTokenBucket(r)
+
+	return nil
+}
+
+// Waits until a task name is below its rate limit
+func (w *Worker) throttle(name string) {
+	w.mu.RLock()
+	bucket, ok := w.rateLimits[name]
+	w.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	if d := bucket.reserve(); d > 0 {
+		time.Sleep(d)
+	}
+}
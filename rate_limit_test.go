@@ -0,0 +1,61 @@
+package celery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]float64{"": 0, "10": 10, "10/s": 10, "120/m": 2, "7200/h": 2, "0.5/s": 0.5}
+
+	for rate, expected := range cases {
+		if r, err := parseRate(rate); err != nil || r != expected {
+			t.Errorf("%q parsed as %v, %v", rate, r, err)
+		}
+	}
+
+	for _, rate := range []string{"x", "10/d", "-1/s"} {
+		if _, err := parseRate(rate); err == nil {
+			t.Errorf("%q parsed", rate)
+		}
+	}
+}
+
+func TestWorkerRateLimit(t *testing.T) {
+	w := NewWorker(nil, "celery", "", "celery")
+	w.Register("tasks.add", func(task *Task) (interface{}, error) {
+		return nil, nil
+	})
+
+	if err := w.RateLimit("tasks.add", "50/s"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	for i := 0; i < 4; i++ {
+		task, _ := NewTask("tasks.add", nil, nil)
+		msg, _ := delivery(t, task)
+		w.dispatch(msg)
+	}
+
+	if d := time.Since(start); d < 55*time.Millisecond {
+		t.Errorf("4 tasks at 50/s ran in %v", d)
+	}
+
+	if err := w.RateLimit("tasks.add", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	start = time.Now()
+
+	for i := 0; i < 4; i++ {
+		task, _ := NewTask("tasks.add", nil, nil)
+		msg, _ := delivery(t, task)
+		w.dispatch(msg)
+	}
+
+	if d := time.Since(start); d > 20*time.Millisecond {
+		t.Errorf("4 tasks without limit ran in %v", d)
+	}
+}
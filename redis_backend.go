@@ -0,0 +1,95 @@
+package celery
+
+import (
+	"github.com/go-redis/redis"
+	"time"
+)
+
+const resultKeyPrefix = "celery-task-meta-"
+
+// Redis result backend,
+// results are stored as JSON under celery-task-meta-<id> keys,
+// the same layout used by Celery's redis backend,
+// HashTags - store results under celery-task-meta-{<id>} keys instead,
+// hash tagged so the keys of a task share a Redis Cluster slot,
+// Python clients expect keys without tags,
+// Expires - time the results are kept, the TTL of the result keys
+type RedisBackend struct {
+	HashTags bool
+	Expires  time.Duration
+
+	client redis.UniversalClient
+}
+
+// Returns a pointer to a new Redis result backend using client
+func NewRedisBackend(client redis.UniversalClient) *RedisBackend {
+	return &RedisBackend{Expires: defaultResultExpires, client: client}
+}
+
+// Returns a pointer to a new Redis result backend storing hash tagged
+// result keys in a Redis Cluster, the client follows the MOVED and ASK
+// redirections of the cluster up to the MaxRedirects of opts
+func NewRedisClusterBackend(opts *redis.ClusterOptions) *RedisBackend {
+	return &RedisBackend{HashTags: true, Expires: defaultResultExpires, client: redis.NewClusterClient(opts)}
+}
+
+// Returns the key a task result is stored under
+func (b *RedisBackend) resultKey(id string) string {
+	if b.HashTags {
+		return resultKeyPrefix + "{" + id + "}"
+	}
+
+	return resultKeyPrefix + id
+}
+
+// Stores a task result and publishes it on the result key channel
+// for subscribers waiting on the task
+func (b *RedisBackend) Store(meta *ResultMeta) error {
+	body, err := meta.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	key := b.resultKey(meta.TaskId)
+
+	if err := b.client.Set(key, body, b.Expires).Err(); err != nil {
+		return err
+	}
+
+	return b.client.Publish(key, body).Err()
+}
+
+// Sets the time results are kept
+func (b *RedisBackend) SetExpires(expires time.Duration) {
+	b.Expires = expires
+}
+
+// Returns a task result, unknown and expired tasks are reported
+// as PENDING
+func (b *RedisBackend) Get(id string) (*ResultMeta, error) {
+	body, err := b.client.Get(b.resultKey(id)).Bytes()
+	if err == redis.Nil {
+		return &ResultMeta{TaskId: id, Status: StatePending}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &ResultMeta{}
+	if err := meta.UnmarshalJSON(body); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// Removes a task result
+func (b *RedisBackend) Forget(id string) error {
+	return b.client.Del(b.resultKey(id)).Err()
+}
+
+// Closes the Redis client
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
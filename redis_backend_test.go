@@ -0,0 +1,141 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"testing"
+	"time"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(s.Close)
+
+	return s, redis.NewClient(&redis.Options{Addr: s.Addr()})
+}
+
+func TestRedisBackend(t *testing.T) {
+	s, client := newTestRedis(t)
+	b := NewRedisBackend(client)
+
+	meta, err := b.Get("123abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.TaskId != "123abc" || meta.Status != StatePending {
+		t.Fail()
+	}
+
+	err = b.Store(&ResultMeta{TaskId: "123abc", Status: StateSuccess, Result: "ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Exists("celery-task-meta-123abc") {
+		t.Fatal("result key not set")
+	}
+
+	if ttl := s.TTL("celery-task-meta-123abc"); ttl != defaultResultExpires {
+		t.Errorf("default result TTL %v", ttl)
+	}
+
+	meta, err = b.Get("123abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.Status != StateSuccess || meta.Result != "ok" {
+		t.Fail()
+	}
+
+	if err := b.Forget("123abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Exists("celery-task-meta-123abc") {
+		t.Fail()
+	}
+
+	b.SetExpires(time.Hour)
+
+	if err := b.Store(&ResultMeta{TaskId: "123abc", Status: StateSuccess}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := s.TTL("celery-task-meta-123abc"); ttl != time.Hour {
+		t.Errorf("result TTL %v", ttl)
+	}
+}
+
+func TestWorkerRedisResult(t *testing.T) {
+	s, client := newTestRedis(t)
+
+	type sum struct {
+		Total int `json:"total"`
+	}
+
+	w := NewWorker(nil, "celery", "", "celery")
+	w.Backend = NewRedisBackend(client)
+	w.Register("tasks.add", func(task *Task) (interface{}, error) { return sum{Total: 3}, nil })
+	w.Register("tasks.chan", func(task *Task) (interface{}, error) { return make(chan int), nil })
+
+	added, _ := NewTask("tasks.add", nil, nil)
+	msg, _ := delivery(t, added)
+	w.dispatch(msg)
+
+	body, err := s.Get("celery-task-meta-" + added.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var meta map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ := meta["result"].(map[string]interface{})
+	if meta["status"] != StateSuccess || meta["task_id"] != added.Id || result["total"] != 3.0 ||
+		meta["traceback"] != nil || meta["date_done"] == nil || meta["children"] == nil {
+		t.Errorf("stored %s", body)
+	}
+
+	unencodable, _ := NewTask("tasks.chan", nil, nil)
+	msg, _ = delivery(t, unencodable)
+	w.dispatch(msg)
+
+	if _, err := NewAsyncResult(unencodable.Id, w.Backend).Get(context.Background()); err == nil || err.(*TaskError).Type != "EncodeError" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestRedisClusterBackend(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	b := NewRedisClusterBackend(&redis.ClusterOptions{Addrs: []string{s.Addr()}})
+	defer b.Close()
+
+	meta := &ResultMeta{TaskId: "1234", Status: StateSuccess, Result: 3.0}
+	if err := b.Store(meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Exists("celery-task-meta-{1234}") {
+		t.Errorf("keys %v", s.Keys())
+	}
+
+	stored, err := b.Get("1234")
+	if err != nil || stored.Status != StateSuccess || stored.Result != 3.0 {
+		t.Errorf("got %+v, %v", stored, err)
+	}
+}
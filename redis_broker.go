@@ -0,0 +1,342 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redisBindingPrefix = "_kombu.binding."
+	redisBindingSep    = "\x06\x16"
+	redisUnacked       = "unacked"
+	redisUnackedIndex  = "unacked_index"
+	redisPollTimeout   = time.Second
+	redisRetryDelay    = time.Second
+	redisMaxRetryDelay = time.Minute
+)
+
+// Kombu's default priority steps
+var redisPrioritySteps = []uint8{0, 3, 6, 9}
+
+// Redis broker compatible with Kombu's Redis transport,
+// queues are lists messages are LPUSHed to and BRPOPed from,
+// exchange bindings are kept in _kombu.binding.<exchange> sets,
+// priorities are emulated with one list per priority step,
+// as in Kombu 0 is the highest priority, failed pops are retried with
+// exponential backoff,
+// Logger - optional logger, the package one by default
+type RedisBroker struct {
+	Logger Logger
+
+	client redis.UniversalClient
+
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	once sync.Once
+	done chan struct{}
+}
+
+// Settles a message consumed from a Redis queue,
+// unacknowledged messages are tracked in the unacked hash
+// the same way Kombu does for visibility timeout restores
+type redisAcknowledger struct {
+	client redis.UniversalClient
+	queue  string
+	tag    string
+	raw    string
+}
+
+// Returns a pointer to a new Redis broker using client
+func NewRedisBroker(client redis.UniversalClient) *RedisBroker {
+	return &RedisBroker{
+		client:        client,
+		retryDelay:    redisRetryDelay,
+		maxRetryDelay: redisMaxRetryDelay,
+		done:          make(chan struct{}),
+	}
+}
+
+// Returns the queues bound to exchange with routing key,
+// the default exchange routes to the queue named by the key,
+// binding keys may be topic patterns such as "task.#"
+func (b *RedisBroker) lookup(exchange, key string) ([]string, error) {
+	if exchange == "" {
+		return []string{key}, nil
+	}
+
+	bindings, err := b.client.SMembers(redisBindingPrefix + exchange).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var queues []string
+
+	for _, binding := range bindings {
+		parts := strings.Split(binding, redisBindingSep)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if parts[0] == "" || topicMatch(parts[0], key) {
+			queues = append(queues, parts[2])
+		}
+	}
+
+	return queues, nil
+}
+
+// Publish a message to every queue bound to exchange with routing key
+func (b *RedisBroker) Publish(exchange, key string, msg *Message) error {
+	return b.PublishContext(context.Background(), exchange, key, msg)
+}
+
+// Same as Publish, nothing is pushed once ctx is done
+func (b *RedisBroker) PublishContext(ctx context.Context, exchange, key string, msg *Message) error {
+	queues, err := b.lookup(exchange, key)
+	if err != nil {
+		return err
+	}
+
+	if len(queues) == 0 && msg.Mandatory {
+		return unroutable(exchange, key, msg)
+	}
+
+	payload, err := encodeEnvelope(exchange, key, msg)
+	if err != nil {
+		return err
+	}
+
+	for _, queue := range queues {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := b.client.LPush(priorityKey(queue, msg.Priority), payload).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the error of a mandatory message no queue is bound for
+func unroutable(exchange, key string, msg *Message) error {
+	return &PublishError{Exchange: exchange, RoutingKey: key, Reason: "NO_ROUTE", Body: msg.Body}
+}
+
+// Binds queue to exchange with key and starts consuming it
+func (b *RedisBroker) Consume(queue, exchange, key string) (<-chan *Message, error) {
+	return b.ConsumeContext(context.Background(), queue, exchange, key)
+}
+
+// Same as Consume, stops popping messages once ctx is done
+func (b *RedisBroker) ConsumeContext(ctx context.Context, queue, exchange, key string) (<-chan *Message, error) {
+	if exchange != "" {
+		if err := b.BindQueue(queue, exchange, key); err != nil {
+			return nil, err
+		}
+	}
+
+	messages := make(chan *Message)
+
+	go b.receive(ctx, queue, messages)
+
+	return messages, nil
+}
+
+// Pops messages from queue until ctx is done or the broker is closed,
+// messages that cannot be tracked are pushed back where they were
+// popped and popping is retried with exponential backoff
+func (b *RedisBroker) receive(ctx context.Context, queue string, messages chan<- *Message) {
+	defer close(messages)
+
+	delay := b.retryDelay
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.done:
+			return
+		default:
+		}
+
+		res, err := b.client.BRPop(redisPollTimeout, priorityKeys(queue)...).Result()
+		if err == redis.Nil {
+			continue
+		}
+
+		var msg *Message
+
+		if err == nil {
+			if msg, err = b.delivered(res[0], res[1]); err != nil {
+				if err := b.client.RPush(res[0], res[1]).Err(); err != nil {
+					loggerOr(b.Logger).Error("Lost message", "queue", queue, "error", err)
+				}
+			}
+		}
+
+		if err != nil {
+			select {
+			case <-b.done:
+				return
+			default:
+			}
+
+			loggerOr(b.Logger).Error("Failed to pop messages", "queue", queue, "error", err, "retry", delay)
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			}
+
+			if delay *= 2; delay > b.maxRetryDelay {
+				delay = b.maxRetryDelay
+			}
+
+			continue
+		}
+
+		delay = b.retryDelay
+
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			msg.Nack(true)
+			return
+		case <-b.done:
+			msg.Nack(true)
+			return
+		}
+	}
+}
+
+// Returns the list a message of the given priority is pushed to,
+// the list of the closest lower priority step
+func priorityKey(queue string, priority uint8) string {
+	step := redisPrioritySteps[0]
+
+	for _, s := range redisPrioritySteps {
+		if s <= priority {
+			step = s
+		}
+	}
+
+	if step == 0 {
+		return queue
+	}
+
+	return queue + redisBindingSep + strconv.Itoa(int(step))
+}
+
+// Returns the lists of a queue, highest priority first
+func priorityKeys(queue string) []string {
+	keys := make([]string, len(redisPrioritySteps))
+
+	for i, step := range redisPrioritySteps {
+		keys[i] = priorityKey(queue, step)
+	}
+
+	return keys
+}
+
+// Returns the message for a Kombu envelope popped from the list key,
+// the message is recorded as unacknowledged, payloads that are not
+// envelopes are returned untracked as the body of a message so
+// consumers report and reject them
+func (b *RedisBroker) delivered(key, raw string) (*Message, error) {
+	ack := &redisAcknowledger{client: b.client, queue: key, raw: raw}
+
+	env, body, err := decodeEnvelope([]byte(raw))
+	if err != nil {
+		return &Message{Body: []byte(raw), RoutingKey: key, Acknowledger: ack}, nil
+	}
+
+	ack.tag = env.Properties.DeliveryTag
+
+	if err := ack.track(env.Properties.DeliveryInfo); err != nil {
+		return nil, err
+	}
+
+	msg := env.message(body)
+	msg.Acknowledger = ack
+
+	return msg, nil
+}
+
+// Redis has no queue declaration, lists are created on first push
+func (b *RedisBroker) DeclareQueue(name string, args map[string]interface{}) error {
+	return nil
+}
+
+// Exchanges only exist through their bindings in Redis
+func (b *RedisBroker) DeclareExchange(name, kind string) error {
+	return nil
+}
+
+// Adds the binding of queue to the exchange bindings set
+func (b *RedisBroker) BindQueue(queue, exchange, key string) error {
+	binding := strings.Join([]string{key, "", queue}, redisBindingSep)
+	return b.client.SAdd(redisBindingPrefix+exchange, binding).Err()
+}
+
+// Stops the consumers and closes the Redis client
+func (b *RedisBroker) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return b.client.Close()
+}
+
+// Records the message in the unacked hash and index, messages
+// without a delivery tag are not tracked
+func (a *redisAcknowledger) track(info kombuDeliveryInfo) error {
+	if a.tag == "" {
+		return nil
+	}
+
+	entry, err := json.Marshal([]interface{}{json.RawMessage(a.raw), info.Exchange, info.RoutingKey})
+	if err != nil {
+		return err
+	}
+
+	pipe := a.client.TxPipeline()
+	pipe.HSet(redisUnacked, a.tag, entry)
+	pipe.ZAdd(redisUnackedIndex, redis.Z{Score: float64(time.Now().Unix()), Member: a.tag})
+	_, err = pipe.Exec()
+
+	return err
+}
+
+// Removes the message from the unacked hash and index
+func (a *redisAcknowledger) Ack() error {
+	pipe := a.client.TxPipeline()
+	pipe.HDel(redisUnacked, a.tag)
+	pipe.ZRem(redisUnackedIndex, a.tag)
+	_, err := pipe.Exec()
+
+	return err
+}
+
+// Settles the message, requeued messages are pushed back on their queue
+func (a *redisAcknowledger) Nack(requeue bool) error {
+	if requeue {
+		if err := a.client.LPush(a.queue, a.raw).Err(); err != nil {
+			return err
+		}
+	}
+
+	return a.Ack()
+}
+
+// Settles the message, requeued messages are pushed back on their queue
+func (a *redisAcknowledger) Reject(requeue bool) error {
+	return a.Nack(requeue)
+}
@@ -0,0 +1,280 @@
+package celery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, messages <-chan *Message) *Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	return nil
+}
+
+func TestRedisBrokerEnvelope(t *testing.T) {
+	s, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+
+	x, err := NewTask("tasks.add", []string{"1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := x.message(ProtocolV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Publish("", "celery", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := s.Lpop("celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := kombuEnvelope{}
+	if err := json.Unmarshal([]byte(raw), &env); err != nil {
+		t.Fatal(err)
+	}
+
+	if env.Properties.BodyEncoding != "base64" || env.Properties.DeliveryTag == "" {
+		t.Fail()
+	}
+
+	if env.Properties.DeliveryInfo.RoutingKey != "celery" || env.Headers["id"] != x.Id {
+		t.Fail()
+	}
+
+	body, _ := base64.StdEncoding.DecodeString(env.Body)
+	if string(body) != string(msg.Body) {
+		t.Fail()
+	}
+}
+
+func TestRedisBrokerConsume(t *testing.T) {
+	s, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	messages, err := b.Consume("celery", "celery", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x, _ := NewTask("tasks.add", []string{"1"}, nil)
+	msg, _ := x.message(ProtocolV2)
+
+	if err := b.Publish("celery", "celery", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	received := receive(t, messages)
+	task, err := DecodeTask(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Id != x.Id || received.Exchange != "celery" || received.RoutingKey != "celery" {
+		t.Fail()
+	}
+
+	if keys, _ := s.HKeys(redisUnacked); len(keys) != 1 {
+		t.Fatal("message not tracked as unacked")
+	}
+
+	if err := received.Nack(true); err != nil {
+		t.Fatal(err)
+	}
+
+	received = receive(t, messages)
+	if err := received.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Exists(redisUnacked) {
+		t.Fail()
+	}
+
+	if err := b.Publish("other", "celery", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Exists("celery") {
+		t.Error("message routed through an exchange without bindings")
+	}
+}
+
+func TestRedisBrokerConsumeErrors(t *testing.T) {
+	s, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	b.retryDelay = time.Millisecond
+	defer b.Close()
+
+	s.SetError("LOADING Redis is loading the dataset in memory")
+
+	messages, err := b.Consume("celery", "", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	s.SetError("")
+
+	// payloads that are not envelopes reach the consumer to be rejected
+	s.Lpush("celery", "not an envelope")
+
+	received := receive(t, messages)
+	if string(received.Body) != "not an envelope" {
+		t.Fatalf("received %+v", received)
+	}
+
+	if _, err := DecodeTask(received); err == nil {
+		t.Error("decoded a payload that is not an envelope")
+	}
+
+	if err := received.Reject(false); err != nil {
+		t.Fatal(err)
+	}
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	msg, _ := x.message(ProtocolV2)
+
+	if err := b.Publish("", "celery", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if task, err := DecodeTask(receive(t, messages)); err != nil || task.Id != x.Id {
+		t.Errorf("received %+v, %v", task, err)
+	}
+}
+
+func TestRedisBrokerConsumeContext(t *testing.T) {
+	_, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, err := b.ConsumeContext(ctx, "celery", "", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Fail()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages not closed")
+	}
+}
+
+func TestRedisBrokerPriority(t *testing.T) {
+	s, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	for _, priority := range []uint8{9, 0, 4} {
+		x, _ := NewTask("tasks.add", nil, nil)
+		x.Priority = priority
+
+		msg, _ := x.message(ProtocolV2)
+		if err := b.Publish("", "celery", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, key := range []string{"celery", "celery\x06\x163", "celery\x06\x169"} {
+		if !s.Exists(key) {
+			t.Errorf("%q not created", key)
+		}
+	}
+
+	messages, err := b.Consume("celery", "", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, priority := range []uint8{0, 4, 9} {
+		msg := receive(t, messages)
+		if msg.Priority != priority {
+			t.Errorf("received priority %d, expected %d", msg.Priority, priority)
+		}
+
+		msg.Ack()
+	}
+}
+
+func TestRedisBrokerMandatory(t *testing.T) {
+	_, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	p := NewPublisher(b)
+
+	if err := p.ApplyAsync(x, WithExchange("tasks"), WithRoutingKey("nowhere")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := p.ApplyAsync(x, WithExchange("tasks"), WithRoutingKey("nowhere"), WithMandatory())
+	if perr, ok := err.(*PublishError); !ok || perr.Exchange != "tasks" || perr.RoutingKey != "nowhere" || len(perr.Body) == 0 {
+		t.Errorf("got error %v", err)
+	}
+
+	if err := p.PublishBatch([]*Task{x}, WithExchange("tasks"), WithMandatory()); err == nil {
+		t.Error("unroutable batch published")
+	}
+}
+
+func TestRedisBrokerQueues(t *testing.T) {
+	_, client := newTestRedis(t)
+	b := NewRedisBroker(client)
+	defer b.Close()
+
+	var ids []string
+	for _, priority := range []uint8{9, 0, 0} {
+		x, _ := NewTask("tasks.add", nil, nil)
+		x.Priority = priority
+		ids = append(ids, x.Id)
+
+		msg, _ := x.message(ProtocolV2)
+		if err := b.Publish("", "celery", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := b.QueueLen("celery"); err != nil || n != 3 {
+		t.Fatalf("queue length %d, %v", n, err)
+	}
+
+	peeked, err := b.Peek("celery", 2)
+	if err != nil || len(peeked) != 2 || peeked[0].CorrelationId != ids[1] || peeked[1].CorrelationId != ids[2] {
+		t.Fatalf("peeked %v, %v", peeked, err)
+	}
+
+	if all, _ := b.Peek("celery", 10); len(all) != 3 || all[2].CorrelationId != ids[0] {
+		t.Errorf("peeked %v", all)
+	}
+
+	if n, err := b.Purge("celery"); err != nil || n != 3 {
+		t.Errorf("purged %d, %v", n, err)
+	}
+
+	if n, _ := b.QueueLen("celery"); n != 0 {
+		t.Errorf("%d messages left", n)
+	}
+}
@@ -0,0 +1,54 @@
+package celery
+
+import "context"
+
+// Delivery info of a consumed task message, the same as Celery's
+// request.delivery_info,
+// Exchange, RoutingKey - where the message was published to,
+// Priority - message priority,
+// Redelivered - whether the message was delivered before,
+// ConsumerTag - tag of the consumer that received the message,
+// DeliveryCount - number of times a message of a quorum queue was
+// returned before, its x-delivery-count header
+type DeliveryInfo struct {
+	Exchange      string
+	RoutingKey    string
+	Priority      uint8
+	Redelivered   bool
+	ConsumerTag   string
+	DeliveryCount int
+}
+
+// Request of a task executed by a worker, the same as Celery's
+// task.request, the task carries its id, ETA, expiration and headers,
+// Task - the executed task,
+// DeliveryInfo - delivery info of the message of the task,
+// Hostname - node name of the worker executing the task
+type Request struct {
+	*Task
+	DeliveryInfo DeliveryInfo
+	Hostname     string
+}
+
+// Returns the request of a message consumed by a worker
+func (w *Worker) request(task *Task, msg *Message) *Request {
+	return &Request{
+		Task: task,
+		DeliveryInfo: DeliveryInfo{
+			Exchange:      msg.Exchange,
+			RoutingKey:    msg.RoutingKey,
+			Priority:      msg.Priority,
+			Redelivered:   msg.Redelivered,
+			ConsumerTag:   msg.ConsumerTag,
+			DeliveryCount: headerInt(msg.Headers[deliveryCountHeader]),
+		},
+		Hostname: w.Hostname,
+	}
+}
+
+// Returns the request of the task executed with ctx,
+// the context given to a ContextTaskHandler carries it
+func RequestFromContext(ctx context.Context) (*Request, bool) {
+	req, ok := ctx.Value(taskKey{}).(*Request)
+	return req, ok
+}
@@ -0,0 +1,188 @@
+package celery
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Celery task states
+const (
+	StatePending  = "PENDING"
+	StateReceived = "RECEIVED"
+	StateStarted  = "STARTED"
+	StateSuccess  = "SUCCESS"
+	StateFailure  = "FAILURE"
+	StateRetry    = "RETRY"
+	StateRevoked  = "REVOKED"
+)
+
+// Default expiry of the results, Celery's result_expires, the
+// Expires of the backends constructed by this package
+const defaultResultExpires = 24 * time.Hour
+
+// Celery task result representation,
+// TaskId - task UUID,
+// Status - task state,
+// Result - task return value, or the exception info for failed tasks,
+// Traceback - optional traceback of a failed task,
+// Children - optional results of sub tasks,
+// ParentId - optional id of the task that published the task,
+// DateDone - optional time the task finished
+type ResultMeta struct {
+	TaskId    string
+	Status    string
+	Result    interface{}
+	Traceback string
+	Children  []interface{}
+	ParentId  string
+	DateDone  time.Time
+}
+
+type FormattedResultMeta struct {
+	TaskId    string        `json:"task_id"`
+	Status    string        `json:"status"`
+	Result    interface{}   `json:"result"`
+	Traceback *string       `json:"traceback"`
+	Children  []interface{} `json:"children"`
+	ParentId  string        `json:"parent_id,omitempty"`
+	DateDone  *string       `json:"date_done"`
+}
+
+// Task results storage,
+// Store - saves a result under its task id,
+// Get - returns the result of a task, a PENDING result when unknown,
+// Forget - removes the result of a task
+type ResultBackend interface {
+	Store(meta *ResultMeta) error
+	Get(id string) (*ResultMeta, error)
+	Forget(id string) error
+}
+
+// Result backend expiring the results it stores, Celery's result_expires,
+// a day unless set,
+// SetExpires - sets the time results are kept, forever when 0
+type ExpiringBackend interface {
+	ResultBackend
+	SetExpires(expires time.Duration)
+}
+
+// Result backend removing expired results on demand, for stores without
+// native expiry, the same as Celery's celery.backend_cleanup task,
+// Cleanup - removes the results older than the expiry
+type CleanupBackend interface {
+	ResultBackend
+	Cleanup() error
+}
+
+// Returns true when the result state will not change anymore
+func (m *ResultMeta) Ready() bool {
+	switch m.Status {
+	case StateSuccess, StateFailure, StateRevoked:
+		return true
+	}
+
+	return false
+}
+
+// Marshals a result into the JSON meta format used by Celery backends,
+// an empty traceback or date done is encoded as null
+func (m *ResultMeta) MarshalJSON() ([]byte, error) {
+	out := FormattedResultMeta{
+		TaskId:   m.TaskId,
+		Status:   m.Status,
+		Result:   m.Result,
+		Children: m.Children,
+		ParentId: m.ParentId,
+	}
+
+	if out.Children == nil {
+		out.Children = []interface{}{}
+	}
+
+	if m.Traceback != "" {
+		out.Traceback = &m.Traceback
+	}
+
+	if !m.DateDone.IsZero() {
+		dateDone := m.DateDone.UTC().Format(timeFormat)
+		out.DateDone = &dateDone
+	}
+
+	return json.Marshal(out)
+}
+
+func (m *ResultMeta) UnmarshalJSON(data []byte) error {
+	meta := FormattedResultMeta{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+
+	m.TaskId = meta.TaskId
+	m.Status = meta.Status
+	m.Result = meta.Result
+	m.Children = meta.Children
+	m.ParentId = meta.ParentId
+	m.Traceback = ""
+	m.DateDone = time.Time{}
+
+	if meta.Traceback != nil {
+		m.Traceback = *meta.Traceback
+	}
+
+	if meta.DateDone != nil && *meta.DateDone != "" {
+		dateDone, err := parseTime(*meta.DateDone, time.UTC)
+		if err != nil {
+			return err
+		}
+
+		m.DateDone = dateDone
+	}
+
+	return nil
+}
+
+// Returns a handler return value as read back from a JSON backend,
+// so structs are stored with their JSON field names and values
+// that cannot be encoded fail the same way for every backend
+func encodeResult(result interface{}) (interface{}, error) {
+	if result == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+
+	return value, err
+}
+
+// Returns the exception info of a failed result, as stored by Celery
+func excInfo(excType, module, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"exc_type":    excType,
+		"exc_module":  module,
+		"exc_message": []interface{}{message},
+	}
+}
+
+// Returns the exception info of a task error, errors of remote tasks
+// keep their exception type
+func errorInfo(err error) map[string]interface{} {
+	var taskErr *TaskError
+
+	switch {
+	case errors.As(err, &taskErr) && taskErr.Type != "":
+		return excInfo(taskErr.Type, "builtins", taskErr.Message)
+	case errors.Is(err, ErrTimeLimitExceeded):
+		return excInfo("TimeLimitExceeded", "billiard.exceptions", err.Error())
+	case errors.Is(err, ErrMaxRetriesExceeded):
+		return excInfo("MaxRetriesExceededError", "celery.exceptions", err.Error())
+	}
+
+	return excInfo("Exception", "builtins", err.Error())
+}
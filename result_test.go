@@ -0,0 +1,57 @@
+package celery
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestResultMetaMarshalJson(t *testing.T) {
+	meta := &ResultMeta{TaskId: "123abc", Status: StatePending}
+
+	b, err := meta.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"task_id", "status", "result", "traceback", "children", "date_done"} {
+		if _, ok := result[key]; !ok {
+			t.Errorf("missing %s", key)
+		}
+	}
+
+	if result["traceback"] != nil || result["date_done"] != nil || result["result"] != nil {
+		t.Fail()
+	}
+
+	if children, ok := result["children"].([]interface{}); !ok || len(children) != 0 {
+		t.Fail()
+	}
+}
+
+func TestResultMetaUnmarshalJson(t *testing.T) {
+	b := []byte("{\"status\": \"SUCCESS\", \"result\": 3, \"traceback\": null, \"children\": [], \"date_done\": \"2014-01-01T12:34:56.123456\", \"task_id\": \"123abc\"}")
+
+	meta := &ResultMeta{}
+	if err := meta.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.TaskId != "123abc" || meta.Status != StateSuccess || !meta.Ready() {
+		t.Fail()
+	}
+
+	if meta.Result != 3.0 || meta.Traceback != "" {
+		t.Fail()
+	}
+
+	expected, _ := time.Parse(timeFormat, "2014-01-01T12:34:56.123456")
+	if !expected.Equal(meta.DateDone) {
+		t.Fail()
+	}
+}
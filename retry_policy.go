@@ -0,0 +1,80 @@
+package celery
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Retries of failed publishes, the same as Kombu's retry_policy,
+// MaxRetries - number of retries before giving up,
+// IntervalStart - delay before the first retry,
+// IntervalStep - delay added after every retry,
+// IntervalMax - upper bound of the delay,
+// Jitter - upper bound of a random delay added to every retry
+type RetryPolicy struct {
+	MaxRetries    int
+	IntervalStart time.Duration
+	IntervalStep  time.Duration
+	IntervalMax   time.Duration
+	Jitter        time.Duration
+}
+
+// Celery's default task_publish_retry_policy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:    3,
+	IntervalStart: 0,
+	IntervalStep:  200 * time.Millisecond,
+	IntervalMax:   200 * time.Millisecond,
+}
+
+// Retry failed publishes with a policy instead of the publisher one
+func WithRetryPolicy(policy *RetryPolicy) PublishOption {
+	return func(o *publishOptions) { o.retry = policy }
+}
+
+// Returns the delay before a retry, counted from 0
+func (p *RetryPolicy) interval(retry int) time.Duration {
+	d := p.IntervalStart + time.Duration(retry)*p.IntervalStep
+	if d > p.IntervalMax {
+		d = p.IntervalMax
+	}
+
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+
+	return d
+}
+
+// Calls publish until it succeeds, it fails with an error not worth
+// retrying, the retries are exhausted or ctx is done,
+// unroutable messages and cancellations are not retried
+func (p *RetryPolicy) do(ctx context.Context, publish func() error) error {
+	err := publish()
+
+	for retry := 0; p != nil && retry < p.MaxRetries && retryable(ctx, err); retry++ {
+		select {
+		case <-time.After(p.interval(retry)):
+		case <-ctx.Done():
+			return err
+		}
+
+		err = publish()
+	}
+
+	return err
+}
+
+// Returns whether a publish error may be transient
+func retryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	if _, ok := err.(*PublishError); ok {
+		return false
+	}
+
+	return err != context.Canceled && err != context.DeadlineExceeded && err != ErrBrokerClosed
+}
@@ -0,0 +1,80 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type flakyBroker struct {
+	recordingBroker
+	failures int
+	err      error
+	attempts int
+}
+
+func (b *flakyBroker) Publish(exchange, key string, msg *Message) error {
+	b.attempts++
+
+	if b.attempts <= b.failures {
+		return b.err
+	}
+
+	return b.recordingBroker.Publish(exchange, key, msg)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	x, _ := NewTask("tasks.add", nil, nil)
+
+	b := &flakyBroker{failures: 2, err: errors.New("connection reset")}
+	p := NewPublisher(b)
+
+	if err := p.Publish(x, "", "celery"); err == nil || b.attempts != 1 {
+		t.Fatalf("published without a retry policy, %d attempts", b.attempts)
+	}
+
+	b.attempts = 0
+	p.RetryPolicy = &RetryPolicy{MaxRetries: 3, IntervalStep: time.Millisecond, IntervalMax: 2 * time.Millisecond, Jitter: time.Millisecond}
+
+	if err := p.Publish(x, "", "celery"); err != nil || b.attempts != 3 || len(b.messages) != 1 {
+		t.Fatalf("%d attempts, %v", b.attempts, err)
+	}
+
+	b.attempts = 0
+	b.failures = 10
+
+	if err := p.Publish(x, "", "celery"); err != b.err || b.attempts != 4 {
+		t.Errorf("%d attempts, %v", b.attempts, err)
+	}
+
+	b.attempts = 0
+	b.err = &PublishError{Reason: "NO_ROUTE"}
+
+	if err := p.Publish(x, "", "celery"); err != b.err || b.attempts != 1 {
+		t.Errorf("unroutable publish retried, %d attempts", b.attempts)
+	}
+
+	b.attempts = 0
+	b.err = errors.New("connection reset")
+	p.RetryPolicy = &RetryPolicy{MaxRetries: 3, IntervalStart: time.Hour, IntervalMax: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := p.PublishContext(ctx, x, "", "celery"); err == nil || b.attempts != 1 {
+		t.Errorf("%d attempts, %v", b.attempts, err)
+	}
+}
+
+func TestRetryPolicyInterval(t *testing.T) {
+	p := DefaultRetryPolicy
+	p.IntervalStep = 100 * time.Millisecond
+	p.IntervalMax = 250 * time.Millisecond
+
+	for retry, expected := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond} {
+		if d := p.interval(retry); d != expected {
+			t.Errorf("retry %d after %v, expected %v", retry, d, expected)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package celery
+
+import (
+	"path"
+	"regexp"
+)
+
+// Destination of a task, the route dicts of Celery's task_routes,
+// Queue - queue the task is sent to through the default exchange,
+// Exchange - exchange the task is published to,
+// RoutingKey - routing key the task is published with, the queue by default,
+// Priority - optional priority of the tasks without one
+type Route struct {
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	Priority   uint8
+}
+
+// Picks the route of a task, tasks without a route are
+// published to the default queue
+type Router interface {
+	Route(task string) (*Route, bool)
+}
+
+// Route of the tasks matching a pattern,
+// Pattern - glob pattern of task names, such as "email.*",
+// Regexp - optional regular expression matched instead of the pattern
+type TaskRoute struct {
+	Pattern string
+	Regexp  *regexp.Regexp
+	Route   Route
+}
+
+// Router of Celery style task_routes, tasks take the route of
+// the first pattern matching their name
+type TaskRoutes []TaskRoute
+
+func (r TaskRoutes) Route(task string) (*Route, bool) {
+	for i := range r {
+		if r[i].match(task) {
+			return &r[i].Route, true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *TaskRoute) match(task string) bool {
+	if r.Regexp != nil {
+		return r.Regexp.MatchString(task)
+	}
+
+	ok, _ := path.Match(r.Pattern, task)
+
+	return ok
+}
+
+// Returns the options publishing to the route
+func (r *Route) options() []PublishOption {
+	var opts []PublishOption
+
+	if r.Queue != "" {
+		opts = append(opts, WithQueue(r.Queue))
+	}
+
+	if r.Exchange != "" {
+		opts = append(opts, WithExchange(r.Exchange))
+	}
+
+	if r.RoutingKey != "" {
+		opts = append(opts, WithRoutingKey(r.RoutingKey))
+	}
+
+	if r.Priority != 0 {
+		priority := r.Priority
+		opts = append(opts, func(o *publishOptions) {
+			if o.task.Priority == 0 {
+				o.task.Priority = priority
+			}
+		})
+	}
+
+	return opts
+}
+
+// Router publishing every task to a topic exchange with its name as
+// routing key, such as reports.daily, so queues bound with patterns
+// such as reports.* or emails.# receive them, see NewTopicQueue,
+// Exchange - the topic exchange, declared with DeclareExchange,
+// Prefix - optional prefix of the routing keys, joined with a dot
+type TopicRouter struct {
+	Exchange string
+	Prefix   string
+}
+
+func (r *TopicRouter) Route(task string) (*Route, bool) {
+	key := task
+	if r.Prefix != "" {
+		key = r.Prefix + "." + task
+	}
+
+	return &Route{Exchange: r.Exchange, RoutingKey: key}, true
+}
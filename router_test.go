@@ -0,0 +1,75 @@
+package celery
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestTaskRoutes(t *testing.T) {
+	routes := TaskRoutes{
+		{Pattern: "email.send", Route: Route{Queue: "email", Priority: 5}},
+		{Pattern: "email.*", Route: Route{Exchange: "email", RoutingKey: "bulk"}},
+		{Regexp: regexp.MustCompile(`^video\.(encode|decode)$`), Route: Route{Queue: "video"}},
+	}
+
+	b := &routedBroker{}
+	p := NewPublisher(b)
+	p.Router = routes
+
+	cases := []struct {
+		task, exchange, key string
+		priority            uint8
+		opts                []PublishOption
+	}{
+		{"email.send", "", "email", 5, nil},
+		{"email.send", "", "email", 1, []PublishOption{WithPriority(1)}},
+		{"email.digest", "email", "bulk", 0, nil},
+		{"email.digest", "", "urgent", 0, []PublishOption{WithQueue("urgent")}},
+		{"video.encode", "", "video", 0, nil},
+		{"video.encoded", "", "celery", 0, nil},
+	}
+
+	for i, c := range cases {
+		x, _ := NewTask(c.task, nil, nil)
+
+		if err := p.ApplyAsync(x, c.opts...); err != nil {
+			t.Fatal(err)
+		}
+
+		if b.exchanges[i] != c.exchange || b.keys[i] != c.key || b.messages[i].Priority != c.priority {
+			t.Errorf("%s routed to %q with key %q and priority %d", c.task, b.exchanges[i], b.keys[i], b.messages[i].Priority)
+		}
+	}
+}
+
+func TestTopicRouting(t *testing.T) {
+	b := NewMemoryBroker()
+
+	if err := DeclareQueue(b, NewTopicQueue("reports", "tasks", "reports.*", "emails.#")); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPublisher(b)
+	p.Router = &TopicRouter{Exchange: "tasks"}
+
+	for _, name := range []string{"reports.daily", "emails.send.bulk", "reports.daily.pdf", "video.encode"} {
+		x, _ := NewTask(name, nil, nil)
+		if err := p.ApplyAsync(x); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := b.Messages("reports")
+	if len(messages) != 2 || messages[0].RoutingKey != "reports.daily" || messages[1].RoutingKey != "emails.send.bulk" {
+		t.Errorf("reports queue holds %v", messages)
+	}
+
+	p.Router = &TopicRouter{Exchange: "tasks", Prefix: "emails"}
+
+	x, _ := NewTask("digest", nil, nil)
+	p.ApplyAsync(x)
+
+	if n, _ := b.QueueLen("reports"); n != 3 {
+		t.Errorf("reports queue holds %d messages", n)
+	}
+}
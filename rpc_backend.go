@@ -0,0 +1,120 @@
+package celery
+
+import (
+	"github.com/streadway/amqp"
+	"sync"
+	"time"
+)
+
+// AMQP result backend, the equivalent of Celery's rpc:// backend,
+// results are sent as messages to the reply queue of the client
+// that published the task, correlated by task id
+type RPCBackend struct {
+	ch    *amqp.Channel
+	queue string
+
+	mu      sync.RWMutex
+	results map[string]*ResultMeta
+}
+
+// Returns a pointer to a new RPC result backend,
+// an exclusive reply queue is declared on ch and consumed until ch is closed
+func NewRPCBackend(ch *amqp.Channel) (*RPCBackend, error) {
+	return newRPCBackend(ch, false)
+}
+
+// Same as NewRPCBackend with RabbitMQ direct reply-to, results are
+// received on the DirectReplyTo pseudo-queue, the tasks must be
+// published on ch
+func NewDirectReplyRPCBackend(ch *amqp.Channel) (*RPCBackend, error) {
+	return newRPCBackend(ch, true)
+}
+
+func newRPCBackend(ch *amqp.Channel, direct bool) (*RPCBackend, error) {
+	queue, deliveries, err := consumeReplies(ch, direct)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &RPCBackend{
+		ch:      ch,
+		queue:   queue,
+		results: make(map[string]*ResultMeta),
+	}
+
+	go b.receive(deliveries)
+
+	return b, nil
+}
+
+// Returns the reply queue name, tasks whose results should be sent
+// to this backend must be published with it as their ReplyTo
+func (b *RPCBackend) ReplyTo() string {
+	return b.queue
+}
+
+// Collects result messages from the reply queue
+func (b *RPCBackend) receive(deliveries <-chan amqp.Delivery) {
+	for msg := range deliveries {
+		meta := &ResultMeta{}
+		if err := meta.UnmarshalJSON(msg.Body); err != nil {
+			loggerOr(nil).Warn("Failed to decode result", "error", err)
+			continue
+		}
+
+		if meta.TaskId == "" {
+			meta.TaskId = msg.CorrelationId
+		}
+
+		b.mu.Lock()
+		b.results[meta.TaskId] = meta
+		b.mu.Unlock()
+	}
+}
+
+// Sends a result to the reply queue replyTo,
+// used by workers executing a task published with a reply queue
+func (b *RPCBackend) Reply(replyTo string, meta *ResultMeta) error {
+	body, err := meta.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	msg := amqp.Publishing{
+		DeliveryMode:    amqp.Transient,
+		Timestamp:       time.Now(),
+		ContentType:     "application/json",
+		ContentEncoding: "utf-8",
+		CorrelationId:   meta.TaskId,
+		Body:            body,
+	}
+
+	return b.ch.Publish("", replyTo, false, false, msg)
+}
+
+// Sends a result to the reply queue of this backend
+func (b *RPCBackend) Store(meta *ResultMeta) error {
+	return b.Reply(b.queue, meta)
+}
+
+// Returns the latest result received for a task,
+// tasks without a result yet are reported as PENDING
+func (b *RPCBackend) Get(id string) (*ResultMeta, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if meta, ok := b.results[id]; ok {
+		return meta, nil
+	}
+
+	return &ResultMeta{TaskId: id, Status: StatePending}, nil
+}
+
+// Drops a received task result
+func (b *RPCBackend) Forget(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.results, id)
+	return nil
+}
@@ -0,0 +1,40 @@
+package celery
+
+import (
+	"github.com/streadway/amqp"
+	"testing"
+)
+
+func TestRPCBackendReceive(t *testing.T) {
+	b := &RPCBackend{results: make(map[string]*ResultMeta)}
+
+	deliveries := make(chan amqp.Delivery, 2)
+	deliveries <- amqp.Delivery{
+		CorrelationId: "123abc",
+		Body:          []byte("{\"task_id\": \"123abc\", \"status\": \"SUCCESS\", \"result\": 3, \"traceback\": null, \"children\": []}"),
+	}
+	deliveries <- amqp.Delivery{
+		CorrelationId: "456def",
+		Body:          []byte("{\"status\": \"FAILURE\", \"result\": null, \"traceback\": \"Traceback\", \"children\": []}"),
+	}
+	close(deliveries)
+
+	b.receive(deliveries)
+
+	meta, _ := b.Get("123abc")
+	if meta.Status != StateSuccess || meta.Result != 3.0 {
+		t.Fail()
+	}
+
+	meta, _ = b.Get("456def")
+	if meta.Status != StateFailure || meta.Traceback != "Traceback" {
+		t.Fail()
+	}
+
+	b.Forget("123abc")
+
+	meta, _ = b.Get("123abc")
+	if meta.Status != StatePending {
+		t.Fail()
+	}
+}
@@ -0,0 +1,140 @@
+package celery
+
+import (
+	"bytes"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Tag of the result objects giving the days they are kept
+const s3ExpiresTag = "celery-expires-days"
+
+// S3 result backend, the same as Celery's s3:// backend storing one
+// object per task, results are stored as JSON under
+// <prefix>celery-task-meta-<id> keys, large results included,
+// Bucket - bucket of the results,
+// Prefix - optional prefix of the keys, Celery's s3_base_path,
+// Expires - time the results are kept, S3 does not expire objects by
+// itself, the objects get an Expires header and a celery-expires-days tag
+// matched by the rule of LifecycleRule
+type S3Backend struct {
+	Bucket  string
+	Prefix  string
+	Expires time.Duration
+
+	client s3iface.S3API
+}
+
+// Returns a pointer to a new S3 result backend storing results
+// in bucket using client
+func NewS3Backend(client s3iface.S3API, bucket string) *S3Backend {
+	return &S3Backend{Bucket: bucket, Expires: defaultResultExpires, client: client}
+}
+
+// Returns the key a task result is stored under
+func (b *S3Backend) resultKey(id string) string {
+	return b.Prefix + resultKeyPrefix + id
+}
+
+// Returns the days the results are kept, rounded up as lifecycle
+// rules count whole days
+func (b *S3Backend) expiresDays() int64 {
+	day := 24 * time.Hour
+	return int64((b.Expires + day - 1) / day)
+}
+
+// Returns the bucket lifecycle rule deleting the results of the
+// backend once they expire, nil without Expires
+func (b *S3Backend) LifecycleRule() *s3.LifecycleRule {
+	if b.Expires <= 0 {
+		return nil
+	}
+
+	days := b.expiresDays()
+
+	return &s3.LifecycleRule{
+		ID:     aws.String("celery-results-" + strconv.FormatInt(days, 10) + "d"),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{
+			And: &s3.LifecycleRuleAndOperator{
+				Prefix: aws.String(b.Prefix + resultKeyPrefix),
+				Tags:   []*s3.Tag{{Key: aws.String(s3ExpiresTag), Value: aws.String(strconv.FormatInt(days, 10))}},
+			},
+		},
+		Expiration: &s3.LifecycleExpiration{Days: aws.Int64(days)},
+	}
+}
+
+// Sets the time results are kept
+func (b *S3Backend) SetExpires(expires time.Duration) {
+	b.Expires = expires
+}
+
+// Stores a task result
+func (b *S3Backend) Store(meta *ResultMeta) error {
+	body, err := meta.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	in := &s3.PutObjectInput{
+		Bucket:      aws.String(b.Bucket),
+		Key:         aws.String(b.resultKey(meta.TaskId)),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	}
+
+	if b.Expires > 0 {
+		in.Expires = aws.Time(time.Now().Add(b.Expires))
+		in.Tagging = aws.String(url.Values{s3ExpiresTag: {strconv.FormatInt(b.expiresDays(), 10)}}.Encode())
+	}
+
+	_, err = b.client.PutObject(in)
+
+	return err
+}
+
+// Returns a task result, unknown and expired tasks are reported
+// as PENDING
+func (b *S3Backend) Get(id string) (*ResultMeta, error) {
+	out, err := b.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.resultKey(id)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return &ResultMeta{TaskId: id, Status: StatePending}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	body, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &ResultMeta{}
+	if err := meta.UnmarshalJSON(body); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// Removes a task result
+func (b *S3Backend) Forget(id string) error {
+	_, err := b.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(b.Bucket),
+		Key:    aws.String(b.resultKey(id)),
+	})
+
+	return err
+}
@@ -0,0 +1,97 @@
+package celery
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string]*s3.PutObjectInput
+	bodies  map[string][]byte
+}
+
+func (f *fakeS3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	body, _ := ioutil.ReadAll(in.Body)
+
+	f.objects[*in.Bucket+"/"+*in.Key] = in
+	f.bodies[*in.Bucket+"/"+*in.Key] = body
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	body, ok := f.bodies[*in.Bucket+"/"+*in.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(string(body)))}, nil
+}
+
+func (f *fakeS3) DeleteObject(in *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, *in.Bucket+"/"+*in.Key)
+	delete(f.bodies, *in.Bucket+"/"+*in.Key)
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestS3Backend(t *testing.T) {
+	f := &fakeS3{objects: map[string]*s3.PutObjectInput{}, bodies: map[string][]byte{}}
+
+	b := NewS3Backend(f, "results")
+	b.Prefix = "celery/"
+	b.Expires = 36 * time.Hour
+
+	if meta, err := b.Get("1234"); err != nil || meta.Status != StatePending {
+		t.Errorf("got %+v, %v", meta, err)
+	}
+
+	if err := b.Store(&ResultMeta{TaskId: "1234", Status: StateSuccess, Result: "large"}); err != nil {
+		t.Fatal(err)
+	}
+
+	in := f.objects["results/celery/celery-task-meta-1234"]
+	if in == nil || *in.Tagging != "celery-expires-days=2" || in.Expires.Before(time.Now().Add(35*time.Hour)) {
+		t.Fatalf("stored %+v", in)
+	}
+
+	if meta, err := b.Get("1234"); err != nil || meta.Status != StateSuccess || meta.Result != "large" {
+		t.Errorf("got %+v, %v", meta, err)
+	}
+
+	rule := b.LifecycleRule()
+	if *rule.Expiration.Days != 2 || *rule.Filter.And.Prefix != "celery/celery-task-meta-" || *rule.Filter.And.Tags[0].Value != "2" {
+		t.Errorf("rule %v", rule)
+	}
+
+	if err := b.Forget("1234"); err != nil || len(f.bodies) != 0 {
+		t.Errorf("forget %v, %d objects", err, len(f.bodies))
+	}
+
+	b.Expires = 0
+	if b.LifecycleRule() != nil {
+		t.Error("lifecycle rule without expiry")
+	}
+
+	u, _ := url.Parse("s3://results/celery/?endpoint_url=http://localhost:9000")
+	if c := s3Config(u, map[string]interface{}{"region": "eu-west-1"}); *c.Region != "eu-west-1" || *c.Endpoint != "http://localhost:9000" || !aws.BoolValue(c.S3ForcePathStyle) {
+		t.Errorf("config %v", c)
+	}
+
+	backend, err := DialBackend("s3://results/celery/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dialed := backend.(*S3Backend); dialed.Bucket != "results" || dialed.Prefix != "celery/" {
+		t.Errorf("dialed %+v", dialed)
+	}
+}
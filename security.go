@@ -0,0 +1,296 @@
+package celery
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Content type of Celery's auth serializer
+const ContentTypeAuth = "application/data"
+
+const authSep = "\x00\x01"
+
+var errBadSignature = errors.New("bad message signature")
+
+// Signs message bodies and verifies the signatures of other signers
+type Signer interface {
+	// Returns the id identifying the signer to the receivers
+	ID() string
+
+	// Returns the signature of data
+	Sign(data []byte) ([]byte, error)
+
+	// Returns the size of the signatures of a trusted signer
+	SignatureSize(signer string) (int, error)
+
+	// Verifies the signature of data made by a trusted signer
+	Verify(signer string, data, signature []byte) error
+}
+
+// Celery's auth serializer, bodies are serialized with an inner
+// serializer and sent with their signature and signer id as
+// base64("signer\x00\x01signature\x00\x01content type\x00\x01content encoding\x00\x01body"),
+// Serializer - inner serializer name or content type, JSON by default
+type AuthSerializer struct {
+	Serializer string
+
+	signer Signer
+}
+
+// Signs with HMAC-SHA256, both ends share the key material
+type HMACSigner struct {
+	id  string
+	key []byte
+
+	mu   sync.RWMutex
+	keys map[string][]byte
+}
+
+// Signs with an RSA key the way Celery's security module does,
+// RSA-PSS with SHA-256, signers are identified by the issuer
+// and serial number of their certificate
+type X509Signer struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+
+	mu    sync.RWMutex
+	certs map[string]*x509.Certificate
+}
+
+// Returns a pointer to a new auth serializer signing with signer
+func NewAuthSerializer(signer Signer) *AuthSerializer {
+	return &AuthSerializer{signer: signer}
+}
+
+// Registers s as the auth serializer and makes it the only
+// content type accepted by consumers, as Celery's setup_security
+func SetupSecurity(s *AuthSerializer) error {
+	RegisterSerializer("auth", ContentTypeAuth, "utf-8", s)
+	return AcceptContent(ContentTypeAuth)
+}
+
+func (s *AuthSerializer) Marshal(v interface{}) ([]byte, error) {
+	e, err := serializer(s.Serializer)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := e.serializer.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := s.signer.Sign(body)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := bytes.Join([][]byte{
+		[]byte(s.signer.ID()),
+		signature,
+		[]byte(e.contentType),
+		[]byte(e.contentEncoding),
+		body,
+	}, []byte(authSep))
+
+	return []byte(base64.StdEncoding.EncodeToString(fields)), nil
+}
+
+// Verifies the signature of a body before decoding it
+// with the serializer of its inner content type
+func (s *AuthSerializer) Unmarshal(data []byte, v interface{}) error {
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return err
+	}
+
+	sep := []byte(authSep)
+
+	i := bytes.Index(raw, sep)
+	if i < 0 {
+		return errBadSignature
+	}
+
+	signer := string(raw[:i])
+
+	size, err := s.signer.SignatureSize(signer)
+	if err != nil {
+		return err
+	}
+
+	raw = raw[i+len(sep):]
+	if len(raw) < size+len(sep) {
+		return errBadSignature
+	}
+
+	signature := raw[:size]
+
+	fields := bytes.SplitN(raw[size+len(sep):], sep, 3)
+	if len(fields) != 3 {
+		return errBadSignature
+	}
+
+	if err := s.signer.Verify(signer, fields[2], signature); err != nil {
+		return err
+	}
+
+	e, err := serializer(string(fields[0]))
+	if err != nil {
+		return err
+	}
+
+	return e.serializer.Unmarshal(fields[2], v)
+}
+
+// Returns a pointer to a new HMAC signer with a key trusted under id
+func NewHMACSigner(id string, key []byte) *HMACSigner {
+	s := &HMACSigner{id: id, key: key, keys: map[string][]byte{}}
+	s.Trust(id, key)
+
+	return s
+}
+
+// Trusts the messages signed with key by signer id
+func (s *HMACSigner) Trust(id string, key []byte) {
+	s.mu.Lock()
+	s.keys[id] = key
+	s.mu.Unlock()
+}
+
+func (s *HMACSigner) ID() string {
+	return s.id
+}
+
+func (s *HMACSigner) Sign(data []byte) ([]byte, error) {
+	return hmacSum(s.key, data), nil
+}
+
+func (s *HMACSigner) SignatureSize(signer string) (int, error) {
+	if _, err := s.trusted(signer); err != nil {
+		return 0, err
+	}
+
+	return sha256.Size, nil
+}
+
+func (s *HMACSigner) Verify(signer string, data, signature []byte) error {
+	key, err := s.trusted(signer)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal(hmacSum(key, data), signature) {
+		return errBadSignature
+	}
+
+	return nil
+}
+
+// Returns the key of a trusted signer
+func (s *HMACSigner) trusted(signer string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[signer]
+	if !ok {
+		return nil, fmt.Errorf("unknown signer %q", signer)
+	}
+
+	return key, nil
+}
+
+func hmacSum(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+
+	return h.Sum(nil)
+}
+
+// Returns a pointer to a new X.509 signer, signing with key
+// and trusting cert, its certificate
+func NewX509Signer(key *rsa.PrivateKey, cert *x509.Certificate) *X509Signer {
+	s := &X509Signer{key: key, cert: cert, certs: map[string]*x509.Certificate{}}
+	s.Trust(cert)
+
+	return s
+}
+
+// Trusts the messages signed with the key of cert
+func (s *X509Signer) Trust(cert *x509.Certificate) {
+	s.mu.Lock()
+	s.certs[certificateID(cert)] = cert
+	s.mu.Unlock()
+}
+
+func (s *X509Signer) ID() string {
+	return certificateID(s.cert)
+}
+
+func (s *X509Signer) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return rsa.SignPSS(rand.Reader, s.key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+}
+
+func (s *X509Signer) SignatureSize(signer string) (int, error) {
+	key, err := s.trusted(signer)
+	if err != nil {
+		return 0, err
+	}
+
+	return key.Size(), nil
+}
+
+func (s *X509Signer) Verify(signer string, data, signature []byte) error {
+	key, err := s.trusted(signer)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(data)
+
+	if err := rsa.VerifyPSS(key, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}); err != nil {
+		return errBadSignature
+	}
+
+	return nil
+}
+
+// Returns the RSA public key of a trusted signer
+func (s *X509Signer) trusted(signer string) (*rsa.PublicKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cert, ok := s.certs[signer]
+	if !ok {
+		return nil, fmt.Errorf("unknown signer %q", signer)
+	}
+
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate of %q has no RSA key", signer)
+	}
+
+	return key, nil
+}
+
+// Returns the id Celery gives a certificate,
+// the values of its issuer followed by its serial number
+func certificateID(cert *x509.Certificate) string {
+	var values []string
+
+	for _, name := range cert.Issuer.Names {
+		values = append(values, fmt.Sprint(name.Value))
+	}
+
+	return strings.Join(values, " ") + " " + cert.SerialNumber.String()
+}
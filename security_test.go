@@ -0,0 +1,110 @@
+package celery
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "worker", Organization: []string{"celery"}},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, cert
+}
+
+func TestAuthSerializer(t *testing.T) {
+	key, cert := newTestCertificate(t)
+
+	signers := []Signer{
+		NewHMACSigner("producer", []byte("secret")),
+		NewX509Signer(key, cert),
+	}
+
+	for _, signer := range signers {
+		s := NewAuthSerializer(signer)
+
+		if err := SetupSecurity(s); err != nil {
+			t.Fatal(err)
+		}
+
+		x, _ := NewTaskArgs("tasks.add", []interface{}{"a"}, map[string]interface{}{"b": "c"})
+
+		b := &recordingBroker{}
+		p := NewPublisher(b)
+		p.Serializer = "auth"
+
+		if err := p.Publish(x, "", "celery"); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := b.messages[0]
+		if msg.ContentType != ContentTypeAuth {
+			t.Errorf("content type %q", msg.ContentType)
+		}
+
+		raw, _ := base64.StdEncoding.DecodeString(string(msg.Body))
+		if !strings.HasPrefix(string(raw), signer.ID()+authSep) {
+			t.Errorf("body not signed by %q", signer.ID())
+		}
+
+		task, err := DecodeTask(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(task.Args, x.Args) || !reflect.DeepEqual(task.KWArgs, x.KWArgs) {
+			t.Errorf("decoded %v %v", task.Args, task.KWArgs)
+		}
+
+		tampered := *msg
+		tampered.Body = []byte(base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(raw), `"a"`, `"z"`, 1))))
+
+		if _, err := DecodeTask(&tampered); err != errBadSignature {
+			t.Errorf("tampered body decoded, %v", err)
+		}
+
+		unsigned, _ := x.message(ProtocolV2)
+		if _, err := DecodeTask(unsigned); err == nil {
+			t.Error("unsigned JSON body accepted")
+		}
+	}
+
+	if err := AcceptContent(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateID(t *testing.T) {
+	_, cert := newTestCertificate(t)
+
+	if id := certificateID(cert); id != "celery worker 42" {
+		t.Errorf("certificate id %q", id)
+	}
+}
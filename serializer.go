@@ -0,0 +1,212 @@
+package celery
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+	"sync"
+)
+
+// Content types of the built in serializers
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeMsgpack = "application/x-msgpack"
+	ContentTypeYAML    = "application/x-yaml"
+)
+
+// Encodes and decodes message bodies,
+// values are the generic ones of a JSON document
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// A registered serializer, the same way Kombu's registry keeps them
+type serializerEntry struct {
+	name            string
+	contentType     string
+	contentEncoding string
+	serializer      Serializer
+}
+
+// Serializers by name and by content type,
+// content types accepted by consumers, all of them when empty
+var (
+	serializersMu sync.RWMutex
+	serializers   = map[string]*serializerEntry{}
+	accepted      = map[string]bool{}
+)
+
+type jsonSerializer struct{}
+
+type msgpackSerializer struct{}
+
+type yamlSerializer struct{}
+
+func init() {
+	RegisterSerializer("json", ContentTypeJSON, "utf-8", jsonSerializer{})
+	RegisterSerializer("msgpack", ContentTypeMsgpack, "binary", msgpackSerializer{})
+	RegisterSerializer("yaml", ContentTypeYAML, "utf-8", yamlSerializer{})
+}
+
+// Registers a serializer under its name and content type,
+// messages are published with contentType and contentEncoding
+// and consumed messages are decoded by their content type
+func RegisterSerializer(name, contentType, contentEncoding string, s Serializer) {
+	serializersMu.Lock()
+	defer serializersMu.Unlock()
+
+	e := &serializerEntry{
+		name:            name,
+		contentType:     contentType,
+		contentEncoding: contentEncoding,
+		serializer:      s,
+	}
+
+	serializers[name] = e
+	serializers[contentType] = e
+}
+
+// Restricts the content types consumed messages may have,
+// the same as Celery's accept_content, serializers are given by
+// name or content type, without any all of them are accepted again
+func AcceptContent(names ...string) error {
+	types := map[string]bool{}
+
+	for _, name := range names {
+		e, err := serializer(name)
+		if err != nil {
+			return err
+		}
+
+		types[e.contentType] = true
+	}
+
+	serializersMu.Lock()
+	accepted = types
+	serializersMu.Unlock()
+
+	return nil
+}
+
+// Returns the serializer registered with a name or content type,
+// JSON is the default
+func serializer(name string) (*serializerEntry, error) {
+	if name == "" {
+		name = ContentTypeJSON
+	}
+
+	serializersMu.RLock()
+	defer serializersMu.RUnlock()
+
+	e, ok := serializers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown serializer %q", name)
+	}
+
+	return e, nil
+}
+
+// Serializes a JSON message body with the named serializer
+// and sets the message content type and encoding
+func serialize(msg *Message, name string) error {
+	e, err := serializer(name)
+	if err != nil {
+		return err
+	}
+
+	msg.ContentType = e.contentType
+	msg.ContentEncoding = e.contentEncoding
+
+	if e.contentType == ContentTypeJSON {
+		return nil
+	}
+
+	var v interface{}
+	if err := unmarshalNumbers(msg.Body, &v); err != nil {
+		return err
+	}
+
+	msg.Body, err = e.serializer.Marshal(plainNumbers(v))
+
+	return err
+}
+
+// Returns a consumed body as JSON, decoded with the serializer
+// of the message content type, content types not accepted are refused
+func deserialize(contentType string, body []byte) ([]byte, error) {
+	e, err := serializer(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	serializersMu.RLock()
+	refused := len(accepted) > 0 && !accepted[e.contentType]
+	serializersMu.RUnlock()
+
+	if refused {
+		return nil, fmt.Errorf("content type %q not accepted", e.contentType)
+	}
+
+	if e.contentType == ContentTypeJSON {
+		return body, nil
+	}
+
+	var v interface{}
+	if err := e.serializer.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// Replaces the json.Number values of a decoded JSON document
+// with integers or floats
+func plainNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := value.Float64()
+		return f
+
+	case []interface{}:
+		for i := range value {
+			value[i] = plainNumbers(value[i])
+		}
+
+	case map[string]interface{}:
+		for k := range value {
+			value[k] = plainNumbers(value[k])
+		}
+	}
+
+	return v
+}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v interface{}) error {
+	return unmarshalNumbers(data, v)
+}
+
+func (msgpackSerializer) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackSerializer) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+func (yamlSerializer) Marshal(v interface{}) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+func (yamlSerializer) Unmarshal(data []byte, v interface{}) error {
+	return yaml.Unmarshal(data, v)
+}
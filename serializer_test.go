@@ -0,0 +1,115 @@
+package celery
+
+import (
+	"encoding/json"
+	"github.com/vmihailenco/msgpack/v5"
+	"reflect"
+	"testing"
+)
+
+func TestMsgpackSerializer(t *testing.T) {
+	args := []interface{}{int64(1), 2.5, "a", []interface{}{true, nil}}
+	kwargs := map[string]interface{}{"b": map[string]interface{}{"c": int64(3)}}
+
+	x, err := NewTaskArgs("task name", args, kwargs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &recordingBroker{}
+	p := NewPublisher(b)
+	p.Serializer = "msgpack"
+	p.Compression = "zlib"
+
+	if err := p.Publish(x, "", "celery"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := b.messages[0]
+	if msg.ContentType != ContentTypeMsgpack || msg.ContentEncoding != "binary" {
+		t.Errorf("content type %q, encoding %q", msg.ContentType, msg.ContentEncoding)
+	}
+
+	raw, err := decompress(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []interface{}{}
+	if err := msgpack.Unmarshal(raw, &body); err != nil || len(body) != 3 {
+		t.Fatal(body, err)
+	}
+
+	task, err := DecodeTask(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Task != "task name" || task.Id != x.Id {
+		t.Fail()
+	}
+
+	expected := []interface{}{json.Number("1"), json.Number("2.5"), "a", []interface{}{true, nil}}
+	if !reflect.DeepEqual(task.Args, expected) {
+		t.Errorf("decoded args %v", task.Args)
+	}
+
+	if !reflect.DeepEqual(task.KWArgs, map[string]interface{}{"b": map[string]interface{}{"c": json.Number("3")}}) {
+		t.Errorf("decoded kwargs %v", task.KWArgs)
+	}
+
+	msg.ContentType = "application/unknown"
+
+	if _, err := DecodeTask(msg); err == nil {
+		t.Error("decoded an unknown content type")
+	}
+}
+
+func TestYAMLSerializer(t *testing.T) {
+	msg := &Message{
+		ContentType: ContentTypeYAML,
+		Headers:     map[string]interface{}{"task": "tasks.add", "id": "1234"},
+		Body: []byte(`- [1, 2.5, two]
+- {a: {b: [c]}}
+- {callbacks: null, errbacks: null, chain: null, chord: null}
+`),
+	}
+
+	task, err := DecodeTask(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Task != "tasks.add" || task.Id != "1234" {
+		t.Fail()
+	}
+
+	if !reflect.DeepEqual(task.Args, []interface{}{json.Number("1"), json.Number("2.5"), "two"}) {
+		t.Errorf("decoded args %v", task.Args)
+	}
+
+	if !reflect.DeepEqual(task.KWArgs, map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{"c"}}}) {
+		t.Errorf("decoded kwargs %v", task.KWArgs)
+	}
+
+	b := &recordingBroker{}
+	p := NewPublisher(b)
+	p.Serializer = "yaml"
+
+	if err := p.Publish(task, "", "celery"); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.messages[0].ContentType != ContentTypeYAML {
+		t.Fail()
+	}
+
+	published, err := DecodeTask(b.messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(published.Args, task.Args) || !reflect.DeepEqual(published.KWArgs, task.KWArgs) {
+		t.Errorf("round trip %v %v", published.Args, published.KWArgs)
+	}
+}
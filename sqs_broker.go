@@ -0,0 +1,360 @@
+package celery
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSQSWaitTime          = 20 * time.Second
+	defaultSQSVisibilityTimeout = 30 * time.Minute
+	defaultSQSRetryDelay        = time.Second
+	defaultSQSMaxRetryDelay     = time.Minute
+	sqsMaxMessages              = 10
+)
+
+// Message group of the messages sent to FIFO queues, the one Kombu uses
+const sqsMessageGroup = "default"
+
+// Amazon SQS broker compatible with Kombu's SQS transport,
+// routing keys name the queues messages are sent to,
+// messages are base64 encoded Kombu envelopes, messages sent to FIFO
+// queues share one message group and get a random deduplication id,
+// QueuePrefix - optional prefix of every queue name,
+// WaitTime - long polling duration of a receive call,
+// VisibilityTimeout - time a received message stays hidden
+// from other consumers before being redelivered unless acked,
+// Logger - optional logger, the package one by default
+type SQSBroker struct {
+	QueuePrefix       string
+	WaitTime          time.Duration
+	VisibilityTimeout time.Duration
+	Logger            Logger
+
+	client sqsiface.SQSAPI
+
+	mu          sync.Mutex
+	urls        map[string]string
+	maxMessages int64
+
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	once sync.Once
+	done chan struct{}
+}
+
+// Settles a message received from an SQS queue,
+// acked messages are deleted and requeued messages become
+// visible again right away
+type sqsAcknowledger struct {
+	client  sqsiface.SQSAPI
+	url     string
+	receipt *string
+}
+
+// Returns a pointer to a new SQS broker using client
+func NewSQSBroker(client sqsiface.SQSAPI) *SQSBroker {
+	return &SQSBroker{
+		WaitTime:          defaultSQSWaitTime,
+		VisibilityTimeout: defaultSQSVisibilityTimeout,
+		client:            client,
+		urls:              make(map[string]string),
+		maxMessages:       sqsMaxMessages,
+		retryDelay:        defaultSQSRetryDelay,
+		maxRetryDelay:     defaultSQSMaxRetryDelay,
+		done:              make(chan struct{}),
+	}
+}
+
+// Returns the SQS name of a queue, the same way Kombu translates it,
+// dots become dashes except for the .fifo suffix and other
+// punctuation becomes underscores
+func (b *SQSBroker) queueName(name string) string {
+	fifo := strings.HasSuffix(name, ".fifo")
+	if fifo {
+		name = strings.TrimSuffix(name, ".fifo")
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '.':
+			return '-'
+		case r == '-' || r == '_':
+			return r
+		case strings.ContainsRune("!\"#$%&'()*+,/:;<=>?@[\\]^`{|}~", r):
+			return '_'
+		}
+
+		return r
+	}, b.QueuePrefix+name)
+
+	if fifo {
+		name += ".fifo"
+	}
+
+	return name
+}
+
+// Returns the URL of a queue, URLs are cached once resolved
+func (b *SQSBroker) queueURL(queue string) (string, error) {
+	name := b.queueName(queue)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if url, ok := b.urls[name]; ok {
+		return url, nil
+	}
+
+	out, err := b.client.GetQueueUrl(&sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+
+	b.urls[name] = aws.StringValue(out.QueueUrl)
+
+	return b.urls[name], nil
+}
+
+// Publish a message to the queue named by the routing key
+func (b *SQSBroker) Publish(exchange, key string, msg *Message) error {
+	return b.PublishContext(context.Background(), exchange, key, msg)
+}
+
+// Same as Publish, the SQS request is cancelled when ctx is done
+func (b *SQSBroker) PublishContext(ctx context.Context, exchange, key string, msg *Message) error {
+	url, err := b.queueURL(key)
+	if err != nil {
+		return err
+	}
+
+	payload, err := encodeEnvelope(exchange, key, msg)
+	if err != nil {
+		return err
+	}
+
+	in := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(url),
+		MessageBody: aws.String(base64.StdEncoding.EncodeToString(payload)),
+	}
+
+	if strings.HasSuffix(b.queueName(key), ".fifo") {
+		dedup, err := UUID4.NewID()
+		if err != nil {
+			return err
+		}
+
+		in.MessageGroupId = aws.String(sqsMessageGroup)
+		in.MessageDeduplicationId = aws.String(dedup)
+	}
+
+	_, err = b.client.SendMessageWithContext(ctx, in)
+
+	return err
+}
+
+// Starts long polling queue, SQS has no exchange bindings
+// so exchange and key are ignored
+func (b *SQSBroker) Consume(queue, exchange, key string) (<-chan *Message, error) {
+	return b.ConsumeContext(context.Background(), queue, exchange, key)
+}
+
+// Same as Consume, the pending receive call is cancelled when ctx is done
+func (b *SQSBroker) ConsumeContext(ctx context.Context, queue, exchange, key string) (<-chan *Message, error) {
+	url, err := b.queueURL(queue)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make(chan *Message)
+
+	go b.receive(ctx, url, messages)
+
+	return messages, nil
+}
+
+// Receives messages from a queue URL until ctx is done or
+// the broker is closed, failed receive calls are retried with
+// exponential backoff
+func (b *SQSBroker) receive(ctx context.Context, url string, messages chan<- *Message) {
+	defer close(messages)
+
+	delay := b.retryDelay
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.done:
+			return
+		default:
+		}
+
+		b.mu.Lock()
+		max := b.maxMessages
+		b.mu.Unlock()
+
+		out, err := b.client.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(url),
+			MaxNumberOfMessages: aws.Int64(max),
+			WaitTimeSeconds:     aws.Int64(int64(b.WaitTime / time.Second)),
+			VisibilityTimeout:   aws.Int64(int64(b.VisibilityTimeout / time.Second)),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			loggerOr(b.Logger).Error("Failed to receive messages", "queue", url, "error", err, "retry", delay)
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			}
+
+			if delay *= 2; delay > b.maxRetryDelay {
+				delay = b.maxRetryDelay
+			}
+
+			continue
+		}
+
+		delay = b.retryDelay
+
+		for _, m := range out.Messages {
+			msg, err := b.delivered(url, m)
+			if err != nil {
+				loggerOr(b.Logger).Warn("Failed to decode message", "queue", url, "error", err)
+				continue
+			}
+
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				msg.Nack(true)
+				return
+			case <-b.done:
+				msg.Nack(true)
+				return
+			}
+		}
+	}
+}
+
+// Returns the message for a received SQS message
+func (b *SQSBroker) delivered(url string, m *sqs.Message) (*Message, error) {
+	raw, err := base64.StdEncoding.DecodeString(aws.StringValue(m.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	env, body, err := decodeEnvelope(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := env.message(body)
+	msg.Acknowledger = &sqsAcknowledger{
+		client:  b.client,
+		url:     url,
+		receipt: m.ReceiptHandle,
+	}
+
+	return msg, nil
+}
+
+// Creates a queue, args are set as SQS queue attributes
+func (b *SQSBroker) DeclareQueue(name string, args map[string]interface{}) error {
+	attributes := map[string]*string{
+		sqs.QueueAttributeNameVisibilityTimeout: aws.String(strconv.Itoa(int(b.VisibilityTimeout / time.Second))),
+	}
+
+	for k, v := range args {
+		switch value := v.(type) {
+		case string:
+			attributes[k] = aws.String(value)
+		case int:
+			attributes[k] = aws.String(strconv.Itoa(value))
+		}
+	}
+
+	if strings.HasSuffix(name, ".fifo") {
+		attributes[sqs.QueueAttributeNameFifoQueue] = aws.String("true")
+	}
+
+	out, err := b.client.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String(b.queueName(name)),
+		Attributes: attributes,
+	})
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.urls[b.queueName(name)] = aws.StringValue(out.QueueUrl)
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Limits the messages fetched by each receive call to prefetch,
+// SQS fetches at most 10 messages per call, global is ignored
+func (b *SQSBroker) Qos(prefetch int, global bool) error {
+	max := int64(prefetch)
+	if max <= 0 || max > sqsMaxMessages {
+		max = sqsMaxMessages
+	}
+
+	b.mu.Lock()
+	b.maxMessages = max
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Stops the consumers after their current receive call
+func (b *SQSBroker) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return nil
+}
+
+// Deletes the message from the queue
+func (a *sqsAcknowledger) Ack() error {
+	_, err := a.client.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(a.url),
+		ReceiptHandle: a.receipt,
+	})
+
+	return err
+}
+
+// Makes the message visible again when requeued, otherwise deletes it
+func (a *sqsAcknowledger) Nack(requeue bool) error {
+	if !requeue {
+		return a.Ack()
+	}
+
+	_, err := a.client.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(a.url),
+		ReceiptHandle:     a.receipt,
+		VisibilityTimeout: aws.Int64(0),
+	})
+
+	return err
+}
+
+// Same as Nack, SQS does not distinguish rejections
+func (a *sqsAcknowledger) Reject(requeue bool) error {
+	return a.Nack(requeue)
+}
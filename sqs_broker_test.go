@@ -0,0 +1,185 @@
+package celery
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSQS struct {
+	sqsiface.SQSAPI
+
+	mu       sync.Mutex
+	sent     []*sqs.SendMessageInput
+	queued   []*sqs.Message
+	deleted  []string
+	restored []string
+	failures int
+}
+
+func (f *fakeSQS) GetQueueUrl(in *sqs.GetQueueUrlInput) (*sqs.GetQueueUrlOutput, error) {
+	return &sqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs/" + *in.QueueName)}, nil
+}
+
+func (f *fakeSQS) SendMessageWithContext(ctx aws.Context, in *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, in)
+	f.queued = append(f.queued, &sqs.Message{
+		Body:          in.MessageBody,
+		ReceiptHandle: aws.String(strconv.Itoa(len(f.queued))),
+	})
+
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("service unavailable")
+	}
+
+	out := &sqs.ReceiveMessageOutput{Messages: f.queued}
+	f.queued = nil
+
+	return out, nil
+}
+
+func (f *fakeSQS) DeleteMessage(in *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deleted = append(f.deleted, *in.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(in *sqs.ChangeMessageVisibilityInput) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.restored = append(f.restored, *in.ReceiptHandle)
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func TestSQSQueueName(t *testing.T) {
+	b := NewSQSBroker(nil)
+	b.QueuePrefix = "prod-"
+
+	for name, expected := range map[string]string{
+		"celery":           "prod-celery",
+		"email.high":       "prod-email-high",
+		"reports:daily":    "prod-reports_daily",
+		"tasks.queue.fifo": "prod-tasks-queue.fifo",
+	} {
+		if b.queueName(name) != expected {
+			t.Errorf("%s translated to %s", name, b.queueName(name))
+		}
+	}
+}
+
+func TestSQSBroker(t *testing.T) {
+	client := &fakeSQS{}
+	b := NewSQSBroker(client)
+	defer b.Close()
+
+	x, _ := NewTask("tasks.add", []string{"1"}, nil)
+	msg, _ := x.message(ProtocolV2)
+
+	if err := b.Publish("", "celery", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Publish("", "celery", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := b.Consume("celery", "", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := receive(t, messages)
+	task, err := DecodeTask(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Id != x.Id || received.RoutingKey != "celery" {
+		t.Fail()
+	}
+
+	received.Ack()
+	receive(t, messages).Nack(true)
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if len(client.deleted) != 1 || client.deleted[0] != "0" {
+		t.Fail()
+	}
+
+	if len(client.restored) != 1 || client.restored[0] != "1" {
+		t.Fail()
+	}
+}
+
+func TestSQSFIFOQueue(t *testing.T) {
+	client := &fakeSQS{}
+	b := NewSQSBroker(client)
+	defer b.Close()
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	msg, _ := x.message(ProtocolV2)
+
+	for _, key := range []string{"celery", "tasks.fifo", "tasks.fifo"} {
+		if err := b.Publish("", key, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if in := client.sent[0]; in.MessageGroupId != nil || in.MessageDeduplicationId != nil {
+		t.Errorf("standard queue message %v", in)
+	}
+
+	first, second := client.sent[1], client.sent[2]
+	if aws.StringValue(first.MessageGroupId) != "default" || first.MessageDeduplicationId == nil {
+		t.Fatalf("fifo queue message %v", first)
+	}
+
+	if *first.MessageDeduplicationId == *second.MessageDeduplicationId {
+		t.Error("messages deduplicated")
+	}
+}
+
+func TestSQSReceiveRetries(t *testing.T) {
+	client := &fakeSQS{failures: 2}
+	b := NewSQSBroker(client)
+	b.retryDelay = time.Millisecond
+	defer b.Close()
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	msg, _ := x.message(ProtocolV2)
+
+	if err := b.Publish("", "celery", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := b.Consume("celery", "", "celery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if task, err := DecodeTask(receive(t, messages)); err != nil || task.Id != x.Id {
+		t.Errorf("received %+v, %v", task, err)
+	}
+}
@@ -0,0 +1,135 @@
+package celery
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Error of the tasks retried more than the MaxRetries of their Retry
+var ErrMaxRetriesExceeded = errors.New("max retries exceeded")
+
+// Error returned by a handler to retry its task, the same as Celery's
+// self.retry(), the task is published again with its id and its
+// retries incremented,
+// Err - optional error the task is retried for, stored as the
+// exception of the RETRY state,
+// Countdown - optional delay of the retry from now,
+// ETA - optional time of the retry, used when Countdown is unset,
+// the task is retried after the RetryBackoff of the worker when
+// neither is set, right away without one,
+// MaxRetries - optional number of retries after which the task fails
+// with Err, or ErrMaxRetriesExceeded without one, unlimited when 0,
+// Options - optional options the task is published again with,
+// such as WithQueue
+type Retry struct {
+	Err        error
+	Countdown  time.Duration
+	ETA        time.Time
+	MaxRetries int
+	Options    []PublishOption
+}
+
+func (r Retry) Error() string {
+	when := "now"
+
+	switch {
+	case r.Countdown > 0:
+		when = "in " + r.Countdown.String()
+	case !r.ETA.IsZero():
+		when = "at " + r.ETA.UTC().Format(timeFormat)
+	}
+
+	if r.Err == nil {
+		return "retry " + when
+	}
+
+	return fmt.Sprintf("retry %s: %v", when, r.Err)
+}
+
+func (r Retry) Unwrap() error {
+	return r.Err
+}
+
+// Returns the error a handler returns to retry its task,
+// see Retry
+func (t *Task) Retry(err error, opts ...PublishOption) error {
+	return Retry{Err: err, Options: opts}
+}
+
+// Returns whether a task may be retried once more
+func (r Retry) allowed(task *Task) bool {
+	return r.MaxRetries <= 0 || task.Retries < r.MaxRetries
+}
+
+// Returns the error a task fails with once out of retries
+func (r Retry) exceeded() error {
+	if r.Err != nil {
+		return r.Err
+	}
+
+	return ErrMaxRetriesExceeded
+}
+
+// Returns the exception info stored with the RETRY state
+func (r Retry) excInfo() map[string]interface{} {
+	if r.Err != nil {
+		return errorInfo(r.Err)
+	}
+
+	return excInfo("Retry", "celery.exceptions", r.Error())
+}
+
+// Returns the options the task is published again with,
+// the previous ETA of the task is replaced
+func (r Retry) options() []PublishOption {
+	eta := r.ETA
+	if r.Countdown > 0 {
+		eta = time.Time{}
+	}
+
+	opts := []PublishOption{WithETA(eta), WithCountdown(r.Countdown)}
+
+	return append(opts, r.Options...)
+}
+
+// Delay of a task retry by the number of retries already done,
+// counted from 0
+type Backoff func(retries int) time.Duration
+
+// Returns a backoff retrying after the same delay every time
+func FixedBackoff(delay time.Duration) Backoff {
+	return func(int) time.Duration { return delay }
+}
+
+// Returns a backoff doubling the delay from base after every retry,
+// with jitter the delay is picked at random between 0 and the doubled
+// one as Celery's retry_jitter
+func ExponentialBackoff(base time.Duration, jitter bool) Backoff {
+	return CappedExponentialBackoff(base, 0, jitter)
+}
+
+// Same as ExponentialBackoff with the doubled delay capped at max
+// before the jitter, as Celery's retry_backoff_max, uncapped when 0
+func CappedExponentialBackoff(base, max time.Duration, jitter bool) Backoff {
+	return func(retries int) time.Duration {
+		d := base
+
+		// uncapped delays stop doubling before overflowing
+		for i := 0; i < retries && (max <= 0 || d < max) && d <= math.MaxInt64/2; i++ {
+			d *= 2
+		}
+
+		if max > 0 && d > max {
+			d = max
+		}
+
+		if jitter && d > 0 {
+			d = time.Duration(rand.Int63n(int64(d) + 1))
+		}
+
+		return d
+	}
+}
@@ -0,0 +1,77 @@
+package celery
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	if d := FixedBackoff(time.Second)(5); d != time.Second {
+		t.Errorf("fixed delay %v", d)
+	}
+
+	exp := ExponentialBackoff(time.Second, false)
+	if exp(0) != time.Second || exp(3) != 8*time.Second {
+		t.Errorf("exponential delays %v %v", exp(0), exp(3))
+	}
+
+	capped := CappedExponentialBackoff(time.Second, 10*time.Second, false)
+	if capped(3) != 8*time.Second || capped(4) != 10*time.Second || capped(1000) != 10*time.Second {
+		t.Errorf("capped delays %v %v", capped(3), capped(4))
+	}
+
+	jittered := CappedExponentialBackoff(time.Second, 10*time.Second, true)
+	for i := 0; i < 100; i++ {
+		if d := jittered(i); d < 0 || d > 10*time.Second {
+			t.Fatalf("jittered delay %v", d)
+		}
+	}
+
+	if d := exp(1000); d < exp(30) {
+		t.Errorf("uncapped delay overflowed to %v", d)
+	}
+
+	uncapped := ExponentialBackoff(time.Second, true)
+	for i := 0; i < 100; i++ {
+		if d := uncapped(1000); d < 0 {
+			t.Fatalf("jittered uncapped delay %v", d)
+		}
+	}
+}
+
+func TestWorkerRetryBackoff(t *testing.T) {
+	b := &routedBroker{}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.MaxRetries = 3
+	w.RetryBackoff = FixedBackoff(time.Hour)
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	w.Register("tasks.retry", func(task *Task) (interface{}, error) {
+		return nil, Retry{MaxRetries: 1}
+	})
+
+	task, _ := NewTask("tasks.fail", nil, nil)
+	msg, _ := delivery(t, task)
+	w.dispatch(msg)
+
+	if retried, _ := DecodeTask(b.messages[0]); retried.Retries != 1 || time.Until(retried.ETA) < 59*time.Minute {
+		t.Fatalf("retried %+v", retried)
+	}
+
+	task, _ = NewTask("tasks.retry", nil, nil)
+	task.Retries = 1
+	task.Errbacks = []*Signature{{Task: "tasks.errback"}}
+	msg, ack := delivery(t, task)
+	w.dispatch(msg)
+
+	if len(b.messages) != 2 || !ack.nacked || ack.requeued {
+		t.Fatalf("exhausted task settled %+v", ack)
+	}
+
+	if errback, _ := DecodeTask(b.messages[1]); errback.Task != "tasks.errback" {
+		t.Errorf("published %+v", errback)
+	}
+}
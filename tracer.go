@@ -0,0 +1,15 @@
+package celery
+
+import "context"
+
+// Tracer of the published and executed tasks, the tracing package
+// implements it with OpenTelemetry,
+// StartPublish - starts the span of a publish and injects its context
+// into the message headers, the returned func ends it with the publish error,
+// StartExecute - starts the span of an execution continuing the context
+// extracted from the message headers, the returned func ends it with
+// the handler error
+type Tracer interface {
+	StartPublish(ctx context.Context, task *Task, headers map[string]interface{}) (context.Context, func(error))
+	StartExecute(ctx context.Context, task *Task, headers map[string]interface{}) (context.Context, func(error))
+}
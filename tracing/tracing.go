@@ -0,0 +1,116 @@
+// Package tracing provides OpenTelemetry tracing of the
+// github.com/bsphere/celery tasks, the W3C trace context is
+// propagated in the task message headers the same way
+// opentelemetry-instrumentation-celery does
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/bsphere/celery"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/bsphere/celery/tracing"
+
+// OpenTelemetry tracer of the celery tasks,
+// set it as the Tracer of publishers and workers
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+var _ celery.Tracer = (*Tracer)(nil)
+
+// Returns a pointer to a new tracer creating spans with tp and
+// propagating their context with p, the global tracer provider
+// and the W3C trace context by default
+func New(tp trace.TracerProvider, p propagation.TextMapPropagator) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	if p == nil {
+		p = propagation.TraceContext{}
+	}
+
+	return &Tracer{tracer: tp.Tracer(instrumentationName), propagator: p}
+}
+
+// Starts an apply_async producer span and injects it into headers
+func (t *Tracer) StartPublish(ctx context.Context, task *celery.Task, headers map[string]interface{}) (context.Context, func(error)) {
+	ctx, span := t.tracer.Start(ctx, "apply_async/"+task.Task,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attributes(task, "apply_async")...),
+	)
+
+	t.propagator.Inject(ctx, carrier(headers))
+
+	return ctx, end(span)
+}
+
+// Starts a run consumer span continuing the context of headers
+func (t *Tracer) StartExecute(ctx context.Context, task *celery.Task, headers map[string]interface{}) (context.Context, func(error)) {
+	ctx = t.propagator.Extract(ctx, carrier(headers))
+
+	ctx, span := t.tracer.Start(ctx, "run/"+task.Task,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attributes(task, "run")...),
+	)
+
+	return ctx, end(span)
+}
+
+// Returns the span attributes of a task
+func attributes(task *celery.Task, action string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("celery.action", action),
+		attribute.String("celery.task_name", task.Task),
+		attribute.String("messaging.message.id", task.Id),
+	}
+}
+
+// Returns the func ending span with an error status on failures
+func end(span trace.Span) func(error) {
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+	}
+}
+
+// Text map carrier of the message headers
+type carrier map[string]interface{}
+
+func (c carrier) Get(key string) string {
+	switch v := c[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (c carrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c carrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+	"github.com/bsphere/celery"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tracer := New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)), nil)
+
+	b := celery.NewMemoryBroker()
+
+	p := celery.NewPublisher(b)
+	p.Tracer = tracer
+
+	task, _ := celery.NewTask("tasks.add", nil, nil)
+	if err := p.Publish(task, "", "celery"); err != nil {
+		t.Fatal(err)
+	}
+
+	if queued := b.Messages("celery"); len(queued) != 1 {
+		t.Fatalf("%d messages queued", len(queued))
+	} else if _, ok := queued[0].Headers["traceparent"].(string); !ok {
+		t.Fatalf("headers %v", queued[0].Headers)
+	}
+
+	var handled trace.SpanContext
+
+	w := celery.NewWorker(b, "celery", "", "celery")
+	w.Tracer = tracer
+	w.RegisterContext("tasks.add", func(ctx context.Context, task *celery.Task) (interface{}, error) {
+		handled = trace.SpanContextFromContext(ctx)
+		return nil, nil
+	})
+
+	done := make(chan error)
+	go func() { done <- w.Run() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(spans.Ended()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w.Stop(context.Background())
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 || ended[0].Name() != "apply_async/tasks.add" || ended[1].Name() != "run/tasks.add" {
+		t.Fatalf("spans %v", ended)
+	}
+
+	if ended[1].Parent().SpanID() != ended[0].SpanContext().SpanID() {
+		t.Error("run span not a child of the apply_async span")
+	}
+
+	if handled.TraceID() != ended[0].SpanContext().TraceID() {
+		t.Error("handler context not traced")
+	}
+}
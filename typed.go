@@ -0,0 +1,146 @@
+package celery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// Typed definition of a task,
+// Name - task name,
+// Publisher - publisher of the tasks applied with Delay,
+// Backend - optional backend of the task results,
+// the args are sent as the task kwargs when they encode to
+// a JSON object, or as its single positional arg otherwise
+type TaskDef[A, R any] struct {
+	Name      string
+	Publisher *Publisher
+	Backend   ResultBackend
+}
+
+// Pending result of a task published through a TaskDef
+type TypedResult[R any] struct {
+	*AsyncResult
+}
+
+var (
+	errNoPublisher = errors.New("task definition without a publisher")
+	errNoBackend   = errors.New("task definition without a result backend")
+)
+
+// Returns a pointer to a new definition of task name
+func Define[A, R any](name string) *TaskDef[A, R] {
+	return &TaskDef[A, R]{Name: name}
+}
+
+// Returns the task applying the definition to args
+func (d *TaskDef[A, R]) Task(args A) (*Task, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var kwargs map[string]interface{}
+	if err := unmarshalNumbers(data, &kwargs); err == nil && kwargs != nil {
+		return NewTaskArgs(d.Name, nil, kwargs)
+	}
+
+	var arg interface{}
+	if err := unmarshalNumbers(data, &arg); err != nil {
+		return nil, err
+	}
+
+	return NewTaskArgs(d.Name, []interface{}{arg}, nil)
+}
+
+// Publish the task with args and return its pending result
+func (d *TaskDef[A, R]) Delay(args A) (*TypedResult[R], error) {
+	return d.ApplyAsyncContext(context.Background(), args)
+}
+
+// Publish the task with args and options, see Publisher.ApplyAsync
+func (d *TaskDef[A, R]) ApplyAsync(args A, opts ...PublishOption) (*TypedResult[R], error) {
+	return d.ApplyAsyncContext(context.Background(), args, opts...)
+}
+
+// Same as ApplyAsync, gives up when ctx is done
+func (d *TaskDef[A, R]) ApplyAsyncContext(ctx context.Context, args A, opts ...PublishOption) (*TypedResult[R], error) {
+	if d.Publisher == nil {
+		return nil, errNoPublisher
+	}
+
+	t, err := d.Task(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if rpc, ok := d.Backend.(*RPCBackend); ok {
+		t.ReplyTo = rpc.ReplyTo()
+	}
+
+	if err := d.Publisher.ApplyAsyncContext(ctx, t, opts...); err != nil {
+		return nil, err
+	}
+
+	return &TypedResult[R]{NewAsyncResult(t.Id, d.Backend)}, nil
+}
+
+// Registers a typed handler of the definition with w, the task
+// args are decoded into A and the returned R is the task result
+func (d *TaskDef[A, R]) Register(w *Worker, handler func(context.Context, A) (R, error)) {
+	w.RegisterContext(d.Name, func(ctx context.Context, task *Task) (interface{}, error) {
+		args, err := typedArgs[A](task)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, args)
+	})
+}
+
+// Waits for the task to finish and returns its result decoded into R,
+// a failed or revoked task returns a *TaskError
+func (r *TypedResult[R]) Get(ctx context.Context) (R, error) {
+	var result R
+
+	if r.backend == nil {
+		return result, errNoBackend
+	}
+
+	value, err := r.AsyncResult.Get(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	err = convert(value, &result)
+
+	return result, err
+}
+
+// Decodes the args of task into A, from its kwargs when given,
+// its single positional arg, or the list of its args
+func typedArgs[A any](task *Task) (A, error) {
+	var args A
+	var err error
+
+	switch {
+	case len(task.KWArgs) > 0:
+		err = convert(task.KWArgs, &args)
+	case len(task.Args) == 1:
+		err = convert(task.Args[0], &args)
+	case len(task.Args) > 1:
+		err = convert(task.Args, &args)
+	}
+
+	return args, err
+}
+
+// Converts a decoded JSON value into v through JSON
+func convert(value interface{}, v interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,81 @@
+package celery
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type emailArgs struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+type emailResult struct {
+	Sent int `json:"sent"`
+}
+
+func TestTaskDef(t *testing.T) {
+	b := &recordingBroker{}
+	backend := &memoryResults{results: make(map[string]*ResultMeta)}
+
+	sendEmail := Define[emailArgs, emailResult]("app.send_email")
+	sendEmail.Publisher = NewPublisher(b)
+	sendEmail.Backend = backend
+
+	w := NewWorker(b, "celery", "", "celery")
+	called := false
+
+	sendEmail.Register(w, func(ctx context.Context, args emailArgs) (emailResult, error) {
+		if args.To != "bob@example.com" || args.Subject != "hi" {
+			t.Errorf("received %+v", args)
+		}
+
+		called = true
+		return emailResult{Sent: 1}, nil
+	})
+
+	r, err := sendEmail.Delay(emailArgs{To: "bob@example.com", Subject: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := b.messages[0]
+	msg.Acknowledger = &ackRecorder{}
+
+	if err := w.dispatch(msg); err != nil || !called {
+		t.Fatal(err)
+	}
+
+	backend.Store(&ResultMeta{TaskId: r.Id, Status: StateSuccess, Result: map[string]interface{}{"sent": 1}})
+
+	r.Interval = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	result, err := r.Get(ctx)
+	if err != nil || result.Sent != 1 {
+		t.Errorf("got %+v: %v", result, err)
+	}
+}
+
+func TestTypedArgs(t *testing.T) {
+	task, _ := NewTaskArgs("tasks.add", []interface{}{1, 2}, nil)
+
+	args, err := typedArgs[[]int](task)
+	if err != nil || len(args) != 2 || args[1] != 2 {
+		t.Errorf("decoded %v: %v", args, err)
+	}
+
+	d := Define[int, int]("tasks.double")
+
+	task, err = d.Task(21)
+	if err != nil || len(task.Args) != 1 || task.KWArgs != nil {
+		t.Fatalf("task %+v: %v", task, err)
+	}
+
+	if n, err := typedArgs[int](task); err != nil || n != 21 {
+		t.Errorf("decoded %d: %v", n, err)
+	}
+}
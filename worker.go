@@ -0,0 +1,822 @@
+package celery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultPrefetchMultiplier = 4
+
+// Header counting the requeues of a failed message
+const requeuesHeader = "x-retries"
+
+// Header counting the returns of a message to a quorum queue
+const deliveryCountHeader = "x-delivery-count"
+
+// Headers set by the protocol, the publisher and the broker, not carried
+// over to the messages of retried tasks
+var publishedHeaders = map[string]bool{
+	"lang": true, "task": true, "id": true, "root_id": true, "parent_id": true,
+	"group": true, "group_index": true, "shadow": true, "retries": true,
+	"timelimit": true, "eta": true, "expires": true, "ignore_result": true,
+	"origin": true, "argsrepr": true, "kwargsrepr": true, "compression": true,
+	"x-delay": true, "x-death": true, requeuesHeader: true, deliveryCountHeader: true,
+}
+
+// Error of the tasks abandoned for exceeding their hard time limit
+var ErrTimeLimitExceeded = errors.New("time limit exceeded")
+
+// Executes a consumed task,
+// the returned value is the task result
+type TaskHandler func(*Task) (interface{}, error)
+
+// Executes a consumed task with a context carrying its Request,
+// see RequestFromContext, the context deadline is the soft time limit,
+// the hard one without soft limit, or the task expiration, whichever
+// comes first, tasks published with it are children of the task
+type ContextTaskHandler func(context.Context, *Task) (interface{}, error)
+
+// Context key of the request of the task executed by a handler
+type taskKey struct{}
+
+// Celery worker representation,
+// consumes tasks from a broker queue and dispatches them
+// to the handlers registered for their task names,
+// Hostname - worker node name, celery@<host> by default,
+// RemoteControl - consume the worker pidbox queue and execute the
+// remote control commands broadcast by Control clients,
+// Concurrency - number of tasks executed at the same time,
+// the number of CPUs by default,
+// PrefetchMultiplier - number of messages prefetched per concurrent
+// task on brokers with prefetch limits, 4 by default as Celery's
+// worker_prefetch_multiplier, 0 disables the limit,
+// SoftTimeLimit - optional time after which the context of a handler
+// is cancelled, tasks published with a soft time limit use theirs,
+// TimeLimit - optional time after which a handler is abandoned and
+// its task failed with ErrTimeLimitExceeded, tasks published with
+// a time limit use theirs,
+// MaxRetries - number of times a failed task is published again
+// before it is dead lettered,
+// RetryBackoff - optional delay of the retries of the failed tasks
+// and of the Retry errors without a countdown or ETA, such as
+// ExponentialBackoff, tasks are retried right away without one,
+// MaxRequeues - number of times the message of a failed task without
+// retries left is requeued unchanged before it is dead lettered,
+// requeues are counted in its x-retries header so poison messages
+// do not loop forever,
+// DeliveryLimit - x-delivery-limit of the quorum queue consumed, the
+// messages of failed tasks without retries left are returned to the
+// queue with a Nack until the broker counted that many returns in their
+// x-delivery-count header, then dead lettered, MaxRequeues is ignored,
+// Broadcast - optional fanout exchange of broadcast tasks, the worker
+// also consumes an exclusive queue bound to it, so every worker runs
+// each task published to it, such as cache invalidations, see
+// NewBroadcastQueue,
+// DeadLetterExchange, DeadLetterKey - optional destination the messages
+// the worker gives up on are published to, for brokers without
+// dead letter exchanges, when unset such messages are rejected
+// without requeue and dead lettered by queues declared with
+// a dead letter exchange,
+// Events - optional dispatcher of the task and worker events, the same
+// as running a Celery worker with -E,
+// HeartbeatInterval - interval of the worker-heartbeat events,
+// 2 seconds by default,
+// Logger - optional logger, the package one by default,
+// Metrics - optional observer of the executed tasks,
+// Tracer - optional tracer of the executed tasks,
+// Dedupe - optional record of the processed tasks, redelivered
+// tasks it has seen are acknowledged without being executed again,
+// Backend - optional backend the task states and results are stored
+// in with the meta format of Celery, so results can be read by Python,
+// TrackStarted - store the STARTED state of the tasks before executing
+// them, the same as Celery's task_track_started,
+// ETAHold - longest time a task with a future ETA is held unacknowledged
+// until due, tasks due later are requeued once held that long to be
+// held again, 10 minutes by default to stay under the consumer
+// timeout of RabbitMQ,
+// MonitorAddr - optional address the monitoring endpoints of the
+// worker are served on while it runs, see Monitor
+type Worker struct {
+	Hostname           string
+	RemoteControl      bool
+	Concurrency        int
+	PrefetchMultiplier int
+	SoftTimeLimit      time.Duration
+	TimeLimit          time.Duration
+	MaxRetries         int
+	RetryBackoff       Backoff
+	MaxRequeues        int
+	DeliveryLimit      int
+	Broadcast          string
+	DeadLetterExchange string
+	DeadLetterKey      string
+	Events             *EventDispatcher
+	HeartbeatInterval  time.Duration
+	Logger             Logger
+	Metrics            Metrics
+	Tracer             Tracer
+	Dedupe             DedupeStore
+	Backend            ResultBackend
+	TrackStarted       bool
+	ETAHold            time.Duration
+	MonitorAddr        string
+
+	broker   Broker
+	queue    string
+	exchange string
+	key      string
+
+	mu         sync.RWMutex
+	handlers   map[string]ContextTaskHandler
+	middleware []Middleware
+	rateLimits map[string]*tokenBucket
+
+	active int64
+
+	// counters of the monitoring endpoints, consuming is 1 while running
+	succeeded int64
+	failed    int64
+	retried   int64
+	consuming int32
+
+	// stops consuming and cancels the handlers contexts
+	// on shutdown, tasks in progress are tracked for requeues
+	runMu    sync.Mutex
+	stop     context.CancelFunc
+	stopped  chan struct{}
+	tasks    context.Context
+	abort    context.CancelFunc
+	inflight map[*Message]bool
+	running  map[string]*runningTask
+	revoked  map[string]time.Time
+
+	started   time.Time
+	processed map[string]int
+
+	broadcastQueue string
+	broadcastSeen  *MemoryDedupe
+
+	etaMu   sync.Mutex
+	holding int
+}
+
+// Task in progress, cancel cancels its handler context
+type runningTask struct {
+	task    *Task
+	started time.Time
+	cancel  context.CancelFunc
+}
+
+// Settles a message once, later settlements are ignored,
+// tasks requeued on shutdown may still complete afterwards
+type settleOnce struct {
+	mu      sync.Mutex
+	a       Acknowledger
+	metrics Metrics
+	settled bool
+}
+
+// Returns a pointer to a new worker consuming queue,
+// the queue is bound to exchange with key when the worker runs
+func NewWorker(b Broker, queue, exchange, key string) *Worker {
+	tasks, abort := context.WithCancel(context.Background())
+
+	return &Worker{
+		Hostname:           NodeName("celery", ""),
+		Concurrency:        runtime.NumCPU(),
+		PrefetchMultiplier: defaultPrefetchMultiplier,
+		broker:             b,
+		queue:              queue,
+		exchange:           exchange,
+		key:                key,
+		handlers:           make(map[string]ContextTaskHandler),
+		rateLimits:         make(map[string]*tokenBucket),
+		tasks:              tasks,
+		abort:              abort,
+		inflight:           make(map[*Message]bool),
+		running:            make(map[string]*runningTask),
+		revoked:            make(map[string]time.Time),
+		started:            time.Now(),
+		processed:          make(map[string]int),
+	}
+}
+
+// Registers a handler for a task name,
+// registering the same name twice replaces the previous handler
+func (w *Worker) Register(name string, handler func(*Task) (interface{}, error)) {
+	w.RegisterContext(name, func(ctx context.Context, task *Task) (interface{}, error) {
+		return handler(task)
+	})
+}
+
+// Same as Register for a handler taking a context
+func (w *Worker) RegisterContext(name string, handler func(context.Context, *Task) (interface{}, error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.handlers[name] = handler
+}
+
+// Returns the worker logger, the package one by default
+func (w *Worker) logger() Logger {
+	return loggerOr(w.Logger)
+}
+
+// Returns the handler registered for a task name
+func (w *Worker) handler(name string) (ContextTaskHandler, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	h, ok := w.handlers[name]
+	return h, ok
+}
+
+// Consumes the worker queue and dispatches tasks to Concurrency
+// goroutines until the broker is closed or the worker stopped,
+// returns once the tasks in progress are done
+func (w *Worker) Run() error {
+	concurrency := w.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	prefetch := concurrency * w.PrefetchMultiplier
+
+	if qb, ok := w.broker.(QosBroker); ok {
+		if err := qb.Qos(prefetch, false); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	if w.MonitorAddr != "" {
+		shutdown, err := w.serveMonitor(w.MonitorAddr)
+		if err != nil {
+			return err
+		}
+
+		defer shutdown()
+	}
+
+	if w.RemoteControl {
+		if err := w.control(ctx); err != nil {
+			return err
+		}
+	}
+
+	deliveries, err := consumeContext(ctx, w.broker, w.queue, w.exchange, w.key)
+	if err != nil {
+		return err
+	}
+
+	if w.Broadcast != "" {
+		broadcasts, err := w.consumeBroadcast(ctx)
+		if err != nil {
+			return err
+		}
+
+		deliveries = mergeMessages(deliveries, broadcasts)
+	}
+
+	deliveries = w.schedule(ctx, deliveries, prefetch)
+
+	atomic.StoreInt32(&w.consuming, 1)
+	defer atomic.StoreInt32(&w.consuming, 0)
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	w.runMu.Lock()
+	w.stop, w.stopped = stop, stopped
+	w.tasks, w.abort = context.WithCancel(context.Background())
+	w.runMu.Unlock()
+
+	if w.Events != nil {
+		beating, offline := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			w.heartbeat(beating)
+		}()
+
+		defer func() {
+			offline()
+			<-done
+		}()
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for msg := range deliveries {
+				w.dispatch(msg)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// Stops the worker with a warm shutdown, the consumer is cancelled
+// and the tasks in progress are waited for until ctx is done,
+// the tasks still running are then requeued, their handlers
+// contexts cancelled, and ctx.Err() is returned
+func (w *Worker) Stop(ctx context.Context) error {
+	w.runMu.Lock()
+	stop, stopped := w.stop, w.stopped
+	w.runMu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+
+	stop()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+	}
+
+	w.runMu.Lock()
+	defer w.runMu.Unlock()
+
+	w.abort()
+
+	for msg := range w.inflight {
+		msg.Nack(true)
+	}
+
+	return ctx.Err()
+}
+
+// Records a message in progress until done is called,
+// the message is settled only once
+func (w *Worker) track(msg *Message) (done func()) {
+	msg.Acknowledger = &settleOnce{a: msg.Acknowledger, metrics: metricsOr(w.Metrics)}
+
+	w.runMu.Lock()
+	w.inflight[msg] = true
+	w.runMu.Unlock()
+
+	return func() {
+		w.runMu.Lock()
+		delete(w.inflight, msg)
+		w.runMu.Unlock()
+	}
+}
+
+func (s *settleOnce) settle(outcome string, f func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.settled {
+		return nil
+	}
+
+	s.settled = true
+	s.metrics.MessageSettled(outcome)
+
+	return f()
+}
+
+func (s *settleOnce) Ack() error {
+	return s.settle(SettledAck, s.a.Ack)
+}
+
+func (s *settleOnce) Nack(requeue bool) error {
+	return s.settle(SettledNack, func() error { return s.a.Nack(requeue) })
+}
+
+func (s *settleOnce) Reject(requeue bool) error {
+	return s.settle(SettledReject, func() error { return s.a.Reject(requeue) })
+}
+
+// Returns the number of tasks in progress
+func (w *Worker) Active() int {
+	return int(atomic.LoadInt64(&w.active))
+}
+
+// Returns the soft and hard time limits of a task,
+// the ones it was published with or the worker ones
+func (w *Worker) timeLimits(task *Task) (time.Duration, time.Duration) {
+	soft, hard := task.SoftTimeLimit, task.TimeLimit
+
+	if soft <= 0 {
+		soft = w.SoftTimeLimit
+	}
+
+	if hard <= 0 {
+		hard = w.TimeLimit
+	}
+
+	return soft, hard
+}
+
+// Executes a handler within the task time limits, traced from
+// the message headers, a handler exceeding its hard time limit
+// keeps running in the background but its result is discarded
+func (w *Worker) execute(h ContextTaskHandler, task *Task, msg *Message) (result interface{}, err error) {
+	atomic.AddInt64(&w.active, 1)
+	defer atomic.AddInt64(&w.active, -1)
+
+	soft, hard := w.timeLimits(task)
+
+	w.runMu.Lock()
+	tasks := w.tasks
+	w.runMu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.WithValue(tasks, taskKey{}, w.request(task, msg)))
+	defer cancel()
+
+	if w.Tracer != nil {
+		var end func(error)
+		ctx, end = w.Tracer.StartExecute(ctx, task, msg.Headers)
+		defer func() { end(err) }()
+	}
+
+	w.runMu.Lock()
+	w.running[task.Id] = &runningTask{task: task, started: time.Now(), cancel: cancel}
+	w.runMu.Unlock()
+
+	defer func() {
+		w.runMu.Lock()
+		delete(w.running, task.Id)
+		w.processed[task.Task]++
+		w.runMu.Unlock()
+	}()
+
+	if soft > 0 {
+		ctx, cancel = context.WithTimeout(ctx, soft)
+		defer cancel()
+	} else if hard > 0 {
+		ctx, cancel = context.WithTimeout(ctx, hard)
+		defer cancel()
+	}
+
+	if !task.Expires.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, task.Expires)
+		defer cancel()
+	}
+
+	if hard <= 0 {
+		return w.call(ctx, h, task)
+	}
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+
+	done := make(chan outcome, 1)
+
+	go func() {
+		result, err := w.call(ctx, h, task)
+		done <- outcome{result, err}
+	}()
+
+	timer := time.NewTimer(hard)
+	defer timer.Stop()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-timer.C:
+		return nil, ErrTimeLimitExceeded
+	}
+}
+
+// Calls a handler, a panic is recovered and returned as an error
+func (w *Worker) call(ctx context.Context, h ContextTaskHandler, task *Task) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.logger().Error("Task panicked", "task", task.name(), "id", task.Id, "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return h(ctx, task)
+}
+
+// Executes a single delivery,
+// successful tasks are acked, tasks returning a Retry are published
+// again, failed tasks are retried until MaxRetries, requeued until
+// MaxRequeues and then dead lettered with the undecodable or
+// unregistered tasks
+func (w *Worker) dispatch(msg *Message) error {
+	defer w.track(msg)()
+
+	task, err := DecodeTask(msg)
+	if err != nil {
+		w.logger().Error("Failed to decode task", "task", task.Task, "id", task.Id, "error", err)
+		return w.deadLetter(msg, msg.Reject)
+	}
+
+	h, ok := w.handler(task.Task)
+	if !ok {
+		w.logger().Error("Received unregistered task", "task", task.Task, "id", task.Id)
+		return w.deadLetter(msg, msg.Reject)
+	}
+
+	h = w.wrap(h)
+
+	w.event(EventTaskReceived, task.eventFields())
+	metricsOr(w.Metrics).TaskReceived(task.Task)
+
+	if w.isRevoked(task.Id) {
+		return w.discard(msg, task, false)
+	}
+
+	if task.expired(time.Now()) {
+		return w.discard(msg, task, true)
+	}
+
+	dedupe := w.dedupe(msg)
+
+	if w.duplicate(task, dedupe) {
+		w.logger().Info("Discarding processed task", "task", task.name(), "id", task.Id)
+		return msg.Ack()
+	}
+
+	w.throttle(task.Task)
+
+	w.event(EventTaskStarted, map[string]interface{}{"uuid": task.Id, "pid": os.Getpid()})
+
+	if w.TrackStarted {
+		w.store(task, StateStarted, map[string]interface{}{"pid": os.Getpid(), "hostname": w.Hostname})
+	}
+
+	start := time.Now()
+
+	result, err := w.execute(h, task, msg)
+	metricsOr(w.Metrics).TaskExecuted(task.Task, time.Since(start), err)
+
+	// tasks out of the retries of their Retry fail right away
+	exhausted := false
+
+	var retry Retry
+	if errors.As(err, &retry) {
+		if retry.allowed(task) {
+			w.logger().Info("Retrying task", "task", task.name(), "id", task.Id, "reason", err)
+			w.event(EventTaskRetried, map[string]interface{}{"uuid": task.Id, "exception": err.Error(), "traceback": ""})
+			metricsOr(w.Metrics).TaskRetried(task.Task)
+			atomic.AddInt64(&w.retried, 1)
+			w.store(task, StateRetry, retry.excInfo())
+			return w.retry(msg, task, w.delay(task, retry)...)
+		}
+
+		err, exhausted = retry.exceeded(), true
+	}
+
+	if err != nil {
+		w.logger().Warn("Task failed", "task", task.name(), "id", task.Id, "error", err)
+
+		if task.Retries < w.MaxRetries && !exhausted {
+			w.event(EventTaskRetried, map[string]interface{}{"uuid": task.Id, "exception": err.Error(), "traceback": ""})
+			metricsOr(w.Metrics).TaskRetried(task.Task)
+			atomic.AddInt64(&w.retried, 1)
+			w.store(task, StateRetry, errorInfo(err))
+			return w.retry(msg, task, w.delay(task, Retry{})...)
+		}
+
+		if returns := headerInt(msg.Headers[deliveryCountHeader]); returns < w.DeliveryLimit && !exhausted {
+			atomic.AddInt64(&w.retried, 1)
+			w.store(task, StateRetry, errorInfo(err))
+			return msg.Nack(true)
+		}
+
+		if requeues := headerInt(msg.Headers[requeuesHeader]); requeues < w.MaxRequeues && w.DeliveryLimit == 0 && !exhausted {
+			atomic.AddInt64(&w.retried, 1)
+			w.store(task, StateRetry, errorInfo(err))
+			return w.requeue(msg, task, requeues+1)
+		}
+
+		w.event(EventTaskFailed, map[string]interface{}{"uuid": task.Id, "exception": err.Error(), "traceback": ""})
+		atomic.AddInt64(&w.failed, 1)
+		w.store(task, StateFailure, errorInfo(err))
+		w.link(task, task.Errbacks, task.Id)
+		return w.deadLetter(msg, msg.Nack)
+	}
+
+	value, err := encodeResult(result)
+	if err != nil {
+		w.logger().Error("Failed to encode task result", "task", task.name(), "id", task.Id, "error", err)
+		w.event(EventTaskFailed, map[string]interface{}{"uuid": task.Id, "exception": err.Error(), "traceback": ""})
+		atomic.AddInt64(&w.failed, 1)
+		w.store(task, StateFailure, excInfo("EncodeError", "kombu.exceptions", err.Error()))
+		w.link(task, task.Errbacks, task.Id)
+		return msg.Ack()
+	}
+
+	atomic.AddInt64(&w.succeeded, 1)
+
+	// the message is acked either way, tasks whose result is lost are
+	// only run again by a duplicate published separately
+	if err := w.store(task, StateSuccess, value); err == nil && dedupe != nil {
+		if err := dedupe.Done(task.Id); err != nil {
+			w.logger().Error("Failed to record processed task", "task", task.name(), "id", task.Id, "error", err)
+		}
+	}
+
+	w.link(task, task.Callbacks, value)
+
+	w.event(EventTaskSucceeded, map[string]interface{}{
+		"uuid":    task.Id,
+		"result":  eventRepr(result),
+		"runtime": time.Since(start).Seconds(),
+	})
+
+	return msg.Ack()
+}
+
+// Acknowledges a revoked or expired task without executing it,
+// the same as Celery it is reported and stored as revoked
+func (w *Worker) discard(msg *Message, task *Task, expired bool) error {
+	reason := "revoked"
+	if expired {
+		reason = "expired"
+	}
+
+	w.logger().Info("Discarding "+reason+" task", "task", task.name(), "id", task.Id)
+	w.event(EventTaskRevoked, map[string]interface{}{"uuid": task.Id, "terminated": false, "signum": nil, "expired": expired})
+	w.store(task, StateRevoked, excInfo("TaskRevokedError", "celery.exceptions", reason))
+
+	return msg.Ack()
+}
+
+// Returns whether a task was already processed, tasks are executed
+// when the record cannot be read
+func (w *Worker) duplicate(task *Task, dedupe DedupeStore) bool {
+	if dedupe == nil {
+		return false
+	}
+
+	seen, err := dedupe.Seen(task.Id)
+	if err != nil {
+		w.logger().Error("Failed to check processed task", "task", task.name(), "id", task.Id, "error", err)
+	}
+
+	return seen && err == nil
+}
+
+// Sends a task event when the worker has an event dispatcher
+func (w *Worker) event(kind string, fields map[string]interface{}) {
+	if err := w.Events.Send(kind, fields); err != nil {
+		w.logger().Error("Failed to send event", "type", kind, "error", err)
+	}
+}
+
+// Stores a task state in the worker backend, ready states are dated,
+// results of tasks published with a reply queue are sent to it
+// by an rpc backend, nothing is stored for tasks ignoring their result,
+// failures are logged and returned
+func (w *Worker) store(task *Task, state string, result interface{}) error {
+	if w.Backend == nil || task.IgnoreResult {
+		return nil
+	}
+
+	meta := &ResultMeta{TaskId: task.Id, Status: state, Result: result, ParentId: task.ParentID}
+	if meta.Ready() {
+		meta.DateDone = time.Now()
+	}
+
+	var err error
+
+	if rpc, ok := w.Backend.(*RPCBackend); ok && task.ReplyTo != "" {
+		err = rpc.Reply(task.ReplyTo, meta)
+	} else {
+		err = w.Backend.Store(meta)
+	}
+
+	if err != nil {
+		w.logger().Error("Failed to store task state", "task", task.name(), "id", task.Id, "state", state, "error", err)
+	}
+
+	return err
+}
+
+// Publishes the signatures linked to a task with arg prepended to
+// their args, to the route in their options or the worker one,
+// the same as Celery does with link and link_error
+func (w *Worker) link(task *Task, signatures []*Signature, arg interface{}) {
+	for _, s := range signatures {
+		if err := w.applyLinked(task, s, arg); err != nil {
+			w.logger().Error("Failed to apply linked task", "task", task.name(), "id", task.Id, "linked", s.Task, "error", err)
+		}
+	}
+}
+
+// Publishes a linked signature applied to arg as a child of task
+func (w *Worker) applyLinked(task *Task, s *Signature, arg interface{}) error {
+	linked, err := s.apply(arg)
+	if err != nil {
+		return err
+	}
+
+	linked.childOf(task)
+	linked.Origin = w.Hostname
+
+	msg, err := linked.message(ProtocolV2)
+	if err != nil {
+		return err
+	}
+
+	exchange, key := s.route(w.exchange, w.key)
+
+	return w.broker.Publish(exchange, key, msg)
+}
+
+// Publishes a failed task again with its id and its retries
+// incremented, to the worker queue unless opts route it elsewhere,
+// the custom headers of its message, such as trace contexts, are kept
+func (w *Worker) retry(msg *Message, task *Task, opts ...PublishOption) error {
+	retried := *task
+	retried.Retries++
+
+	headers := make(map[string]interface{}, len(msg.Headers))
+	for k, v := range msg.Headers {
+		if !publishedHeaders[k] {
+			headers[k] = v
+		}
+	}
+
+	p := &Publisher{broker: w.broker, Protocol: protocolVersion(msg), Logger: w.Logger, Origin: w.Hostname}
+	exchange, key := w.route(msg)
+	opts = append([]PublishOption{WithExchange(exchange), WithRoutingKey(key), WithHeaders(headers)}, opts...)
+
+	if err := p.publish(context.Background(), p.options(&retried, opts)); err != nil {
+		w.logger().Error("Failed to retry task", "task", task.name(), "id", task.Id, "error", err)
+		return msg.Nack(true)
+	}
+
+	return msg.Ack()
+}
+
+// Returns the options of the next retry of a task, retries without
+// a countdown or ETA are delayed by the worker backoff
+func (w *Worker) delay(task *Task, r Retry) []PublishOption {
+	if r.Countdown <= 0 && r.ETA.IsZero() && w.RetryBackoff != nil {
+		r.Countdown = w.RetryBackoff(task.Retries)
+	}
+
+	return r.options()
+}
+
+// Publishes the message of a failed task again with its requeues
+// counted in its headers, the task itself is left unchanged
+func (w *Worker) requeue(msg *Message, task *Task, requeues int) error {
+	requeued := *msg
+	requeued.Acknowledger = nil
+	requeued.Headers = make(map[string]interface{}, len(msg.Headers)+1)
+
+	for k, v := range msg.Headers {
+		requeued.Headers[k] = v
+	}
+
+	requeued.Headers[requeuesHeader] = int64(requeues)
+
+	exchange, key := w.route(msg)
+
+	if err := w.broker.Publish(exchange, key, &requeued); err != nil {
+		w.logger().Error("Failed to requeue task", "task", task.name(), "id", task.Id, "error", err)
+		return msg.Nack(true)
+	}
+
+	return msg.Ack()
+}
+
+// Gives up on a message, it is published to the worker dead letter
+// exchange if set, otherwise it is settled with settle without requeue
+// for the broker to dead letter
+func (w *Worker) deadLetter(msg *Message, settle func(requeue bool) error) error {
+	if w.DeadLetterExchange == "" && w.DeadLetterKey == "" {
+		return settle(false)
+	}
+
+	dead := *msg
+	dead.Acknowledger = nil
+
+	if err := w.broker.Publish(w.DeadLetterExchange, w.DeadLetterKey, &dead); err != nil {
+		w.logger().Error("Failed to dead letter message", "error", err)
+		return msg.Nack(true)
+	}
+
+	return msg.Ack()
+}
@@ -0,0 +1,116 @@
+package celery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultETAHold = 10 * time.Minute
+
+// Returns the longest time a task with an ETA is held
+func (w *Worker) etaHold() time.Duration {
+	if w.ETAHold <= 0 {
+		return defaultETAHold
+	}
+
+	return w.ETAHold
+}
+
+// Returns the deliveries once due, tasks with a future ETA are held
+// unacknowledged until then and the others are sent right away,
+// held messages are requeued when ctx is done or deliveries closed,
+// the prefetch count is raised by the number of held messages
+// as Celery does
+func (w *Worker) schedule(ctx context.Context, deliveries <-chan *Message, prefetch int) <-chan *Message {
+	ready := make(chan *Message)
+	closed := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	go func() {
+		defer close(ready)
+		defer wg.Wait()
+		defer close(closed)
+
+		for msg := range deliveries {
+			if wait := time.Until(messageETA(msg)); wait > 0 {
+				wg.Add(1)
+
+				go func(msg *Message) {
+					defer wg.Done()
+					w.hold(ctx, closed, msg, wait, ready, prefetch)
+				}(msg)
+
+				continue
+			}
+
+			ready <- msg
+		}
+	}()
+
+	return ready
+}
+
+// Holds a message for wait before sending it to ready, messages due
+// after the worker ETAHold are requeued once held that long
+func (w *Worker) hold(ctx context.Context, closed <-chan struct{}, msg *Message, wait time.Duration, ready chan<- *Message, prefetch int) {
+	w.held(prefetch, 1)
+	defer w.held(prefetch, -1)
+
+	requeue := wait > w.etaHold()
+	if requeue {
+		wait = w.etaHold()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		requeue = true
+	case <-closed:
+		requeue = true
+	}
+
+	if requeue {
+		if err := msg.Nack(true); err != nil {
+			w.logger().Error("Failed to requeue task", "error", err)
+		}
+
+		return
+	}
+
+	ready <- msg
+}
+
+// Counts the held messages and raises the prefetch count of
+// brokers with prefetch limits accordingly
+func (w *Worker) held(prefetch, delta int) {
+	w.etaMu.Lock()
+	defer w.etaMu.Unlock()
+
+	w.holding += delta
+
+	qb, ok := w.broker.(QosBroker)
+	if !ok || prefetch <= 0 {
+		return
+	}
+
+	if err := qb.Qos(prefetch+w.holding, false); err != nil {
+		w.logger().Error("Failed to update prefetch count", "prefetch", prefetch+w.holding, "error", err)
+	}
+}
+
+// Returns the ETA of the task of a message, zero when undecodable
+func messageETA(msg *Message) time.Time {
+	if protocolVersion(msg) == ProtocolV2 {
+		eta, _ := headerTime(msg.Headers["eta"])
+		return eta
+	}
+
+	task, _ := DecodeTask(msg)
+
+	return task.ETA
+}
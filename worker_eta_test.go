@@ -0,0 +1,66 @@
+package celery
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type nackSignal chan bool
+
+func (s nackSignal) Ack() error                { return nil }
+func (s nackSignal) Reject(requeue bool) error { return nil }
+
+func (s nackSignal) Nack(requeue bool) error {
+	s <- requeue
+	return nil
+}
+
+func TestWorkerETA(t *testing.T) {
+	w := NewWorker(nil, "celery", "", "celery")
+	w.ETAHold = 50 * time.Millisecond
+
+	now, _ := NewTask("tasks.add", nil, nil)
+	soon, _ := NewTask("tasks.add", nil, nil)
+	soon.Countdown = 20 * time.Millisecond
+	later, _ := NewTask("tasks.add", nil, nil)
+	later.Countdown = time.Hour
+
+	deliveries := make(chan *Message, 3)
+	nacks := nackSignal(make(chan bool, 3))
+
+	for _, task := range []*Task{now, soon, later} {
+		msg, _ := delivery(t, task)
+		msg.Acknowledger = nacks
+		deliveries <- msg
+	}
+
+	start := time.Now()
+	ready := w.schedule(context.Background(), deliveries, 0)
+
+	for _, task := range []*Task{now, soon} {
+		received, err := DecodeTask(<-ready)
+		if err != nil || received.Id != task.Id {
+			t.Fatalf("received %+v: %v", received, err)
+		}
+	}
+
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Errorf("task due in 20ms received after %v", d)
+	}
+
+	select {
+	case requeue := <-nacks:
+		if !requeue {
+			t.Error("task due in an hour not requeued")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task due in an hour held past ETAHold")
+	}
+
+	close(deliveries)
+
+	if _, ok := <-ready; ok {
+		t.Error("task due in an hour received")
+	}
+}
@@ -0,0 +1,719 @@
+package celery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type ackRecorder struct {
+	acked, nacked, rejected, requeued bool
+}
+
+func (a *ackRecorder) Ack() error {
+	a.acked = true
+	return nil
+}
+
+func (a *ackRecorder) Nack(requeue bool) error {
+	a.nacked = true
+	a.requeued = requeue
+	return nil
+}
+
+func (a *ackRecorder) Reject(requeue bool) error {
+	a.rejected = true
+	a.requeued = requeue
+	return nil
+}
+
+func delivery(t *testing.T, task *Task) (*Message, *ackRecorder) {
+	msg, err := task.message(ProtocolV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ack := &ackRecorder{}
+	msg.Acknowledger = ack
+
+	return msg, ack
+}
+
+func TestWorkerDispatch(t *testing.T) {
+	w := NewWorker(nil, "celery", "", "celery")
+
+	var received *Task
+	w.Register("tasks.add", func(task *Task) (interface{}, error) {
+		received = task
+		return nil, nil
+	})
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+
+	task, err := NewTask("tasks.add", []string{"1", "2"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ack := delivery(t, task)
+	w.dispatch(msg)
+
+	if !ack.acked || ack.nacked || ack.rejected {
+		t.Fail()
+	}
+
+	if received == nil || received.Id != task.Id || len(received.Args) != 2 {
+		t.Fail()
+	}
+
+	task, _ = NewTask("tasks.fail", nil, nil)
+	msg, ack = delivery(t, task)
+	w.dispatch(msg)
+
+	if ack.acked || !ack.nacked || ack.requeued {
+		t.Fail()
+	}
+
+	task, _ = NewTask("tasks.unknown", nil, nil)
+	msg, ack = delivery(t, task)
+	w.dispatch(msg)
+
+	if !ack.rejected || ack.requeued {
+		t.Fail()
+	}
+
+	ack = &ackRecorder{}
+	w.dispatch(&Message{Acknowledger: ack, Body: []byte("not json")})
+
+	if !ack.rejected {
+		t.Fail()
+	}
+}
+
+func TestWorkerDeadLetter(t *testing.T) {
+	b := &routedBroker{}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.MaxRetries = 2
+	w.DeadLetterKey = "celery.dead"
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+
+	task, _ := NewTask("tasks.fail", nil, nil)
+	msg, ack := delivery(t, task)
+
+	for i := 0; i < 3; i++ {
+		w.dispatch(msg)
+
+		if !ack.acked || ack.nacked || ack.rejected {
+			t.Fatalf("attempt %d not acked", i)
+		}
+
+		msg = b.messages[len(b.messages)-1]
+		ack = &ackRecorder{}
+		msg.Acknowledger = ack
+	}
+
+	if len(b.keys) != 3 || b.keys[0] != "celery" || b.keys[1] != "celery" || b.keys[2] != "celery.dead" {
+		t.Fatalf("published with keys %v", b.keys)
+	}
+
+	if dead, _ := DecodeTask(msg); dead.Id != task.Id || dead.Retries != 2 {
+		t.Errorf("dead lettered %+v", dead)
+	}
+
+	w.dispatch(&Message{Acknowledger: ack, Body: []byte("not json")})
+
+	if !ack.acked || b.keys[3] != "celery.dead" || string(b.messages[3].Body) != "not json" {
+		t.Error("undecodable message not dead lettered")
+	}
+
+	// the handler never runs with the args of a corrupt body
+	msg, ack = delivery(t, task)
+	msg.Body = []byte("[1, {}, {}]")
+
+	w.dispatch(msg)
+
+	if !ack.acked || len(b.keys) != 5 || b.keys[4] != "celery.dead" {
+		t.Errorf("corrupt message published with keys %v", b.keys)
+	}
+}
+
+func TestWorkerRequeues(t *testing.T) {
+	b := &routedBroker{}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.MaxRequeues = 2
+	w.DeadLetterKey = "celery.dead"
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+
+	task, _ := NewTask("tasks.fail", nil, nil)
+	msg, ack := delivery(t, task)
+	body := string(msg.Body)
+
+	for i := 0; i < 3; i++ {
+		w.dispatch(msg)
+
+		if !ack.acked {
+			t.Fatalf("attempt %d not acked", i)
+		}
+
+		msg = b.messages[len(b.messages)-1]
+		ack = &ackRecorder{}
+		msg.Acknowledger = ack
+	}
+
+	if len(b.keys) != 3 || b.keys[1] != "celery" || b.keys[2] != "celery.dead" {
+		t.Fatalf("published with keys %v", b.keys)
+	}
+
+	if headerInt(b.messages[0].Headers["x-retries"]) != 1 || headerInt(msg.Headers["x-retries"]) != 2 {
+		t.Errorf("requeued with headers %v", msg.Headers)
+	}
+
+	if dead, _ := DecodeTask(msg); dead.Id != task.Id || dead.Retries != 0 || string(msg.Body) != body {
+		t.Errorf("dead lettered %+v", dead)
+	}
+}
+
+func TestWorkerDeliveryLimit(t *testing.T) {
+	b := &routedBroker{}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.MaxRequeues = 5
+	w.DeliveryLimit = 2
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+
+	task, _ := NewTask("tasks.fail", nil, nil)
+
+	for returns := 0; returns <= 2; returns++ {
+		msg, ack := delivery(t, task)
+		if returns > 0 {
+			msg.Headers["x-delivery-count"] = int64(returns)
+		}
+
+		w.dispatch(msg)
+
+		if returns < 2 && (!ack.nacked || !ack.requeued) {
+			t.Errorf("delivery %d not returned to the queue", returns)
+		}
+
+		if returns == 2 && (!ack.nacked || ack.requeued) {
+			t.Errorf("delivery %d not dead lettered", returns)
+		}
+	}
+
+	if len(b.messages) != 0 {
+		t.Errorf("requeued %d messages", len(b.messages))
+	}
+}
+
+func TestWorkerRetry(t *testing.T) {
+	b := &routedBroker{}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.DeadLetterKey = "celery.dead"
+	w.Register("tasks.retry", func(task *Task) (interface{}, error) {
+		return nil, Retry{Err: errors.New("busy"), Countdown: time.Hour, MaxRetries: 1}
+	})
+	w.Register("tasks.move", func(task *Task) (interface{}, error) {
+		return nil, task.Retry(nil, WithQueue("other"))
+	})
+
+	task, _ := NewTask("tasks.retry", nil, nil)
+	msg, ack := delivery(t, task)
+	msg.Headers["traceparent"] = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	msg.Headers[requeuesHeader] = int64(1)
+
+	w.dispatch(msg)
+
+	if !ack.acked || len(b.keys) != 1 || b.keys[0] != "celery" {
+		t.Fatalf("retried to %v", b.keys)
+	}
+
+	if h := b.messages[0].Headers; h["traceparent"] != msg.Headers["traceparent"] || h[requeuesHeader] != nil {
+		t.Errorf("retried with headers %v", h)
+	}
+
+	retried, _ := DecodeTask(b.messages[0])
+	if retried.Id != task.Id || retried.Retries != 1 || time.Until(retried.ETA) < 59*time.Minute {
+		t.Fatalf("retried %+v", retried)
+	}
+
+	msg, ack = b.messages[0], &ackRecorder{}
+	msg.Acknowledger = ack
+	w.dispatch(msg)
+
+	if !ack.acked || len(b.keys) != 2 || b.keys[1] != "celery.dead" {
+		t.Fatalf("exhausted retries published to %v", b.keys)
+	}
+
+	task, _ = NewTask("tasks.move", nil, nil)
+	msg, _ = delivery(t, task)
+	w.dispatch(msg)
+
+	if len(b.keys) != 3 || b.keys[2] != "other" {
+		t.Fatalf("retried to %v", b.keys)
+	}
+
+	if moved, _ := DecodeTask(b.messages[2]); moved.Id != task.Id || !moved.ETA.IsZero() {
+		t.Errorf("retried %+v", moved)
+	}
+}
+
+func TestWorkerConcurrency(t *testing.T) {
+	b := &chanBroker{messages: make(chan *Message, 8)}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Concurrency = 4
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	release := make(chan struct{})
+
+	w.Register("tasks.wait", func(task *Task) (interface{}, error) {
+		mu.Lock()
+		if running++; running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		return nil, nil
+	})
+	w.Register("tasks.panic", func(task *Task) (interface{}, error) {
+		panic("boom")
+	})
+
+	var acks []*ackRecorder
+
+	for i := 0; i < 8; i++ {
+		task, _ := NewTask("tasks.wait", nil, nil)
+		msg, ack := delivery(t, task)
+		b.messages <- msg
+		acks = append(acks, ack)
+	}
+
+	done := make(chan error)
+	go func() { done <- w.Run() }()
+
+	deadline := time.Now().Add(time.Second)
+	for w.Active() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if n := w.Active(); n != 4 {
+		t.Errorf("%d tasks in progress", n)
+	}
+
+	close(release)
+
+	task, _ := NewTask("tasks.panic", nil, nil)
+	msg, panicked := delivery(t, task)
+	b.messages <- msg
+	close(b.messages)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if peak != 4 {
+		t.Errorf("%d tasks ran at the same time", peak)
+	}
+
+	for i, ack := range acks {
+		if !ack.acked {
+			t.Errorf("task %d not acked", i)
+		}
+	}
+
+	if !panicked.nacked || panicked.requeued {
+		t.Error("panicked task not nacked")
+	}
+}
+
+type qosBroker struct {
+	chanBroker
+	prefetch int
+}
+
+func (b *qosBroker) Qos(prefetch int, global bool) error {
+	b.prefetch = prefetch
+	return nil
+}
+
+func TestWorkerPrefetch(t *testing.T) {
+	b := &qosBroker{chanBroker: chanBroker{messages: make(chan *Message)}}
+	close(b.messages)
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Concurrency = 3
+
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.prefetch != 12 {
+		t.Errorf("prefetch %d", b.prefetch)
+	}
+}
+
+func TestWorkerTimeLimits(t *testing.T) {
+	w := NewWorker(nil, "celery", "", "celery")
+	w.SoftTimeLimit = 10 * time.Millisecond
+
+	var softErr error
+	w.RegisterContext("tasks.soft", func(ctx context.Context, task *Task) (interface{}, error) {
+		<-ctx.Done()
+		softErr = ctx.Err()
+		return nil, softErr
+	})
+
+	release := make(chan struct{})
+	defer close(release)
+
+	w.RegisterContext("tasks.hard", func(ctx context.Context, task *Task) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	task, _ := NewTask("tasks.soft", nil, nil)
+	msg, ack := delivery(t, task)
+	w.dispatch(msg)
+
+	if softErr != context.DeadlineExceeded || !ack.nacked {
+		t.Errorf("soft time limit not enforced, %v", softErr)
+	}
+
+	task, _ = NewTask("tasks.hard", nil, nil)
+	task.TimeLimit = 20 * time.Millisecond
+
+	msg, ack = delivery(t, task)
+	if limits := msg.Headers["timelimit"].([]interface{}); limits[0] != 0.02 || limits[1] != nil {
+		t.Errorf("timelimit header %v", limits)
+	}
+
+	start := time.Now()
+	w.dispatch(msg)
+
+	if d := time.Since(start); d > time.Second || !ack.nacked || ack.requeued {
+		t.Errorf("hard time limit not enforced after %v", d)
+	}
+
+	if w.Active() != 0 {
+		t.Errorf("%d tasks in progress", w.Active())
+	}
+}
+
+func TestWorkerStop(t *testing.T) {
+	b := &chanBroker{messages: make(chan *Message, 2)}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Concurrency = 2
+
+	started := make(chan struct{}, 2)
+	w.Register("tasks.quick", func(task *Task) (interface{}, error) {
+		started <- struct{}{}
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	})
+	w.RegisterContext("tasks.stuck", func(ctx context.Context, task *Task) (interface{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	})
+
+	quick, _ := NewTask("tasks.quick", nil, nil)
+	quickMsg, quickAck := delivery(t, quick)
+	stuck, _ := NewTask("tasks.stuck", nil, nil)
+	stuckMsg, stuckAck := delivery(t, stuck)
+
+	b.messages <- quickMsg
+	b.messages <- stuckMsg
+
+	done := make(chan error)
+	go func() { done <- w.Run() }()
+
+	<-started
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := w.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("stopped with %v", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if !quickAck.acked || quickAck.nacked {
+		t.Error("finished task not acked")
+	}
+
+	if stuckAck.acked || !stuckAck.nacked || !stuckAck.requeued {
+		t.Error("unfinished task not requeued")
+	}
+
+	if err := w.Stop(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+type stateRecorder struct {
+	memoryResults
+	states []string
+}
+
+func (b *stateRecorder) Store(meta *ResultMeta) error {
+	b.states = append(b.states, meta.Status)
+	return b.memoryResults.Store(meta)
+}
+
+func TestWorkerResults(t *testing.T) {
+	b := &routedBroker{}
+	backend := &stateRecorder{memoryResults: memoryResults{results: make(map[string]*ResultMeta)}}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Backend = backend
+	w.TrackStarted = true
+	w.MaxRetries = 1
+	w.Register("tasks.add", func(task *Task) (interface{}, error) { return 3, nil })
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) { return nil, errors.New("failed") })
+
+	added, _ := NewTask("tasks.add", nil, nil)
+	msg, _ := delivery(t, added)
+	w.dispatch(msg)
+
+	meta, _ := backend.Get(added.Id)
+	if meta.Status != StateSuccess || meta.Result != 3.0 || meta.DateDone.IsZero() {
+		t.Errorf("stored %+v", meta)
+	}
+
+	failed, _ := NewTask("tasks.fail", nil, nil)
+	msg, _ = delivery(t, failed)
+	w.dispatch(msg)
+
+	msg = b.messages[len(b.messages)-1]
+	msg.Acknowledger = &ackRecorder{}
+	w.dispatch(msg)
+
+	want := []string{StateStarted, StateSuccess, StateStarted, StateRetry, StateStarted, StateFailure}
+	if strings.Join(backend.states, ",") != strings.Join(want, ",") {
+		t.Errorf("stored states %v", backend.states)
+	}
+
+	r := NewAsyncResult(failed.Id, backend)
+	if _, err := r.Get(context.Background()); err == nil || err.(*TaskError).Type != "Exception" || err.(*TaskError).Message != "failed" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestWorkerIgnoreResult(t *testing.T) {
+	b := &routedBroker{}
+	backend := &stateRecorder{memoryResults: memoryResults{results: make(map[string]*ResultMeta)}}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Backend = backend
+	w.TrackStarted = true
+	w.Register("tasks.add", func(task *Task) (interface{}, error) { return 3, nil })
+
+	x, _ := NewTask("tasks.add", nil, nil)
+	if err := NewPublisher(b).ApplyAsync(x, WithIgnoreResult()); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := b.messages[0]
+	if msg.Headers["ignore_result"] != true {
+		t.Errorf("headers %v", msg.Headers)
+	}
+
+	msg.Acknowledger = &ackRecorder{}
+	w.dispatch(msg)
+
+	if len(backend.states) != 0 {
+		t.Errorf("stored states %v", backend.states)
+	}
+}
+
+func TestWorkerLinks(t *testing.T) {
+	b := &routedBroker{}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Register("tasks.add", func(task *Task) (interface{}, error) { return 3, nil })
+	w.Register("tasks.fail", func(task *Task) (interface{}, error) { return nil, errors.New("failed") })
+
+	callback, _ := NewSignature("tasks.mul", []interface{}{2}, nil)
+	callback = callback.withOption("queue", "math")
+	errback, _ := NewSignature("tasks.on_error", nil, nil)
+
+	added, _ := NewTask("tasks.add", nil, nil)
+	added.Callbacks = []*Signature{callback}
+	added.Errbacks = []*Signature{errback}
+
+	msg, _ := delivery(t, added)
+	w.dispatch(msg)
+
+	if len(b.messages) != 1 || b.keys[0] != "math" {
+		t.Fatalf("published to %v", b.keys)
+	}
+
+	linked, err := DecodeTask(b.messages[0])
+	if err != nil || linked.Task != "tasks.mul" || linked.Id != callback.Id || len(linked.Args) != 2 ||
+		linked.Args[0] != json.Number("3") || len(linked.Errbacks) != 0 {
+		t.Errorf("linked %+v: %v", linked, err)
+	}
+
+	failed, _ := NewTask("tasks.fail", nil, nil)
+	failed.Callbacks = []*Signature{callback}
+	failed.Errbacks = []*Signature{errback}
+
+	msg, _ = delivery(t, failed)
+	w.dispatch(msg)
+
+	if len(b.messages) != 2 || b.keys[1] != "celery" {
+		t.Fatalf("published to %v", b.keys)
+	}
+
+	linked, err = DecodeTask(b.messages[1])
+	if err != nil || linked.Task != "tasks.on_error" || len(linked.Args) != 1 || linked.Args[0] != failed.Id {
+		t.Errorf("linked %+v: %v", linked, err)
+	}
+}
+
+func TestWorkerLineage(t *testing.T) {
+	b := &routedBroker{}
+	p := NewPublisher(b)
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.RegisterContext("tasks.parent", func(ctx context.Context, task *Task) (interface{}, error) {
+		child, _ := NewTask("tasks.child", nil, nil)
+		return nil, p.ApplyAsyncContext(ctx, child)
+	})
+
+	root, _ := NewTask("tasks.root", nil, nil)
+	parent, _ := NewTask("tasks.parent", nil, nil)
+	parent.childOf(root)
+
+	msg, _ := delivery(t, parent)
+	w.dispatch(msg)
+
+	if len(b.messages) != 1 {
+		t.Fatalf("published %d messages", len(b.messages))
+	}
+
+	if h := b.messages[0].Headers; h["root_id"] != root.Id || h["parent_id"] != parent.Id {
+		t.Errorf("published with headers %v", h)
+	}
+
+	child, err := DecodeTask(b.messages[0])
+	if err != nil || child.RootID != root.Id || child.ParentID != parent.Id {
+		t.Errorf("decoded %+v: %v", child, err)
+	}
+}
+
+func TestWorkerExpires(t *testing.T) {
+	b := &routedBroker{}
+	backend := &memoryResults{results: make(map[string]*ResultMeta)}
+
+	w := NewWorker(b, "celery", "", "celery")
+	w.Backend = backend
+	w.Events = NewEventDispatcher(b, "celery@test")
+
+	executed := 0
+	w.Register("tasks.add", func(task *Task) (interface{}, error) {
+		executed++
+		return nil, nil
+	})
+
+	fresh, _ := NewTask("tasks.add", nil, nil)
+	fresh.ExpiresIn = time.Minute
+
+	stale, _ := NewTask("tasks.add", nil, nil)
+	stale.ExpiresIn = time.Millisecond
+
+	for _, task := range []*Task{fresh, stale} {
+		msg, ack := delivery(t, task)
+		time.Sleep(5 * time.Millisecond)
+		w.dispatch(msg)
+
+		if !ack.acked {
+			t.Errorf("task %s not acked", task.Id)
+		}
+	}
+
+	if executed != 1 {
+		t.Errorf("executed %d tasks", executed)
+	}
+
+	if meta, _ := backend.Get(stale.Id); meta.Status != StateRevoked {
+		t.Errorf("stored %+v", meta)
+	}
+
+	revoked := b.messages[len(b.messages)-1]
+	if types := eventTypes(t, b); types[len(types)-1] != EventTaskRevoked || !bytes.Contains(revoked.Body, []byte(`"expired":true`)) {
+		t.Errorf("sent events %v", types)
+	}
+}
+
+func TestWorkerRequest(t *testing.T) {
+	w := NewWorker(nil, "celery", "", "celery")
+	w.Hostname = "celery@test"
+
+	var req *Request
+	var deadline time.Time
+
+	w.RegisterContext("tasks.add", func(ctx context.Context, task *Task) (interface{}, error) {
+		req, _ = RequestFromContext(ctx)
+		deadline, _ = ctx.Deadline()
+		return nil, nil
+	})
+
+	expires := time.Now().Add(time.Hour).UTC().Round(time.Millisecond)
+
+	task, _ := NewTask("tasks.add", nil, nil)
+	task.Expires = expires
+	task.Retries = 2
+
+	msg, _ := delivery(t, task)
+	msg.Exchange, msg.RoutingKey, msg.Redelivered, msg.ConsumerTag = "tasks", "celery", true, "celery@test.1"
+
+	w.dispatch(msg)
+
+	if req == nil || req.Id != task.Id || req.Retries != 2 || req.Hostname != "celery@test" || req.Headers["id"] != task.Id {
+		t.Fatalf("request %+v", req)
+	}
+
+	if req.DeliveryInfo != (DeliveryInfo{Exchange: "tasks", RoutingKey: "celery", Redelivered: true, ConsumerTag: "celery@test.1"}) {
+		t.Errorf("delivery info %+v", req.DeliveryInfo)
+	}
+
+	if !deadline.Equal(expires) {
+		t.Errorf("deadline %v, expires %v", deadline, expires)
+	}
+
+	w.SoftTimeLimit = time.Minute
+	w.dispatch(msg)
+
+	if time.Until(deadline) > time.Minute {
+		t.Errorf("deadline %v not the soft time limit", deadline)
+	}
+}